@@ -1,15 +1,33 @@
 package client
 
-import "github.com/oanatmaria/ethblkcn-observer/storage"
+import (
+	"context"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
 
 //go:generate mockgen -destination=mock_client.go -package=client github.com/oanatmaria/ethblkcn-observer/client Client
 
+// Client fetches chain data from an Ethereum node. Every call is aborted,
+// including its retries, once its context is done.
 type Client interface {
-	GetLatestBlockNumber() (int, error)
-	GetBlockByNumber(blockNum int) (Block, error)
+	GetLatestBlockNumber(ctx context.Context) (int, error)
+	GetBlockByNumber(ctx context.Context, blockNum int) (Block, error)
+	// fetches several blocks at once, blocks that could not be fetched are missing from the result
+	GetBlocksByNumber(ctx context.Context, blockNums []int) (map[int]Block, error)
+	// number of the block referenced by a tag such as "safe" or "finalized"
+	GetBlockNumberByTag(ctx context.Context, tag string) (int, error)
 }
 
 type Block struct {
 	Number       int
+	Hash         string
+	ParentHash   string
 	Transactions []storage.Transaction
+	// ERC-20 transfers emitted by the transactions of the block
+	TokenTransfers []storage.TokenTransfer
+	// ERC-721 and ERC-1155 transfers emitted by the transactions of the block
+	NftTransfers []storage.NftTransfer
+	// ETH moved by calls made by contracts, only set when tracing is enabled
+	InternalTransfers []storage.InternalTransfer
 }
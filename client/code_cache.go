@@ -0,0 +1,106 @@
+package client
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+const (
+	defaultCodeCacheSize = 10000
+	// an address without code can get code later through CREATE2 or an
+	// EIP-7702 delegation, so those results are only trusted for a while
+	defaultEOACacheTTL = 10 * time.Minute
+)
+
+type CodeCacheStats struct {
+	Hits   uint64
+	Misses uint64
+	Size   int
+}
+
+type codeCacheEntry struct {
+	address    string
+	isContract bool
+	// zero for contracts, which keep their code
+	expiresAt time.Time
+}
+
+// codeCache remembers whether an address is a smart contract. It holds at
+// most capacity entries and evicts the least recently used one when full.
+type codeCache struct {
+	mu       sync.Mutex
+	capacity int
+	eoaTTL   time.Duration
+	entries  map[string]*list.Element
+	order    *list.List
+	hits     uint64
+	misses   uint64
+	now      func() time.Time
+}
+
+func newCodeCache(capacity int, eoaTTL time.Duration) *codeCache {
+	return &codeCache{
+		capacity: capacity,
+		eoaTTL:   eoaTTL,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+func (c *codeCache) get(address string) (isContract bool, found bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.entries[address]
+	if !exists {
+		c.misses++
+		return false, false
+	}
+
+	entry := element.Value.(*codeCacheEntry)
+	if !entry.expiresAt.IsZero() && !c.now().Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, address)
+		c.misses++
+		return false, false
+	}
+
+	c.order.MoveToFront(element)
+	c.hits++
+	return entry.isContract, true
+}
+
+func (c *codeCache) add(address string, isContract bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &codeCacheEntry{address: address, isContract: isContract}
+	if !isContract {
+		entry.expiresAt = c.now().Add(c.eoaTTL)
+	}
+
+	if element, exists := c.entries[address]; exists {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[address] = c.order.PushFront(entry)
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*codeCacheEntry).address)
+	}
+}
+
+func (c *codeCache) stats() CodeCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return CodeCacheStats{
+		Hits:   c.hits,
+		Misses: c.misses,
+		Size:   c.order.Len(),
+	}
+}
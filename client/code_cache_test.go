@@ -0,0 +1,87 @@
+package client
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCodeCache_ContractsDoNotExpire(t *testing.T) {
+	now := time.Now()
+	cache := newCodeCache(10, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.add("0xcontract", true)
+	cache.add("0xwallet", false)
+
+	now = now.Add(2 * time.Minute)
+
+	if isContract, found := cache.get("0xcontract"); !found || !isContract {
+		t.Errorf("Expected the contract to still be cached")
+	}
+	if _, found := cache.get("0xwallet"); found {
+		t.Errorf("Expected the EOA entry to be expired")
+	}
+
+	stats := cache.stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Size != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestCodeCache_EvictsLeastRecentlyUsed(t *testing.T) {
+	cache := newCodeCache(2, time.Minute)
+
+	cache.add("0x1", true)
+	cache.add("0x2", true)
+	cache.get("0x1")
+	cache.add("0x3", true)
+
+	if _, found := cache.get("0x2"); found {
+		t.Errorf("Expected 0x2 to be evicted")
+	}
+	if _, found := cache.get("0x1"); !found {
+		t.Errorf("Expected 0x1 to be kept")
+	}
+	if _, found := cache.get("0x3"); !found {
+		t.Errorf("Expected 0x3 to be kept")
+	}
+}
+
+func TestCodeCache_UpdatesExistingEntry(t *testing.T) {
+	cache := newCodeCache(2, time.Minute)
+
+	// an EOA that received code through a delegation
+	cache.add("0x1", false)
+	cache.add("0x1", true)
+
+	if isContract, found := cache.get("0x1"); !found || !isContract {
+		t.Errorf("Expected 0x1 to be a contract")
+	}
+	if size := cache.stats().Size; size != 1 {
+		t.Errorf("Expected a single entry, got %d", size)
+	}
+}
+
+func TestCodeCache_Concurrent(t *testing.T) {
+	cache := newCodeCache(50, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				address := fmt.Sprintf("0x%d", (worker*100+j)%80)
+				cache.add(address, j%2 == 0)
+				cache.get(address)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if size := cache.stats().Size; size > 50 {
+		t.Errorf("Expected at most 50 entries, got %d", size)
+	}
+}
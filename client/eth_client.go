@@ -2,21 +2,35 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/oanatmaria/ethblkcn-observer/storage"
 )
 
 const (
-	ethRrpUrl                   = "https://ethereum-rpc.publicnode.com"
+	// DefaultEndpoint is the RPC endpoint used when none is set with WithEndpoints.
+	DefaultEndpoint             = "https://ethereum-rpc.publicnode.com"
 	regularTransactionType      = "Regular transaction"
 	smartContractDeploymentType = "Contract deployment"
 	smartContractExecutionType  = "Contract execution"
+	// MaxBatchSize is the most requests sent in a single batch, providers
+	// commonly reject larger ones. Larger batches are split.
+	MaxBatchSize = 100
+	// bounds a single HTTP attempt, the deadline of the whole call is set with WithRequestTimeout
+	defaultHTTPTimeout = 30 * time.Second
+	// code of an EOA delegating to a contract with EIP-7702, followed by the
+	// address of the contract
+	delegationPrefix = "0xef0100"
 )
 
 type RpcRequest struct {
@@ -38,36 +52,238 @@ type RpcError struct {
 	Message string `json:"message"`
 }
 
+func (e *RpcError) Error() string {
+	return fmt.Sprintf("RPC error: %d - %s", e.Code, e.Message)
+}
+
 type BlockResponse struct {
 	Number       string              `json:"number"`
+	Hash         string              `json:"hash"`
+	ParentHash   string              `json:"parentHash"`
 	Transactions []TransactionDetail `json:"transactions"`
 }
 
 type TransactionDetail struct {
-	Hash      string `json:"hash"`
-	From      string `json:"from"`
-	To        string `json:"to,omitempty"`
-	Value     string `json:"value"`
-	BlockHash string `json:"blockHash"`
+	Hash                 string              `json:"hash"`
+	From                 string              `json:"from"`
+	To                   string              `json:"to,omitempty"`
+	Value                string              `json:"value"`
+	BlockHash            string              `json:"blockHash"`
+	Type                 string              `json:"type"`
+	ChainID              string              `json:"chainId,omitempty"`
+	Nonce                string              `json:"nonce"`
+	Input                string              `json:"input"`
+	Gas                  string              `json:"gas"`
+	GasPrice             string              `json:"gasPrice,omitempty"`
+	MaxFeePerGas         string              `json:"maxFeePerGas,omitempty"`
+	MaxPriorityFeePerGas string              `json:"maxPriorityFeePerGas,omitempty"`
+	AccessList           []AccessTuple       `json:"accessList,omitempty"`
+	MaxFeePerBlobGas     string              `json:"maxFeePerBlobGas,omitempty"`
+	BlobVersionedHashes  []string            `json:"blobVersionedHashes,omitempty"`
+	AuthorizationList    []AuthorizationItem `json:"authorizationList,omitempty"`
+}
+
+type AccessTuple struct {
+	Address     string   `json:"address"`
+	StorageKeys []string `json:"storageKeys"`
+}
+
+type AuthorizationItem struct {
+	ChainID string `json:"chainId"`
+	Address string `json:"address"`
+	Nonce   string `json:"nonce"`
 }
 
 type EthClient struct {
-	baseUrl string
+	pool       *providerPool
+	requestID  atomic.Int64
+	httpClient *http.Client
+	// deadline of a single call, including its retries, zero for none
+	requestTimeout time.Duration
+	retry          retryConfig
+	limiter        *rateLimiter
+	// set once the provider rejected a batch, requests are then sent one by one
+	batchUnsupported atomic.Bool
+	// set once the provider rejected eth_getBlockReceipts, receipts are then fetched per transaction
+	blockReceiptsUnsupported atomic.Bool
+	codeCache                *codeCache
+	tracer                   Tracer
+}
+
+// httpStatusError is returned when the provider answers with a non-200 status.
+type httpStatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+	// delay asked for by the provider, zero when it sent no Retry-After
+	RetryAfter time.Duration
+}
+
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected HTTP response: %s - %s", e.Status, e.Body)
+}
+
+type Option func(*clientConfig)
+
+type clientConfig struct {
+	endpoints      []string
+	policy         Policy
+	httpClient     *http.Client
+	requestTimeout time.Duration
+	retry          retryConfig
+	// requests per second, zero disables the rate limiter
+	rateLimit float64
+	burst     int
+	tracer    Tracer
+}
+
+// WithEndpoints sets the RPC endpoints used by the client, in priority order.
+func WithEndpoints(urls ...string) Option {
+	return func(c *clientConfig) {
+		c.endpoints = urls
+	}
+}
+
+// WithPolicy sets how the client picks the endpoint for each request.
+func WithPolicy(policy Policy) Option {
+	return func(c *clientConfig) {
+		c.policy = policy
+	}
+}
+
+// WithHTTPClient sets the HTTP client used to reach the endpoints, which
+// controls the timeouts, the transport and the proxy of the requests.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *clientConfig) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithRequestTimeout sets the deadline of every call made through the
+// client, its retries included.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(c *clientConfig) {
+		c.requestTimeout = timeout
+	}
+}
+
+// WithRetry sets how many times a request failing with a transient error is
+// retried and the bounds of the exponential backoff between the attempts.
+func WithRetry(maxRetries int, baseBackoff, maxBackoff time.Duration) Option {
+	return func(c *clientConfig) {
+		c.retry = retryConfig{maxRetries: maxRetries, baseBackoff: baseBackoff, maxBackoff: maxBackoff}
+	}
+}
+
+// WithRateLimit limits the client to requestsPerSecond HTTP requests, with
+// bursts of up to burst requests.
+func WithRateLimit(requestsPerSecond float64, burst int) Option {
+	return func(c *clientConfig) {
+		c.rateLimit = requestsPerSecond
+		c.burst = burst
+	}
+}
+
+// WithTracer traces every block to find the ETH moved by calls made by
+// contracts, which is not part of the transactions. TracerNone disables it.
+func WithTracer(tracer Tracer) Option {
+	return func(c *clientConfig) {
+		c.tracer = tracer
+	}
+}
+
+func NewEthClient(opts ...Option) *EthClient {
+	config := clientConfig{
+		endpoints: []string{DefaultEndpoint},
+		policy:    PolicyPriority,
+		httpClient: &http.Client{
+			Timeout: defaultHTTPTimeout,
+		},
+		retry: retryConfig{
+			maxRetries:  DefaultMaxRetries,
+			baseBackoff: DefaultBaseBackoff,
+			maxBackoff:  DefaultMaxBackoff,
+		},
+		tracer: TracerNone,
+	}
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	client := &EthClient{
+		pool:           newProviderPool(config.endpoints, config.policy),
+		httpClient:     config.httpClient,
+		requestTimeout: config.requestTimeout,
+		retry:          config.retry,
+		codeCache:      newCodeCache(defaultCodeCacheSize, defaultEOACacheTTL),
+		tracer:         config.tracer,
+	}
+	if config.rateLimit > 0 {
+		client.limiter = newRateLimiter(config.rateLimit, config.burst)
+	}
+	return client
+}
+
+// EndpointHealth reports the health of every configured RPC endpoint.
+func (c *EthClient) EndpointHealth() []EndpointHealth {
+	return c.pool.health()
+}
+
+// RunHealthChecks checks every endpoint on each interval until the context
+// is cancelled, so endpoints that recovered are used again and endpoints that
+// went down are skipped before a request fails on them.
+func (c *EthClient) RunHealthChecks(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.checkEndpoints(ctx)
+		}
+	}
+}
+
+func (c *EthClient) checkEndpoints(ctx context.Context) {
+	payloadBytes, err := json.Marshal(RpcRequest{
+		Jsonrpc: "2.0",
+		Method:  "eth_blockNumber",
+		Params:  []interface{}{},
+		ID:      c.nextID(),
+	})
+	if err != nil {
+		return
+	}
+
+	for _, endpoint := range c.pool.endpoints {
+		start := time.Now()
+		if _, err := c.postTo(ctx, endpoint.health.URL, payloadBytes); err != nil {
+			c.pool.reportFailure(endpoint, err, isRateLimited(err))
+		} else {
+			c.pool.reportSuccess(endpoint, time.Since(start))
+		}
+	}
 }
 
-func NewEthClient() Client {
-	return &EthClient{}
+// CodeCacheStats reports how often contract lookups were answered from the cache.
+func (c *EthClient) CodeCacheStats() CodeCacheStats {
+	return c.codeCache.stats()
 }
 
-func (c *EthClient) GetLatestBlockNumber() (int, error) {
+func (c *EthClient) GetLatestBlockNumber(ctx context.Context) (int, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
 	payload := RpcRequest{
 		Jsonrpc: "2.0",
 		Method:  "eth_blockNumber",
 		Params:  []interface{}{},
-		ID:      1,
+		ID:      c.nextID(),
 	}
 
-	response, err := c.sendRequest(payload)
+	response, err := c.sendRequest(ctx, payload)
 	if err != nil {
 		return 0, err
 	}
@@ -77,41 +293,170 @@ func (c *EthClient) GetLatestBlockNumber() (int, error) {
 		return 0, errors.New("unexpected response format for block number")
 	}
 
-	blockNum, err := strconv.ParseInt(blockHex[2:], 16, 64)
+	return parseBlockNumber(blockHex)
+}
+
+func (c *EthClient) GetBlockNumberByTag(ctx context.Context, tag string) (int, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	payload := RpcRequest{
+		Jsonrpc: "2.0",
+		Method:  "eth_getBlockByNumber",
+		Params:  []interface{}{tag, false},
+		ID:      c.nextID(),
+	}
+
+	response, err := c.sendRequest(ctx, payload)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse block number: %v", err)
+		return 0, err
 	}
 
-	return int(blockNum), nil
+	var header struct {
+		Number string `json:"number"`
+	}
+	if err := mapToStruct(response.Result, &header); err != nil {
+		return 0, fmt.Errorf("unexpected response format for %s block: %v", tag, err)
+	}
+
+	return parseBlockNumber(header.Number)
 }
 
-func (c *EthClient) GetBlockByNumber(blockNum int) (Block, error) {
-	blockData, err := c.fetchBlockData(blockNum)
+func (c *EthClient) GetBlockByNumber(ctx context.Context, blockNum int) (Block, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	blockData, err := c.fetchBlockData(ctx, blockNum)
 	if err != nil {
 		return Block{}, fmt.Errorf("failed to fetch block data: %v", err)
 	}
 
-	transactions, err := c.parseTransactions(blockData.Transactions, blockNum)
+	receipts, err := c.fetchReceipts(ctx, map[int]BlockResponse{blockNum: blockData})
+	if err != nil {
+		return Block{}, fmt.Errorf("failed to fetch receipts: %v", err)
+	}
+	if _, fetched := receipts[blockNum]; !fetched {
+		return Block{}, fmt.Errorf("failed to fetch receipts of block %d", blockNum)
+	}
+
+	transactions, err := c.parseTransactions(ctx, blockData.Transactions, blockNum, receipts[blockNum])
 	if err != nil {
 		return Block{}, fmt.Errorf("failed to parse transactions: %v", err)
 	}
 
+	logs := blockLogs(blockData.Transactions, receipts[blockNum])
+
+	var internalTransfers []storage.InternalTransfer
+	if c.tracer != TracerNone {
+		traced, err := c.fetchInternalTransfers(ctx, map[int]BlockResponse{blockNum: blockData})
+		if err != nil {
+			return Block{}, fmt.Errorf("failed to trace block: %v", err)
+		}
+		var fetched bool
+		if internalTransfers, fetched = traced[blockNum]; !fetched {
+			return Block{}, fmt.Errorf("failed to trace block %d", blockNum)
+		}
+	}
+
 	// Construct the Block struct to return
 	return Block{
-		Number:       blockNum,
-		Transactions: transactions,
+		Number:            blockNum,
+		Hash:              blockData.Hash,
+		ParentHash:        blockData.ParentHash,
+		Transactions:      transactions,
+		TokenTransfers:    decodeTokenTransfers(logs, blockNum),
+		NftTransfers:      decodeNftTransfers(logs, blockNum),
+		InternalTransfers: internalTransfers,
 	}, nil
 }
 
-func (c *EthClient) fetchBlockData(blockNum int) (BlockResponse, error) {
+// GetBlocksByNumber fetches several blocks with a single batch request and
+// classifies all of their transactions with one more batch of code lookups.
+// Blocks the provider could not return are left out of the result.
+func (c *EthClient) GetBlocksByNumber(ctx context.Context, blockNums []int) (map[int]Block, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+
+	payloads := make([]RpcRequest, len(blockNums))
+	for i, blockNum := range blockNums {
+		payloads[i] = RpcRequest{
+			Jsonrpc: "2.0",
+			Method:  "eth_getBlockByNumber",
+			Params:  []interface{}{fmt.Sprintf("0x%x", blockNum), true},
+			ID:      c.nextID(),
+		}
+	}
+
+	responses, err := c.sendBatch(ctx, payloads)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch blocks: %v", err)
+	}
+
+	blocksData := make(map[int]BlockResponse, len(blockNums))
+	var allTransactions []TransactionDetail
+	for i, response := range responses {
+		if response.Error != nil || response.Result == nil {
+			continue
+		}
+		var blockData BlockResponse
+		if err := mapToStruct(response.Result, &blockData); err != nil {
+			continue
+		}
+		blocksData[blockNums[i]] = blockData
+		allTransactions = append(allTransactions, blockData.Transactions...)
+	}
+
+	contracts, err := c.areSmartContracts(ctx, recipients(allTransactions))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse transactions: %v", err)
+	}
+
+	receipts, err := c.fetchReceipts(ctx, blocksData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch receipts: %v", err)
+	}
+
+	var internalTransfers map[int][]storage.InternalTransfer
+	if c.tracer != TracerNone {
+		internalTransfers, err = c.fetchInternalTransfers(ctx, blocksData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to trace blocks: %v", err)
+		}
+	}
+
+	blocks := make(map[int]Block, len(blocksData))
+	for blockNum, blockData := range blocksData {
+		blockReceipts, fetched := receipts[blockNum]
+		if !fetched {
+			continue
+		}
+		blockInternalTransfers, traced := internalTransfers[blockNum]
+		if c.tracer != TracerNone && !traced {
+			continue
+		}
+		logs := blockLogs(blockData.Transactions, blockReceipts)
+		blocks[blockNum] = Block{
+			Number:            blockNum,
+			Hash:              blockData.Hash,
+			ParentHash:        blockData.ParentHash,
+			Transactions:      buildTransactions(blockData.Transactions, blockNum, contracts, blockReceipts),
+			TokenTransfers:    decodeTokenTransfers(logs, blockNum),
+			NftTransfers:      decodeNftTransfers(logs, blockNum),
+			InternalTransfers: blockInternalTransfers,
+		}
+	}
+	return blocks, nil
+}
+
+func (c *EthClient) fetchBlockData(ctx context.Context, blockNum int) (BlockResponse, error) {
 	payload := RpcRequest{
 		Jsonrpc: "2.0",
 		Method:  "eth_getBlockByNumber",
 		Params:  []interface{}{fmt.Sprintf("0x%x", blockNum), true},
-		ID:      1,
+		ID:      c.nextID(),
 	}
 
-	response, err := c.sendRequest(payload)
+	response, err := c.sendRequest(ctx, payload)
 	if err != nil {
 		return BlockResponse{}, err
 	}
@@ -125,31 +470,53 @@ func (c *EthClient) fetchBlockData(blockNum int) (BlockResponse, error) {
 	return block, nil
 }
 
-func (c *EthClient) parseTransactions(transactionsData []TransactionDetail, blockNum int) ([]storage.Transaction, error) {
-	transactions := []storage.Transaction{}
+func (c *EthClient) parseTransactions(ctx context.Context, transactionsData []TransactionDetail, blockNum int, receipts map[string]ReceiptResponse) ([]storage.Transaction, error) {
+	contracts, err := c.areSmartContracts(ctx, recipients(transactionsData))
+	if err != nil {
+		return nil, err
+	}
+	return buildTransactions(transactionsData, blockNum, contracts, receipts), nil
+}
+
+// recipients returns the distinct addresses the transactions were sent to.
+func recipients(transactionsData []TransactionDetail) []string {
+	seen := make(map[string]struct{})
+	addresses := []string{}
 	for _, tx := range transactionsData {
-		parsedTx, err := c.parseTransaction(tx, blockNum)
-		if err != nil {
-			return nil, err
+		if tx.To == "" {
+			continue
+		}
+		if _, exists := seen[tx.To]; exists {
+			continue
 		}
-		transactions = append(transactions, parsedTx)
+		seen[tx.To] = struct{}{}
+		addresses = append(addresses, tx.To)
 	}
-	return transactions, nil
+	return addresses
 }
 
-func (c *EthClient) parseTransaction(txDetail TransactionDetail, blockNum int) (storage.Transaction, error) {
+func buildTransactions(transactionsData []TransactionDetail, blockNum int, contracts map[string]bool, receipts map[string]ReceiptResponse) []storage.Transaction {
+	transactions := []storage.Transaction{}
+	for i, txDetail := range transactionsData {
+		tx := parseTransaction(txDetail, blockNum, contracts)
+		// nodes list the transactions of a block in order, so the position is their index
+		tx.TxIndex = i
+		if receipt, found := receipts[txDetail.Hash]; found {
+			applyReceipt(&tx, receipt)
+		}
+		transactions = append(transactions, tx)
+	}
+	return transactions
+}
+
+func parseTransaction(txDetail TransactionDetail, blockNum int, contracts map[string]bool) storage.Transaction {
 	var txType, toAddress string
 
 	if txDetail.To == "" {
 		txType = smartContractDeploymentType
 	} else {
 		toAddress = txDetail.To
-		isSmartContract, err := c.isSmartContract(toAddress)
-		if err != nil {
-			return storage.Transaction{}, err
-		}
-
-		if isSmartContract {
+		if contracts[toAddress] {
 			txType = smartContractExecutionType
 		} else {
 			txType = regularTransactionType
@@ -157,54 +524,288 @@ func (c *EthClient) parseTransaction(txDetail TransactionDetail, blockNum int) (
 	}
 
 	return storage.Transaction{
-		Hash:      txDetail.Hash,
-		From:      txDetail.From,
-		To:        toAddress,
-		Value:     txDetail.Value,
-		BlockHash: txDetail.BlockHash,
-		BlockNum:  blockNum,
-		Type:      txType,
-	}, nil
+		Hash:                 txDetail.Hash,
+		From:                 storage.NormalizeAddress(txDetail.From),
+		To:                   storage.NormalizeAddress(toAddress),
+		Value:                toQuantity(txDetail.Value),
+		BlockHash:            txDetail.BlockHash,
+		BlockNum:             blockNum,
+		Type:                 txType,
+		TxType:               envelopeType(txDetail.Type),
+		ChainID:              toQuantity(txDetail.ChainID),
+		Nonce:                toQuantity(txDetail.Nonce),
+		Input:                txDetail.Input,
+		Gas:                  toQuantity(txDetail.Gas),
+		GasPrice:             toQuantity(txDetail.GasPrice),
+		MaxFeePerGas:         toQuantity(txDetail.MaxFeePerGas),
+		MaxPriorityFeePerGas: toQuantity(txDetail.MaxPriorityFeePerGas),
+		AccessList:           accessList(txDetail.AccessList),
+		MaxFeePerBlobGas:     toQuantity(txDetail.MaxFeePerBlobGas),
+		BlobVersionedHashes:  txDetail.BlobVersionedHashes,
+		AuthorizationList:    authorizationList(txDetail.AuthorizationList),
+	}
 }
 
-func (c *EthClient) isSmartContract(address string) (bool, error) {
-	payload := RpcRequest{
-		Jsonrpc: "2.0",
-		Method:  "eth_getCode",
-		Params:  []interface{}{address, "latest"},
-		ID:      1,
+// envelopeType names the EIP-2718 type of a transaction. Nodes omit the type
+// of some legacy transactions.
+func envelopeType(txType string) string {
+	switch txType {
+	case "", "0x0":
+		return storage.TxTypeLegacy
+	case "0x1":
+		return storage.TxTypeAccessList
+	case "0x2":
+		return storage.TxTypeDynamicFee
+	case "0x3":
+		return storage.TxTypeBlob
+	case "0x4":
+		return storage.TxTypeSetCode
+	}
+	return txType
+}
+
+func accessList(tuples []AccessTuple) []storage.AccessTuple {
+	if tuples == nil {
+		return nil
+	}
+	list := make([]storage.AccessTuple, len(tuples))
+	for i, tuple := range tuples {
+		list[i] = storage.AccessTuple{Address: storage.NormalizeAddress(tuple.Address), StorageKeys: tuple.StorageKeys}
+	}
+	return list
+}
+
+func authorizationList(items []AuthorizationItem) []storage.Authorization {
+	if items == nil {
+		return nil
+	}
+	list := make([]storage.Authorization, len(items))
+	for i, item := range items {
+		list[i] = storage.Authorization{ChainID: toQuantity(item.ChainID), Address: storage.NormalizeAddress(item.Address), Nonce: toQuantity(item.Nonce)}
+	}
+	return list
+}
+
+// areSmartContracts reports which of the addresses are smart contracts. The
+// addresses missing from the cache are looked up in one batch.
+func (c *EthClient) areSmartContracts(ctx context.Context, addresses []string) (map[string]bool, error) {
+	contracts := make(map[string]bool, len(addresses))
+	var unknown []string
+	for _, address := range addresses {
+		if isContract, found := c.codeCache.get(address); found {
+			contracts[address] = isContract
+		} else {
+			unknown = append(unknown, address)
+		}
 	}
 
-	response, err := c.sendRequest(payload)
+	payloads := make([]RpcRequest, len(unknown))
+	for i, address := range unknown {
+		payloads[i] = RpcRequest{
+			Jsonrpc: "2.0",
+			Method:  "eth_getCode",
+			Params:  []interface{}{address, "latest"},
+			ID:      c.nextID(),
+		}
+	}
+
+	responses, err := c.sendBatch(ctx, payloads)
 	if err != nil {
-		return false, err
+		return nil, err
 	}
 
-	code, ok := response.Result.(string)
-	if !ok {
-		return false, errors.New("unexpected response format for smart contract code")
+	for i, response := range responses {
+		if response.Error != nil {
+			return nil, response.Error
+		}
+		code, ok := response.Result.(string)
+		if !ok {
+			return nil, errors.New("unexpected response format for smart contract code")
+		}
+		// a delegated EOA is still an EOA and can drop its delegation, so it is
+		// cached with the TTL of EOAs
+		isContract := code != "0x" && !strings.HasPrefix(strings.ToLower(code), delegationPrefix)
+		c.codeCache.add(unknown[i], isContract)
+		contracts[unknown[i]] = isContract
+	}
+	return contracts, nil
+}
+
+// withTimeout applies the configured deadline to a call.
+func (c *EthClient) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.requestTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.requestTimeout)
+}
+
+func (c *EthClient) nextID() int {
+	return int(c.requestID.Add(1))
+}
+
+// sendRequest sends a single request, retrying it while it fails with a
+// transient error.
+func (c *EthClient) sendRequest(ctx context.Context, payload RpcRequest) (*RpcResponse, error) {
+	var rpcResponse RpcResponse
+	err := c.withRetry(ctx, func() error {
+		body, err := c.post(ctx, payload)
+		if err != nil {
+			return err
+		}
+
+		rpcResponse = RpcResponse{}
+		if err := json.Unmarshal(body, &rpcResponse); err != nil {
+			return fmt.Errorf("failed to decode response: %v", err)
+		}
+
+		if rpcResponse.Error != nil {
+			return rpcResponse.Error
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &rpcResponse, nil
+}
+
+// sendBatch sends the requests as JSON-RPC batches and returns the responses
+// in the order of the requests. Errors of single requests are reported in the
+// Error field of their response, the returned error means the whole batch
+// failed.
+func (c *EthClient) sendBatch(ctx context.Context, payloads []RpcRequest) ([]*RpcResponse, error) {
+	responses := make([]*RpcResponse, 0, len(payloads))
+	for start := 0; start < len(payloads); start += MaxBatchSize {
+		chunk := payloads[start:min(start+MaxBatchSize, len(payloads))]
+		chunkResponses, err := c.sendBatchChunk(ctx, chunk)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, chunkResponses...)
+	}
+	return responses, nil
+}
+
+func (c *EthClient) sendBatchChunk(ctx context.Context, payloads []RpcRequest) ([]*RpcResponse, error) {
+	if len(payloads) == 1 || c.batchUnsupported.Load() {
+		return c.sendOneByOne(ctx, payloads)
+	}
+
+	var body []byte
+	err := c.withRetry(ctx, func() error {
+		var err error
+		body, err = c.post(ctx, payloads)
+		return err
+	})
+	if err != nil {
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && isBatchRejection(statusErr.StatusCode) {
+			return c.fallBackFromBatch(ctx, payloads, err)
+		}
+		return nil, err
+	}
+
+	var rpcResponses []RpcResponse
+	if err := json.Unmarshal(body, &rpcResponses); err != nil {
+		// providers without batch support answer with a single error object
+		var rpcResponse RpcResponse
+		if json.Unmarshal(body, &rpcResponse) == nil && rpcResponse.Error != nil {
+			return c.fallBackFromBatch(ctx, payloads, rpcResponse.Error)
+		}
+		return nil, fmt.Errorf("failed to decode batch response: %v", err)
+	}
+
+	// the responses of a batch can come in any order
+	byID := make(map[int]*RpcResponse, len(rpcResponses))
+	for i := range rpcResponses {
+		byID[rpcResponses[i].ID] = &rpcResponses[i]
 	}
 
-	return code != "0x", nil
+	responses := make([]*RpcResponse, len(payloads))
+	for i, payload := range payloads {
+		response, ok := byID[payload.ID]
+		if !ok {
+			response = &RpcResponse{ID: payload.ID, Error: &RpcError{Message: "no response in batch"}}
+		}
+		responses[i] = response
+	}
+	return responses, nil
+}
+
+func (c *EthClient) fallBackFromBatch(ctx context.Context, payloads []RpcRequest, cause error) ([]*RpcResponse, error) {
+	log.Printf("Batch requests rejected by provider, sending requests one by one: %v", cause)
+	c.batchUnsupported.Store(true)
+	return c.sendOneByOne(ctx, payloads)
+}
+
+func (c *EthClient) sendOneByOne(ctx context.Context, payloads []RpcRequest) ([]*RpcResponse, error) {
+	responses := make([]*RpcResponse, len(payloads))
+	for i, payload := range payloads {
+		response, err := c.sendRequest(ctx, payload)
+		if err != nil {
+			var rpcErr *RpcError
+			if !errors.As(err, &rpcErr) {
+				return nil, err
+			}
+			response = &RpcResponse{ID: payload.ID, Error: rpcErr}
+		}
+		responses[i] = response
+	}
+	return responses, nil
+}
+
+// isBatchRejection reports whether a status code means the provider does not
+// accept batches, as opposed to being temporarily unavailable.
+func isBatchRejection(statusCode int) bool {
+	return statusCode >= 400 && statusCode < 500 && statusCode != http.StatusTooManyRequests
 }
 
-func (c *EthClient) sendRequest(payload RpcRequest) (*RpcResponse, error) {
+// post sends the payload to the endpoints picked by the pool, failing over
+// to the next one when an endpoint is down, erroring or rate limiting.
+func (c *EthClient) post(ctx context.Context, payload interface{}) ([]byte, error) {
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request payload: %v", err)
 	}
 
-	var url string
-	// only for tests
-	if c.baseUrl != "" {
-		url = c.baseUrl
-	} else {
-		url = ethRrpUrl
+	var lastErr error
+	for _, endpoint := range c.pool.candidates() {
+		if err := c.limiter.wait(ctx); err != nil {
+			return nil, err
+		}
+
+		start := time.Now()
+		body, err := c.postTo(ctx, endpoint.health.URL, payloadBytes)
+		if err == nil {
+			c.pool.reportSuccess(endpoint, time.Since(start))
+			return body, nil
+		}
+
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if !isEndpointFailure(err) {
+			// the endpoint works but rejected the request itself
+			return nil, err
+		}
+		c.pool.reportFailure(endpoint, err, isRateLimited(err))
+		lastErr = err
 	}
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(payloadBytes))
+	return nil, lastErr
+}
+
+func (c *EthClient) postTo(ctx context.Context, url string, payloadBytes []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(payloadBytes))
 	if err != nil {
-		return nil, fmt.Errorf("HTTP request failed: %v", err)
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %w", err)
 	}
 	defer func() {
 		if closeErr := resp.Body.Close(); closeErr != nil {
@@ -214,19 +815,47 @@ func (c *EthClient) sendRequest(payload RpcRequest) (*RpcResponse, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("unexpected HTTP response: %s - %s", resp.Status, string(body))
+		return nil, &httpStatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       string(body),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
 	}
 
-	var rpcResponse RpcResponse
-	if err := json.NewDecoder(resp.Body).Decode(&rpcResponse); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %v", err)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
 	}
+	return body, nil
+}
 
-	if rpcResponse.Error != nil {
-		return nil, fmt.Errorf("RPC error: %d - %s", rpcResponse.Error.Code, rpcResponse.Error.Message)
+// isEndpointFailure reports whether another endpoint may succeed where this
+// one failed, which is not the case when the request itself was rejected.
+func isEndpointFailure(err error) bool {
+	var statusErr *httpStatusError
+	if !errors.As(err, &statusErr) {
+		return true
 	}
+	return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+}
 
-	return &rpcResponse, nil
+func isRateLimited(err error) bool {
+	var statusErr *httpStatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusTooManyRequests
+}
+
+func parseBlockNumber(blockHex string) (int, error) {
+	if len(blockHex) < 3 || blockHex[:2] != "0x" {
+		return 0, fmt.Errorf("failed to parse block number: invalid value %q", blockHex)
+	}
+
+	blockNum, err := strconv.ParseInt(blockHex[2:], 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse block number: %v", err)
+	}
+
+	return int(blockNum), nil
 }
 
 func mapToStruct(data interface{}, target interface{}) error {
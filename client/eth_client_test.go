@@ -0,0 +1,576 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+// testNode is a fake JSON-RPC provider answering single and batch requests.
+type testNode struct {
+	server *httptest.Server
+
+	mu           sync.Mutex
+	httpRequests int
+	// when set, batch requests are answered with this status code
+	rejectBatchStatus int
+	// when set, batch requests are answered with a single error object
+	rejectBatchWithError bool
+	reverseBatches       bool
+	// the first failures requests are answered with failStatus
+	failures   int
+	failStatus int
+	retryAfter string
+	handle     func(request RpcRequest) RpcResponse
+}
+
+func newTestNode(t *testing.T, handle func(request RpcRequest) RpcResponse) *testNode {
+	node := &testNode{handle: handle}
+	node.server = httptest.NewServer(http.HandlerFunc(node.serveHTTP))
+	t.Cleanup(node.server.Close)
+	return node
+}
+
+func (n *testNode) client() *EthClient {
+	return NewEthClient(WithEndpoints(n.server.URL), WithRetry(2, time.Millisecond, 5*time.Millisecond))
+}
+
+func (n *testNode) requests() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.httpRequests
+}
+
+func (n *testNode) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	n.httpRequests++
+	fail := n.httpRequests <= n.failures
+	n.mu.Unlock()
+
+	if fail {
+		if n.retryAfter != "" {
+			w.Header().Set("Retry-After", n.retryAfter)
+		}
+		http.Error(w, "unavailable", n.failStatus)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	if strings.HasPrefix(strings.TrimSpace(string(body)), "[") {
+		if n.rejectBatchStatus != 0 {
+			http.Error(w, "batch requests are not supported", n.rejectBatchStatus)
+			return
+		}
+		if n.rejectBatchWithError {
+			_ = json.NewEncoder(w).Encode(RpcResponse{Jsonrpc: "2.0", Error: &RpcError{Code: -32600, Message: "invalid request"}})
+			return
+		}
+
+		var requests []RpcRequest
+		_ = json.Unmarshal(body, &requests)
+		responses := make([]RpcResponse, len(requests))
+		for i, request := range requests {
+			responses[i] = n.respond(request)
+		}
+		if n.reverseBatches {
+			for i, j := 0, len(responses)-1; i < j; i, j = i+1, j-1 {
+				responses[i], responses[j] = responses[j], responses[i]
+			}
+		}
+		_ = json.NewEncoder(w).Encode(responses)
+		return
+	}
+
+	var request RpcRequest
+	_ = json.Unmarshal(body, &request)
+	_ = json.NewEncoder(w).Encode(n.respond(request))
+}
+
+func (n *testNode) respond(request RpcRequest) RpcResponse {
+	response := n.handle(request)
+	response.Jsonrpc = "2.0"
+	response.ID = request.ID
+	return response
+}
+
+// codeHandler answers eth_getCode with code for the given contract addresses.
+func codeHandler(contracts ...string) func(request RpcRequest) RpcResponse {
+	return func(request RpcRequest) RpcResponse {
+		address := request.Params[0].(string)
+		for _, contract := range contracts {
+			if address == contract {
+				return RpcResponse{Result: "0x6080"}
+			}
+		}
+		return RpcResponse{Result: "0x"}
+	}
+}
+
+// quantity parses a decimal or hex quantity that is known to be valid.
+func quantity(s string) storage.Quantity {
+	q, err := storage.ParseQuantity(s)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func TestGetLatestBlockNumber(t *testing.T) {
+	node := newTestNode(t, func(request RpcRequest) RpcResponse {
+		return RpcResponse{Result: "0x1b4"}
+	})
+
+	blockNum, err := node.client().GetLatestBlockNumber(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if blockNum != 436 {
+		t.Errorf("Expected block 436, got %d", blockNum)
+	}
+}
+
+func TestGetBlockByNumber_BatchesCodeLookups(t *testing.T) {
+	lookupCode := codeHandler("0xcontract")
+	node := newTestNode(t, func(request RpcRequest) RpcResponse {
+		if request.Method == "eth_getCode" {
+			return lookupCode(request)
+		}
+		if request.Method == "eth_getBlockReceipts" {
+			return RpcResponse{Result: []map[string]interface{}{
+				{"transactionHash": "0x1", "status": "0x1", "gasUsed": "0x5208", "effectiveGasPrice": "0x3b9aca00",
+					"logs": []map[string]interface{}{transferLog("0xblock", "0x1", "0xa", "0xb", 5)}},
+				{"transactionHash": "0x2", "status": "0x0", "gasUsed": "0x5208", "effectiveGasPrice": "0x3b9aca00"},
+				{"transactionHash": "0x3", "status": "0x1", "gasUsed": "0x5208", "effectiveGasPrice": "0x3b9aca00"},
+				{"transactionHash": "0x4", "status": "0x1", "gasUsed": "0x5208", "effectiveGasPrice": "0x3b9aca00", "contractAddress": "0xNew"},
+			}}
+		}
+		return RpcResponse{Result: map[string]interface{}{
+			"number":     "0x64",
+			"hash":       "0xblock",
+			"parentHash": "0xparent",
+			"transactions": []map[string]interface{}{
+				{"hash": "0x1", "from": "0xa", "to": "0xcontract", "value": "0x0"},
+				{"hash": "0x2", "from": "0xa", "to": "0xwallet", "value": "0x1"},
+				{"hash": "0x3", "from": "0xb", "to": "0xcontract", "value": "0x0"},
+				{"hash": "0x4", "from": "0xb", "value": "0x0"},
+			},
+		}}
+	})
+
+	block, err := node.client().GetBlockByNumber(context.Background(), 100)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expectedTypes := []string{smartContractExecutionType, regularTransactionType, smartContractExecutionType, smartContractDeploymentType}
+	for i, tx := range block.Transactions {
+		if tx.Type != expectedTypes[i] {
+			t.Errorf("Expected %s to be %s, got %s", tx.Hash, expectedTypes[i], tx.Type)
+		}
+	}
+	if block.Hash != "0xblock" || block.ParentHash != "0xparent" {
+		t.Errorf("Expected block hashes to be set, got %+v", block)
+	}
+	if tx := block.Transactions[1]; tx.Status != storage.TxStatusReverted || tx.Fee.String() != "21000000000000" {
+		t.Errorf("Expected the receipt of 0x2 to be applied, got %+v", tx)
+	}
+	if tx := block.Transactions[3]; tx.Status != storage.TxStatusSuccess || tx.ContractAddress != "0xnew" {
+		t.Errorf("Expected the created contract of 0x4 to be set, got %+v", tx)
+	}
+	if len(block.TokenTransfers) != 1 || block.TokenTransfers[0].TxHash != "0x1" {
+		t.Errorf("Expected the token transfer logged in the receipt of 0x1, got %+v", block.TokenTransfers)
+	}
+
+	// one request for the block, one for the receipts and their logs and one
+	// batch for the two distinct recipients
+	if node.requests() != 3 {
+		t.Errorf("Expected 3 HTTP requests, got %d", node.requests())
+	}
+}
+
+func TestGetBlocksByNumber(t *testing.T) {
+	node := newTestNode(t, func(request RpcRequest) RpcResponse {
+		if request.Method == "eth_getCode" {
+			return RpcResponse{Result: "0x"}
+		}
+		if request.Method == "eth_getBlockReceipts" {
+			return RpcResponse{Error: &RpcError{Code: rpcCodeMethodNotFound, Message: "the method eth_getBlockReceipts does not exist"}}
+		}
+		if request.Method == "eth_getTransactionReceipt" {
+			return RpcResponse{Result: map[string]interface{}{"transactionHash": "0x1", "status": "0x1", "gasUsed": "0x5208", "effectiveGasPrice": "0x1",
+				"logs": []map[string]interface{}{transferLog("0xb1", "0x1", "0xa", "0xb", 5)}}}
+		}
+		switch request.Params[0] {
+		case "0x1":
+			return RpcResponse{Result: map[string]interface{}{
+				"hash":         "0xb1",
+				"transactions": []map[string]interface{}{{"hash": "0x1", "from": "0xa", "to": "0xb"}},
+			}}
+		case "0x2":
+			return RpcResponse{Error: &RpcError{Code: -32000, Message: "header not found"}}
+		}
+		return RpcResponse{Result: nil}
+	})
+	node.reverseBatches = true
+
+	c := node.client()
+	blocks, err := c.GetBlocksByNumber(context.Background(), []int{1, 2, 3})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(blocks) != 1 {
+		t.Fatalf("Expected only block 1 to be returned, got %+v", blocks)
+	}
+	if blocks[1].Hash != "0xb1" || len(blocks[1].Transactions) != 1 || blocks[1].Transactions[0].BlockNum != 1 {
+		t.Errorf("Unexpected block 1: %+v", blocks[1])
+	}
+	if len(blocks[1].TokenTransfers) != 1 || blocks[1].TokenTransfers[0].BlockNum != 1 {
+		t.Errorf("Expected the token transfer of block 1, got %+v", blocks[1].TokenTransfers)
+	}
+	if tx := blocks[1].Transactions[0]; tx.Status != storage.TxStatusSuccess || tx.Fee.String() != "21000" {
+		t.Errorf("Expected the receipt fetched per transaction to be applied, got %+v", tx)
+	}
+	// the blocks, the code lookups, the block receipts and the receipts per
+	// transaction once eth_getBlockReceipts was rejected
+	if node.requests() != 4 {
+		t.Errorf("Expected 4 HTTP requests, got %d", node.requests())
+	}
+	if !c.blockReceiptsUnsupported.Load() {
+		t.Errorf("Expected eth_getBlockReceipts to be marked unsupported")
+	}
+}
+
+func TestParseTransaction_DecodesEnvelope(t *testing.T) {
+	tests := []struct {
+		name     string
+		raw      string
+		expected storage.Transaction
+	}{
+		{
+			name: "legacy transaction without type",
+			raw:  `{"hash":"0x1","from":"0xa","to":"0xb","value":"0x0","nonce":"0x7","input":"0x","gas":"0x5208","gasPrice":"0x3b9aca00"}`,
+			expected: storage.Transaction{
+				Hash: "0x1", From: "0xa", To: "0xb", Value: quantity("0x0"), Type: regularTransactionType,
+				TxType: storage.TxTypeLegacy, Nonce: quantity("0x7"), Input: "0x", Gas: quantity("0x5208"), GasPrice: quantity("0x3b9aca00"),
+			},
+		},
+		{
+			name: "dynamic fee transaction with access list",
+			raw: `{"hash":"0x2","from":"0xa","to":"0xb","value":"0x0","type":"0x2","chainId":"0x1","nonce":"0x0","input":"0xa9059cbb","gas":"0xea60",` +
+				`"gasPrice":"0x3b9aca00","maxFeePerGas":"0x77359400","maxPriorityFeePerGas":"0x3b9aca00",` +
+				`"accessList":[{"address":"0xb","storageKeys":["0x01"]}]}`,
+			expected: storage.Transaction{
+				Hash: "0x2", From: "0xa", To: "0xb", Value: quantity("0x0"), Type: regularTransactionType,
+				TxType: storage.TxTypeDynamicFee, ChainID: quantity("0x1"), Nonce: quantity("0x0"), Input: "0xa9059cbb", Gas: quantity("0xea60"),
+				GasPrice: quantity("0x3b9aca00"), MaxFeePerGas: quantity("0x77359400"), MaxPriorityFeePerGas: quantity("0x3b9aca00"),
+				AccessList: []storage.AccessTuple{{Address: "0xb", StorageKeys: []string{"0x01"}}},
+			},
+		},
+		{
+			name: "blob transaction",
+			raw: `{"hash":"0x3","from":"0xa","to":"0xb","value":"0x0","type":"0x3","chainId":"0x1","nonce":"0x1","input":"0x","gas":"0x5208",` +
+				`"maxFeePerGas":"0x77359400","maxPriorityFeePerGas":"0x1","maxFeePerBlobGas":"0x2","accessList":[],` +
+				`"blobVersionedHashes":["0x01aa"]}`,
+			expected: storage.Transaction{
+				Hash: "0x3", From: "0xa", To: "0xb", Value: quantity("0x0"), Type: regularTransactionType,
+				TxType: storage.TxTypeBlob, ChainID: quantity("0x1"), Nonce: quantity("0x1"), Input: "0x", Gas: quantity("0x5208"),
+				MaxFeePerGas: quantity("0x77359400"), MaxPriorityFeePerGas: quantity("0x1"), MaxFeePerBlobGas: quantity("0x2"),
+				AccessList: []storage.AccessTuple{}, BlobVersionedHashes: []string{"0x01aa"},
+			},
+		},
+		{
+			name: "set code transaction",
+			raw: `{"hash":"0x4","from":"0xa","to":"0xa","value":"0x0","type":"0x4","chainId":"0x1","nonce":"0x2","input":"0x","gas":"0x186a0",` +
+				`"authorizationList":[{"chainId":"0x1","address":"0xc","nonce":"0x3","yParity":"0x0","r":"0x1","s":"0x2"}]}`,
+			expected: storage.Transaction{
+				Hash: "0x4", From: "0xa", To: "0xa", Value: quantity("0x0"), Type: regularTransactionType,
+				TxType: storage.TxTypeSetCode, ChainID: quantity("0x1"), Nonce: quantity("0x2"), Input: "0x", Gas: quantity("0x186a0"),
+				AuthorizationList: []storage.Authorization{{ChainID: quantity("0x1"), Address: "0xc", Nonce: quantity("0x3")}},
+			},
+		},
+		{
+			name: "unknown type",
+			raw:  `{"hash":"0x5","from":"0xa","to":"0xb","value":"0x0","type":"0x7e","nonce":"0x0","input":"0x","gas":"0x0"}`,
+			expected: storage.Transaction{
+				Hash: "0x5", From: "0xa", To: "0xb", Value: quantity("0x0"), Type: regularTransactionType,
+				TxType: "0x7e", Nonce: quantity("0x0"), Input: "0x", Gas: quantity("0x0"),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var txDetail TransactionDetail
+			if err := json.Unmarshal([]byte(tt.raw), &txDetail); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			tx := parseTransaction(txDetail, 0, map[string]bool{})
+			if !reflect.DeepEqual(tx, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, tx)
+			}
+		})
+	}
+}
+
+func TestSendBatch_CorrelatesResponses(t *testing.T) {
+	node := newTestNode(t, codeHandler("0xc2"))
+	node.reverseBatches = true
+	c := node.client()
+
+	contracts, err := c.areSmartContracts(context.Background(), []string{"0xc1", "0xc2", "0xc3"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if contracts["0xc1"] || !contracts["0xc2"] || contracts["0xc3"] {
+		t.Errorf("Expected only 0xc2 to be a contract, got %v", contracts)
+	}
+}
+
+func TestSendBatch_SplitsLargeBatches(t *testing.T) {
+	node := newTestNode(t, codeHandler())
+
+	addresses := make([]string, MaxBatchSize+1)
+	for i := range addresses {
+		addresses[i] = "0x" + strings.Repeat("a", i+1)
+	}
+
+	contracts, err := node.client().areSmartContracts(context.Background(), addresses)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(contracts) != len(addresses) {
+		t.Errorf("Expected %d results, got %d", len(addresses), len(contracts))
+	}
+	if node.requests() != 2 {
+		t.Errorf("Expected 2 HTTP requests, got %d", node.requests())
+	}
+}
+
+func TestSendBatch_FallsBackWhenRejected(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(node *testNode)
+	}{
+		{"HTTPStatus", func(node *testNode) { node.rejectBatchStatus = http.StatusBadRequest }},
+		{"ErrorObject", func(node *testNode) { node.rejectBatchWithError = true }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := newTestNode(t, codeHandler("0xc1"))
+			tt.configure(node)
+			c := node.client()
+
+			contracts, err := c.areSmartContracts(context.Background(), []string{"0xc1", "0xc2"})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !contracts["0xc1"] || contracts["0xc2"] {
+				t.Errorf("Expected only 0xc1 to be a contract, got %v", contracts)
+			}
+			if !c.batchUnsupported.Load() {
+				t.Errorf("Expected batches to be disabled")
+			}
+
+			// the rejected batch and the two single requests
+			if node.requests() != 3 {
+				t.Errorf("Expected 3 HTTP requests, got %d", node.requests())
+			}
+		})
+	}
+}
+
+func TestSendBatch_DoesNotFallBackWhenRateLimited(t *testing.T) {
+	node := newTestNode(t, codeHandler())
+	node.rejectBatchStatus = http.StatusTooManyRequests
+	c := node.client()
+
+	if _, err := c.areSmartContracts(context.Background(), []string{"0xc1", "0xc2"}); err == nil {
+		t.Errorf("Expected an error")
+	}
+	if c.batchUnsupported.Load() {
+		t.Errorf("Expected batches to stay enabled")
+	}
+}
+
+func TestAreSmartContracts_UsesCache(t *testing.T) {
+	node := newTestNode(t, codeHandler("0xc1"))
+	c := node.client()
+
+	for i := 0; i < 2; i++ {
+		contracts, err := c.areSmartContracts(context.Background(), []string{"0xc1", "0xc2"})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if !contracts["0xc1"] || contracts["0xc2"] {
+			t.Errorf("Expected only 0xc1 to be a contract, got %v", contracts)
+		}
+	}
+
+	if node.requests() != 1 {
+		t.Errorf("Expected the second lookup to be served from the cache, got %d HTTP requests", node.requests())
+	}
+	if stats := c.CodeCacheStats(); stats.Hits != 2 || stats.Misses != 2 || stats.Size != 2 {
+		t.Errorf("Unexpected cache stats: %+v", stats)
+	}
+}
+
+func TestAreSmartContracts_DelegatedEOA(t *testing.T) {
+	node := newTestNode(t, func(request RpcRequest) RpcResponse {
+		if request.Params[0].(string) == "0xd1" {
+			return RpcResponse{Result: "0xef010000000000000000000000000000000000000000c1"}
+		}
+		return codeHandler("0xc1")(request)
+	})
+
+	contracts, err := node.client().areSmartContracts(context.Background(), []string{"0xc1", "0xd1"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !contracts["0xc1"] || contracts["0xd1"] {
+		t.Errorf("Expected the delegated 0xd1 to be an EOA, got %v", contracts)
+	}
+}
+
+func TestPost_FailsOverToNextEndpoint(t *testing.T) {
+	down := newTestNode(t, codeHandler())
+	down.server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limited", http.StatusTooManyRequests)
+	})
+	up := newTestNode(t, func(request RpcRequest) RpcResponse {
+		return RpcResponse{Result: "0x1b4"}
+	})
+	c := NewEthClient(WithEndpoints(down.server.URL, up.server.URL))
+
+	blockNumber, err := c.GetLatestBlockNumber(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if blockNumber != 436 {
+		t.Errorf("Expected block 436, got %d", blockNumber)
+	}
+
+	health := c.EndpointHealth()
+	if health[0].Healthy || !health[1].Healthy {
+		t.Errorf("Expected only the rate limited endpoint to be unhealthy, got %+v", health)
+	}
+}
+
+func TestSendRequest_RetriesTransientErrors(t *testing.T) {
+	node := newTestNode(t, func(request RpcRequest) RpcResponse {
+		return RpcResponse{Result: "0x1b4"}
+	})
+	node.failures = 2
+	node.failStatus = http.StatusServiceUnavailable
+
+	blockNum, err := node.client().GetLatestBlockNumber(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if blockNum != 436 || node.requests() != 3 {
+		t.Errorf("Expected block 436 after 3 requests, got %d after %d", blockNum, node.requests())
+	}
+}
+
+func TestSendRequest_DoesNotRetryPermanentErrors(t *testing.T) {
+	node := newTestNode(t, func(request RpcRequest) RpcResponse {
+		return RpcResponse{Error: &RpcError{Code: -32602, Message: "invalid params"}}
+	})
+
+	if _, err := node.client().GetLatestBlockNumber(context.Background()); err == nil {
+		t.Errorf("Expected an error")
+	}
+	if node.requests() != 1 {
+		t.Errorf("Expected a single request, got %d", node.requests())
+	}
+}
+
+func TestSendRequest_HonorsRetryAfter(t *testing.T) {
+	node := newTestNode(t, func(request RpcRequest) RpcResponse {
+		return RpcResponse{Result: "0x1b4"}
+	})
+	node.failures = 1
+	node.failStatus = http.StatusTooManyRequests
+	node.retryAfter = "1"
+
+	start := time.Now()
+	if _, err := node.client().GetLatestBlockNumber(context.Background()); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Expected to wait for Retry-After, retried after %v", elapsed)
+	}
+}
+
+func TestSendRequest_StopsRetryingWhenContextIsDone(t *testing.T) {
+	node := newTestNode(t, codeHandler())
+	node.failures = 100
+	node.failStatus = http.StatusServiceUnavailable
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewEthClient(WithEndpoints(node.server.URL), WithRetry(10, time.Hour, time.Hour))
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := c.GetLatestBlockNumber(ctx); err == nil {
+		t.Errorf("Expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected retries to stop on cancel, took %v", elapsed)
+	}
+	if node.requests() != 1 {
+		t.Errorf("Expected a single request, got %d", node.requests())
+	}
+}
+
+func TestGetLatestBlockNumber_AppliesRequestTimeout(t *testing.T) {
+	node := newTestNode(t, codeHandler())
+	node.failures = 100
+	node.failStatus = http.StatusServiceUnavailable
+
+	c := NewEthClient(WithEndpoints(node.server.URL), WithRetry(10, time.Hour, time.Hour), WithRequestTimeout(50*time.Millisecond))
+
+	start := time.Now()
+	if _, err := c.GetLatestBlockNumber(context.Background()); err == nil {
+		t.Errorf("Expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the call to stop at its deadline, took %v", elapsed)
+	}
+}
+
+func TestPost_AbortsInFlightRequestWhenContextIsDone(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	c := NewEthClient(WithEndpoints(server.URL), WithHTTPClient(&http.Client{}))
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := c.GetLatestBlockNumber(ctx); err == nil {
+		t.Errorf("Expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the request to be aborted on cancel, took %v", elapsed)
+	}
+}
@@ -0,0 +1,145 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// delay before the first reconnection, doubled after every failed one
+	minReconnectBackoff = time.Second
+	maxReconnectBackoff = time.Minute
+	// a new head is expected every 12 seconds, a silent connection is
+	// considered dead after this long
+	headTimeout = time.Minute
+)
+
+// HeadSubscriber keeps a newHeads subscription open on a node's WebSocket
+// endpoint and reports the number of every new chain head.
+type HeadSubscriber struct {
+	url       string
+	dialer    *websocket.Dialer
+	connected atomic.Bool
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type subscriptionMessage struct {
+	Method string `json:"method"`
+	Params struct {
+		Subscription string `json:"subscription"`
+		Result       struct {
+			Number string `json:"number"`
+		} `json:"result"`
+	} `json:"params"`
+}
+
+func NewHeadSubscriber(url string) *HeadSubscriber {
+	return &HeadSubscriber{
+		url:        url,
+		dialer:     websocket.DefaultDialer,
+		minBackoff: minReconnectBackoff,
+		maxBackoff: maxReconnectBackoff,
+	}
+}
+
+// Connected reports whether the subscription is currently open.
+func (s *HeadSubscriber) Connected() bool {
+	return s.connected.Load()
+}
+
+// Run sends the number of every new head to heads until the context is done,
+// reconnecting with an exponential backoff whenever the connection is lost.
+// A head is dropped when the previous one was not received yet, since
+// processing one head catches up to the latest block anyway.
+func (s *HeadSubscriber) Run(ctx context.Context, heads chan<- int) {
+	backoff := s.minBackoff
+	for {
+		subscribed, err := s.subscribe(ctx, heads)
+		if ctx.Err() != nil {
+			return
+		}
+		if subscribed {
+			backoff = s.minBackoff
+		}
+		log.Printf("Head subscription lost, reconnecting in %v: %v\n", backoff, err)
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		backoff = min(backoff*2, s.maxBackoff)
+	}
+}
+
+// subscribe reads heads from a single connection until it fails. It reports
+// whether the subscription was set up before the failure.
+func (s *HeadSubscriber) subscribe(ctx context.Context, heads chan<- int) (bool, error) {
+	conn, _, err := s.dialer.DialContext(ctx, s.url, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to connect: %v", err)
+	}
+	defer conn.Close()
+	// closing the connection unblocks the pending read on shutdown
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	if err := conn.WriteJSON(RpcRequest{
+		Jsonrpc: "2.0",
+		Method:  "eth_subscribe",
+		Params:  []interface{}{"newHeads"},
+		ID:      1,
+	}); err != nil {
+		return false, fmt.Errorf("failed to subscribe: %v", err)
+	}
+
+	_ = conn.SetReadDeadline(time.Now().Add(headTimeout))
+	var response RpcResponse
+	if err := conn.ReadJSON(&response); err != nil {
+		return false, fmt.Errorf("failed to read subscription response: %v", err)
+	}
+	if response.Error != nil {
+		return false, response.Error
+	}
+	subscriptionID, ok := response.Result.(string)
+	if !ok {
+		return false, fmt.Errorf("unexpected subscription response: %v", response.Result)
+	}
+
+	log.Printf("Subscribed to new heads on %s\n", s.url)
+	s.connected.Store(true)
+	defer s.connected.Store(false)
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(headTimeout))
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return true, fmt.Errorf("failed to read head: %v", err)
+		}
+
+		var message subscriptionMessage
+		if err := json.Unmarshal(data, &message); err != nil || message.Method != "eth_subscription" || message.Params.Subscription != subscriptionID {
+			continue
+		}
+		head, err := parseBlockNumber(message.Params.Result.Number)
+		if err != nil {
+			log.Printf("Ignoring head: %v\n", err)
+			continue
+		}
+
+		select {
+		case heads <- head:
+		default:
+		}
+	}
+}
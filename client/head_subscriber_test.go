@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newHeadsNode is a fake node answering eth_subscribe and sending the given
+// heads after a notification for another subscription.
+func newHeadsNode(t *testing.T, heads ...int) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var request RpcRequest
+		if err := conn.ReadJSON(&request); err != nil || request.Method != "eth_subscribe" {
+			return
+		}
+		_ = conn.WriteJSON(RpcResponse{Jsonrpc: "2.0", ID: request.ID, Result: "0xsub"})
+		_ = conn.WriteJSON(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"method":  "eth_subscription",
+			"params":  map[string]interface{}{"subscription": "0xother", "result": map[string]string{"number": "0x1"}},
+		})
+		for _, head := range heads {
+			_ = conn.WriteJSON(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  "eth_subscription",
+				"params":  map[string]interface{}{"subscription": "0xsub", "result": map[string]string{"number": fmt.Sprintf("0x%x", head)}},
+			})
+		}
+		// wait for the client to go away
+		_, _, _ = conn.ReadMessage()
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestHeadSubscriber_ReportsHeads(t *testing.T) {
+	server := newHeadsNode(t, 100, 101)
+	subscriber := NewHeadSubscriber("ws" + strings.TrimPrefix(server.URL, "http"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// heads are dropped while the previous one is not received
+	heads := make(chan int, 2)
+	go subscriber.Run(ctx, heads)
+
+	for _, expected := range []int{100, 101} {
+		select {
+		case head := <-heads:
+			if head != expected {
+				t.Errorf("Expected head %d, got %d", expected, head)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timed out waiting for head %d", expected)
+		}
+	}
+	if !subscriber.Connected() {
+		t.Errorf("Expected the subscriber to be connected")
+	}
+}
+
+func TestHeadSubscriber_Reconnects(t *testing.T) {
+	var connections atomic.Int32
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		// drop every connection right away
+		connections.Add(1)
+		conn.Close()
+	}))
+	t.Cleanup(server.Close)
+
+	subscriber := NewHeadSubscriber("ws" + strings.TrimPrefix(server.URL, "http"))
+	subscriber.minBackoff = time.Millisecond
+	subscriber.maxBackoff = 5 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		subscriber.Run(ctx, make(chan int))
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for connections.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if connections.Load() < 3 {
+		t.Errorf("Expected the subscriber to reconnect, got %d connections", connections.Load())
+	}
+	if subscriber.Connected() {
+		t.Errorf("Expected the subscriber to be disconnected")
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected Run to return on cancel")
+	}
+}
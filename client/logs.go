@@ -0,0 +1,70 @@
+package client
+
+import (
+	"strings"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+const (
+	// keccak256("Transfer(address,address,uint256)"), emitted by ERC-20 and ERC-721 tokens
+	transferEventTopic = "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+	// keccak256("TransferSingle(address,address,address,uint256,uint256)"), emitted by ERC-1155 tokens
+	transferSingleEventTopic = "0xc3d58168c5ae7397731d063d5bbf3d657854427343f4c083240f7aacaa2d0f62"
+	// keccak256("TransferBatch(address,address,address,uint256[],uint256[])"), emitted by ERC-1155 tokens
+	transferBatchEventTopic = "0x4a39dc06d4c0dbc64b70af90fd698a233a518aa5d07e595d983b8c0526c8f7fb"
+
+	// hex digits of a 32 byte ABI word
+	wordLength = 64
+)
+
+type LogEntry struct {
+	Address         string   `json:"address"`
+	Topics          []string `json:"topics"`
+	Data            string   `json:"data"`
+	BlockHash       string   `json:"blockHash"`
+	TransactionHash string   `json:"transactionHash"`
+	LogIndex        string   `json:"logIndex"`
+	// set when the log was dropped by a reorg
+	Removed bool `json:"removed"`
+}
+
+// topicToAddress extracts the address left padded into a 32 byte topic.
+func topicToAddress(topic string) (storage.Address, bool) {
+	if len(topic) != 66 || !strings.HasPrefix(topic, "0x") {
+		return "", false
+	}
+	return storage.NormalizeAddress("0x" + topic[26:]), true
+}
+
+// wordToQuantity reads a 32 byte ABI word holding an unsigned integer.
+func wordToQuantity(data string) (storage.Quantity, bool) {
+	if len(data) != 2+wordLength || !strings.HasPrefix(data, "0x") {
+		return storage.Quantity{}, false
+	}
+	quantity, err := storage.ParseQuantity(data)
+	return quantity, err == nil
+}
+
+// dataWords splits ABI encoded data into its 32 byte words, each prefixed
+// with 0x.
+func dataWords(data string) ([]string, bool) {
+	if !strings.HasPrefix(data, "0x") || (len(data)-2)%wordLength != 0 {
+		return nil, false
+	}
+	words := make([]string, 0, (len(data)-2)/wordLength)
+	for start := 2; start < len(data); start += wordLength {
+		words = append(words, "0x"+data[start:start+wordLength])
+	}
+	return words, true
+}
+
+// wordToInt reads a word holding a small number, such as an array offset or
+// length.
+func wordToInt(word string) (int, bool) {
+	quantity, ok := wordToQuantity(word)
+	if !ok || quantity.Int().BitLen() > 60 {
+		return 0, false
+	}
+	return int(quantity.Int().Int64()), true
+}
@@ -5,6 +5,7 @@
 package client
 
 import (
+	context "context"
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
@@ -34,31 +35,61 @@ func (m *MockClient) EXPECT() *MockClientMockRecorder {
 }
 
 // GetBlockByNumber mocks base method.
-func (m *MockClient) GetBlockByNumber(arg0 int) (Block, error) {
+func (m *MockClient) GetBlockByNumber(arg0 context.Context, arg1 int) (Block, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetBlockByNumber", arg0)
+	ret := m.ctrl.Call(m, "GetBlockByNumber", arg0, arg1)
 	ret0, _ := ret[0].(Block)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetBlockByNumber indicates an expected call of GetBlockByNumber.
-func (mr *MockClientMockRecorder) GetBlockByNumber(arg0 interface{}) *gomock.Call {
+func (mr *MockClientMockRecorder) GetBlockByNumber(arg0, arg1 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlockByNumber", reflect.TypeOf((*MockClient)(nil).GetBlockByNumber), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlockByNumber", reflect.TypeOf((*MockClient)(nil).GetBlockByNumber), arg0, arg1)
+}
+
+// GetBlockNumberByTag mocks base method.
+func (m *MockClient) GetBlockNumberByTag(arg0 context.Context, arg1 string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBlockNumberByTag", arg0, arg1)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBlockNumberByTag indicates an expected call of GetBlockNumberByTag.
+func (mr *MockClientMockRecorder) GetBlockNumberByTag(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlockNumberByTag", reflect.TypeOf((*MockClient)(nil).GetBlockNumberByTag), arg0, arg1)
+}
+
+// GetBlocksByNumber mocks base method.
+func (m *MockClient) GetBlocksByNumber(arg0 context.Context, arg1 []int) (map[int]Block, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBlocksByNumber", arg0, arg1)
+	ret0, _ := ret[0].(map[int]Block)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBlocksByNumber indicates an expected call of GetBlocksByNumber.
+func (mr *MockClientMockRecorder) GetBlocksByNumber(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBlocksByNumber", reflect.TypeOf((*MockClient)(nil).GetBlocksByNumber), arg0, arg1)
 }
 
 // GetLatestBlockNumber mocks base method.
-func (m *MockClient) GetLatestBlockNumber() (int, error) {
+func (m *MockClient) GetLatestBlockNumber(arg0 context.Context) (int, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "GetLatestBlockNumber")
+	ret := m.ctrl.Call(m, "GetLatestBlockNumber", arg0)
 	ret0, _ := ret[0].(int)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
 
 // GetLatestBlockNumber indicates an expected call of GetLatestBlockNumber.
-func (mr *MockClientMockRecorder) GetLatestBlockNumber() *gomock.Call {
+func (mr *MockClientMockRecorder) GetLatestBlockNumber(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLatestBlockNumber", reflect.TypeOf((*MockClient)(nil).GetLatestBlockNumber))
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLatestBlockNumber", reflect.TypeOf((*MockClient)(nil).GetLatestBlockNumber), arg0)
 }
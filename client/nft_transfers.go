@@ -0,0 +1,140 @@
+package client
+
+import (
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+func decodeNftTransfers(logs []LogEntry, blockNum int) []storage.NftTransfer {
+	transfers := []storage.NftTransfer{}
+	for _, entry := range logs {
+		if entry.Removed || len(entry.Topics) == 0 {
+			continue
+		}
+		var decoded []storage.NftTransfer
+		var ok bool
+		switch entry.Topics[0] {
+		case transferEventTopic:
+			decoded, ok = decodeErc721Transfer(entry, blockNum)
+		case transferSingleEventTopic:
+			decoded, ok = decodeTransferSingle(entry, blockNum)
+		case transferBatchEventTopic:
+			decoded, ok = decodeTransferBatch(entry, blockNum)
+		}
+		if ok {
+			transfers = append(transfers, decoded...)
+		}
+	}
+	return transfers
+}
+
+// decodeErc721Transfer decodes a Transfer log with the token ID as a fourth
+// topic, which tells it apart from an ERC-20 Transfer.
+func decodeErc721Transfer(entry LogEntry, blockNum int) ([]storage.NftTransfer, bool) {
+	if len(entry.Topics) != 4 {
+		return nil, false
+	}
+
+	from, fromOk := topicToAddress(entry.Topics[1])
+	to, toOk := topicToAddress(entry.Topics[2])
+	tokenID, tokenOk := wordToQuantity(entry.Topics[3])
+	if !fromOk || !toOk || !tokenOk {
+		return nil, false
+	}
+
+	transfer, ok := newNftTransfer(entry, blockNum, storage.StandardErc721, from, to)
+	transfer.TokenID = tokenID
+	transfer.Amount = storage.NewQuantityFromUint64(1)
+	return []storage.NftTransfer{transfer}, ok
+}
+
+// decodeTransferSingle decodes TransferSingle(operator, from, to, id, value),
+// with the operator, from and to indexed.
+func decodeTransferSingle(entry LogEntry, blockNum int) ([]storage.NftTransfer, bool) {
+	words, ok := dataWords(entry.Data)
+	if !ok || len(entry.Topics) != 4 || len(words) != 2 {
+		return nil, false
+	}
+
+	from, fromOk := topicToAddress(entry.Topics[2])
+	to, toOk := topicToAddress(entry.Topics[3])
+	tokenID, tokenOk := wordToQuantity(words[0])
+	amount, amountOk := wordToQuantity(words[1])
+	if !fromOk || !toOk || !tokenOk || !amountOk {
+		return nil, false
+	}
+
+	transfer, ok := newNftTransfer(entry, blockNum, storage.StandardErc1155, from, to)
+	transfer.TokenID = tokenID
+	transfer.Amount = amount
+	return []storage.NftTransfer{transfer}, ok
+}
+
+// decodeTransferBatch decodes TransferBatch(operator, from, to, ids, values)
+// into one transfer per token. The data holds the offsets of the ids and
+// values arrays followed by the arrays themselves.
+func decodeTransferBatch(entry LogEntry, blockNum int) ([]storage.NftTransfer, bool) {
+	words, ok := dataWords(entry.Data)
+	if !ok || len(entry.Topics) != 4 || len(words) < 2 {
+		return nil, false
+	}
+
+	from, fromOk := topicToAddress(entry.Topics[2])
+	to, toOk := topicToAddress(entry.Topics[3])
+	tokenIDs, idsOk := decodeArray(words, words[0])
+	amounts, amountsOk := decodeArray(words, words[1])
+	if !fromOk || !toOk || !idsOk || !amountsOk || len(tokenIDs) != len(amounts) {
+		return nil, false
+	}
+
+	transfers := make([]storage.NftTransfer, len(tokenIDs))
+	for i := range tokenIDs {
+		transfer, ok := newNftTransfer(entry, blockNum, storage.StandardErc1155, from, to)
+		if !ok {
+			return nil, false
+		}
+		transfer.BatchIndex = i
+		transfer.TokenID = tokenIDs[i]
+		transfer.Amount = amounts[i]
+		transfers[i] = transfer
+	}
+	return transfers, true
+}
+
+// decodeArray reads the uint256 array found at the byte offset held by
+// offsetWord.
+func decodeArray(words []string, offsetWord string) ([]storage.Quantity, bool) {
+	offset, ok := wordToInt(offsetWord)
+	if !ok || offset%32 != 0 || offset/32 >= len(words) {
+		return nil, false
+	}
+	start := offset / 32
+	length, ok := wordToInt(words[start])
+	if !ok || start+1+length > len(words) {
+		return nil, false
+	}
+
+	values := make([]storage.Quantity, length)
+	for i := range values {
+		if values[i], ok = wordToQuantity(words[start+1+i]); !ok {
+			return nil, false
+		}
+	}
+	return values, true
+}
+
+func newNftTransfer(entry LogEntry, blockNum int, standard string, from, to storage.Address) (storage.NftTransfer, bool) {
+	logIndex, err := parseBlockNumber(entry.LogIndex)
+	if err != nil {
+		return storage.NftTransfer{}, false
+	}
+	return storage.NftTransfer{
+		TxHash:    entry.TransactionHash,
+		LogIndex:  logIndex,
+		Contract:  storage.NormalizeAddress(entry.Address),
+		Standard:  standard,
+		From:      from,
+		To:        to,
+		BlockHash: entry.BlockHash,
+		BlockNum:  blockNum,
+	}, true
+}
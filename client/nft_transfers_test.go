@@ -0,0 +1,73 @@
+package client
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+func words(values ...int) string {
+	data := "0x"
+	for _, value := range values {
+		data += fmt.Sprintf("%064x", value)
+	}
+	return data
+}
+
+func TestDecodeNftTransfers(t *testing.T) {
+	operator := storage.Address("0x00000000000000000000000000000000000000cc")
+	from := storage.Address("0x00000000000000000000000000000000000000aa")
+	to := storage.Address("0x00000000000000000000000000000000000000bb")
+
+	logs := []LogEntry{
+		{
+			// ERC-20 transfer, not an NFT
+			Address:  "0xToken",
+			Topics:   []string{transferEventTopic, addressTopic(from), addressTopic(to)},
+			Data:     words(1000),
+			LogIndex: "0x0",
+		},
+		{
+			Address:         "0xNft",
+			Topics:          []string{transferEventTopic, addressTopic(from), addressTopic(to), fmt.Sprintf("0x%064x", 42)},
+			Data:            "0x",
+			TransactionHash: "0xtx1",
+			LogIndex:        "0x1",
+		},
+		{
+			Address:         "0xMulti",
+			Topics:          []string{transferSingleEventTopic, addressTopic(operator), addressTopic(from), addressTopic(to)},
+			Data:            words(7, 3),
+			TransactionHash: "0xtx2",
+			LogIndex:        "0x2",
+		},
+		{
+			// ids [1, 2] and values [10, 20], each array prefixed with its length
+			Address:         "0xMulti",
+			Topics:          []string{transferBatchEventTopic, addressTopic(operator), addressTopic(from), addressTopic(to)},
+			Data:            words(0x40, 0xa0, 2, 1, 2, 2, 10, 20),
+			TransactionHash: "0xtx3",
+			LogIndex:        "0x3",
+		},
+		{
+			// the values array is shorter than the ids array
+			Address:  "0xMulti",
+			Topics:   []string{transferBatchEventTopic, addressTopic(operator), addressTopic(from), addressTopic(to)},
+			Data:     words(0x40, 0xa0, 2, 1, 2, 1, 10),
+			LogIndex: "0x4",
+		},
+	}
+
+	expected := []storage.NftTransfer{
+		{TxHash: "0xtx1", LogIndex: 1, Contract: "0xnft", Standard: storage.StandardErc721, From: from, To: to, TokenID: quantity("0x2a"), Amount: quantity("0x1"), BlockNum: 5},
+		{TxHash: "0xtx2", LogIndex: 2, Contract: "0xmulti", Standard: storage.StandardErc1155, From: from, To: to, TokenID: quantity("0x7"), Amount: quantity("0x3"), BlockNum: 5},
+		{TxHash: "0xtx3", LogIndex: 3, BatchIndex: 0, Contract: "0xmulti", Standard: storage.StandardErc1155, From: from, To: to, TokenID: quantity("0x1"), Amount: quantity("0xa"), BlockNum: 5},
+		{TxHash: "0xtx3", LogIndex: 3, BatchIndex: 1, Contract: "0xmulti", Standard: storage.StandardErc1155, From: from, To: to, TokenID: quantity("0x2"), Amount: quantity("0x14"), BlockNum: 5},
+	}
+
+	if transfers := decodeNftTransfers(logs, 5); !reflect.DeepEqual(transfers, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, transfers)
+	}
+}
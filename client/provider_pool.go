@@ -0,0 +1,155 @@
+package client
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type Policy string
+
+const (
+	// always use the first healthy endpoint in the configured order
+	PolicyPriority Policy = "priority"
+	// spread the requests over all healthy endpoints
+	PolicyRoundRobin Policy = "round-robin"
+	// use the healthy endpoint with the lowest average latency
+	PolicyLowestLatency Policy = "lowest-latency"
+
+	// failures in a row after which an endpoint is considered unhealthy
+	maxConsecutiveFailures = 3
+	// how long an unhealthy endpoint is only used as a last resort
+	unhealthyCooldown = 30 * time.Second
+	// weight of the latest measurement in the average latency
+	latencySmoothing = 0.2
+)
+
+func ParsePolicy(policy string) (Policy, error) {
+	switch Policy(policy) {
+	case PolicyPriority, PolicyRoundRobin, PolicyLowestLatency:
+		return Policy(policy), nil
+	}
+	return "", fmt.Errorf("unknown RPC policy %q", policy)
+}
+
+type EndpointHealth struct {
+	URL                 string
+	Healthy             bool
+	ConsecutiveFailures int
+	LastError           string
+	LastChecked         time.Time
+	// moving average of the response time
+	Latency  time.Duration
+	Requests uint64
+	Failures uint64
+}
+
+type endpoint struct {
+	health         EndpointHealth
+	unhealthyUntil time.Time
+}
+
+// providerPool picks the RPC endpoint for every request according to its
+// policy and keeps track of the health of each endpoint. Unhealthy endpoints
+// are skipped until their cooldown passes, unless no healthy one is left.
+type providerPool struct {
+	mu        sync.Mutex
+	endpoints []*endpoint
+	policy    Policy
+	next      int
+	now       func() time.Time
+}
+
+func newProviderPool(urls []string, policy Policy) *providerPool {
+	pool := &providerPool{
+		policy: policy,
+		now:    time.Now,
+	}
+	for _, url := range urls {
+		pool.endpoints = append(pool.endpoints, &endpoint{
+			health: EndpointHealth{URL: url, Healthy: true},
+		})
+	}
+	return pool
+}
+
+// candidates returns the endpoints in the order they should be tried.
+func (p *providerPool) candidates() []*endpoint {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := p.now()
+	var healthy, unhealthy []*endpoint
+	for _, e := range p.endpoints {
+		if e.health.Healthy || !now.Before(e.unhealthyUntil) {
+			healthy = append(healthy, e)
+		} else {
+			unhealthy = append(unhealthy, e)
+		}
+	}
+
+	switch p.policy {
+	case PolicyRoundRobin:
+		if len(healthy) > 0 {
+			start := p.next % len(healthy)
+			p.next++
+			rotated := make([]*endpoint, 0, len(healthy))
+			rotated = append(rotated, healthy[start:]...)
+			healthy = append(rotated, healthy[:start]...)
+		}
+	case PolicyLowestLatency:
+		sort.SliceStable(healthy, func(i, j int) bool {
+			return healthy[i].health.Latency < healthy[j].health.Latency
+		})
+	}
+
+	sort.SliceStable(unhealthy, func(i, j int) bool {
+		return unhealthy[i].unhealthyUntil.Before(unhealthy[j].unhealthyUntil)
+	})
+
+	return append(healthy, unhealthy...)
+}
+
+func (p *providerPool) reportSuccess(e *endpoint, latency time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.health.Requests++
+	e.health.Healthy = true
+	e.health.ConsecutiveFailures = 0
+	e.health.LastChecked = p.now()
+	if e.health.Latency == 0 {
+		e.health.Latency = latency
+	} else {
+		e.health.Latency = time.Duration(latencySmoothing*float64(latency) + (1-latencySmoothing)*float64(e.health.Latency))
+	}
+}
+
+// reportFailure records a failed request. A rate limited endpoint is taken
+// out of rotation right away, any other endpoint after several failures.
+func (p *providerPool) reportFailure(e *endpoint, err error, rateLimited bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	e.health.Requests++
+	e.health.Failures++
+	e.health.ConsecutiveFailures++
+	e.health.LastError = err.Error()
+	e.health.LastChecked = p.now()
+	if rateLimited || e.health.ConsecutiveFailures >= maxConsecutiveFailures {
+		e.health.Healthy = false
+		e.unhealthyUntil = p.now().Add(unhealthyCooldown)
+	}
+}
+
+func (p *providerPool) health() []EndpointHealth {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	health := make([]EndpointHealth, len(p.endpoints))
+	for i, e := range p.endpoints {
+		health[i] = e.health
+	}
+	return health
+}
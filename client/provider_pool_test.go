@@ -0,0 +1,89 @@
+package client
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func candidateURLs(pool *providerPool) []string {
+	var urls []string
+	for _, e := range pool.candidates() {
+		urls = append(urls, e.health.URL)
+	}
+	return urls
+}
+
+func TestProviderPool_Policies(t *testing.T) {
+	tests := []struct {
+		name     string
+		policy   Policy
+		expected [][]string
+	}{
+		{"Priority", PolicyPriority, [][]string{{"a", "b", "c"}, {"a", "b", "c"}}},
+		{"RoundRobin", PolicyRoundRobin, [][]string{{"a", "b", "c"}, {"b", "c", "a"}, {"c", "a", "b"}}},
+		{"LowestLatency", PolicyLowestLatency, [][]string{{"c", "a", "b"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pool := newProviderPool([]string{"a", "b", "c"}, tt.policy)
+			pool.reportSuccess(pool.endpoints[0], 20*time.Millisecond)
+			pool.reportSuccess(pool.endpoints[1], 30*time.Millisecond)
+			pool.reportSuccess(pool.endpoints[2], 10*time.Millisecond)
+
+			for i, expected := range tt.expected {
+				urls := candidateURLs(pool)
+				if len(urls) != len(expected) {
+					t.Fatalf("Call %d: expected %v, got %v", i, expected, urls)
+				}
+				for j := range expected {
+					if urls[j] != expected[j] {
+						t.Errorf("Call %d: expected %v, got %v", i, expected, urls)
+						break
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestProviderPool_SkipsUnhealthyUntilCooldown(t *testing.T) {
+	now := time.Now()
+	pool := newProviderPool([]string{"a", "b"}, PolicyPriority)
+	pool.now = func() time.Time { return now }
+
+	rateLimited := &httpStatusError{StatusCode: http.StatusTooManyRequests, Status: "429 Too Many Requests"}
+	pool.reportFailure(pool.endpoints[0], rateLimited, true)
+
+	if urls := candidateURLs(pool); urls[0] != "b" || urls[1] != "a" {
+		t.Errorf("Expected the rate limited endpoint to be tried last, got %v", urls)
+	}
+
+	now = now.Add(unhealthyCooldown)
+	if urls := candidateURLs(pool); urls[0] != "a" {
+		t.Errorf("Expected the endpoint to be used again after its cooldown, got %v", urls)
+	}
+}
+
+func TestProviderPool_UnhealthyAfterConsecutiveFailures(t *testing.T) {
+	pool := newProviderPool([]string{"a"}, PolicyPriority)
+
+	for i := 0; i < maxConsecutiveFailures; i++ {
+		if !pool.health()[0].Healthy {
+			t.Fatalf("Expected the endpoint to be healthy after %d failures", i)
+		}
+		pool.reportFailure(pool.endpoints[0], errors.New("connection refused"), false)
+	}
+
+	health := pool.health()[0]
+	if health.Healthy || health.ConsecutiveFailures != maxConsecutiveFailures || health.LastError != "connection refused" {
+		t.Errorf("Unexpected health: %+v", health)
+	}
+
+	pool.reportSuccess(pool.endpoints[0], time.Millisecond)
+	if health := pool.health()[0]; !health.Healthy || health.ConsecutiveFailures != 0 {
+		t.Errorf("Expected the endpoint to recover, got %+v", health)
+	}
+}
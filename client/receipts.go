@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+// JSON-RPC error code of a method the node does not implement
+const rpcCodeMethodNotFound = -32601
+
+type ReceiptResponse struct {
+	TransactionHash   string `json:"transactionHash"`
+	Status            string `json:"status"`
+	GasUsed           string `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	ContractAddress   string `json:"contractAddress,omitempty"`
+	// only set for blob transactions
+	BlobGasUsed  string `json:"blobGasUsed,omitempty"`
+	BlobGasPrice string `json:"blobGasPrice,omitempty"`
+	// token and NFT transfers are decoded from them
+	Logs []LogEntry `json:"logs"`
+}
+
+// fetchReceipts fetches the receipts of every block with eth_getBlockReceipts
+// in one batch. The receipts of blocks the node could not return that way are
+// fetched transaction by transaction in a second batch. Blocks whose receipts
+// are still missing are left out of the result.
+func (c *EthClient) fetchReceipts(ctx context.Context, blocksData map[int]BlockResponse) (map[int]map[string]ReceiptResponse, error) {
+	receipts := make(map[int]map[string]ReceiptResponse, len(blocksData))
+	var fallback []int
+
+	if c.blockReceiptsUnsupported.Load() {
+		for blockNum := range blocksData {
+			fallback = append(fallback, blockNum)
+		}
+	} else {
+		blockNums := make([]int, 0, len(blocksData))
+		payloads := make([]RpcRequest, 0, len(blocksData))
+		for blockNum, blockData := range blocksData {
+			blockNums = append(blockNums, blockNum)
+			payloads = append(payloads, RpcRequest{
+				Jsonrpc: "2.0",
+				Method:  "eth_getBlockReceipts",
+				Params:  []interface{}{blockData.Hash},
+				ID:      c.nextID(),
+			})
+		}
+
+		responses, err := c.sendBatch(ctx, payloads)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, response := range responses {
+			var blockReceipts []ReceiptResponse
+			if response.Error != nil || response.Result == nil || mapToStruct(response.Result, &blockReceipts) != nil {
+				if response.Error != nil && response.Error.Code == rpcCodeMethodNotFound {
+					c.blockReceiptsUnsupported.Store(true)
+				}
+				fallback = append(fallback, blockNums[i])
+				continue
+			}
+			receipts[blockNums[i]] = receiptsByHash(blockReceipts)
+		}
+	}
+
+	if len(fallback) == 0 {
+		return receipts, nil
+	}
+
+	var payloads []RpcRequest
+	var payloadBlocks []int
+	for _, blockNum := range fallback {
+		receipts[blockNum] = make(map[string]ReceiptResponse)
+		for _, tx := range blocksData[blockNum].Transactions {
+			payloadBlocks = append(payloadBlocks, blockNum)
+			payloads = append(payloads, RpcRequest{
+				Jsonrpc: "2.0",
+				Method:  "eth_getTransactionReceipt",
+				Params:  []interface{}{tx.Hash},
+				ID:      c.nextID(),
+			})
+		}
+	}
+
+	responses, err := c.sendBatch(ctx, payloads)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, response := range responses {
+		blockNum := payloadBlocks[i]
+		if _, fetched := receipts[blockNum]; !fetched {
+			continue
+		}
+		var receipt ReceiptResponse
+		if response.Error != nil || response.Result == nil || mapToStruct(response.Result, &receipt) != nil {
+			delete(receipts, blockNum)
+			continue
+		}
+		receipts[blockNum][receipt.TransactionHash] = receipt
+	}
+	return receipts, nil
+}
+
+func receiptsByHash(blockReceipts []ReceiptResponse) map[string]ReceiptResponse {
+	byHash := make(map[string]ReceiptResponse, len(blockReceipts))
+	for _, receipt := range blockReceipts {
+		byHash[receipt.TransactionHash] = receipt
+	}
+	return byHash
+}
+
+// blockLogs gathers the logs of the receipts of a block in the order of its
+// transactions, which keeps them ordered by log index.
+func blockLogs(transactions []TransactionDetail, receipts map[string]ReceiptResponse) []LogEntry {
+	var logs []LogEntry
+	for _, tx := range transactions {
+		logs = append(logs, receipts[tx.Hash].Logs...)
+	}
+	return logs
+}
+
+// applyReceipt copies the outcome and the cost of the transaction from its
+// receipt.
+func applyReceipt(tx *storage.Transaction, receipt ReceiptResponse) {
+	switch receipt.Status {
+	case "0x1":
+		tx.Status = storage.TxStatusSuccess
+	case "0x0":
+		tx.Status = storage.TxStatusReverted
+	}
+	tx.GasUsed = toQuantity(receipt.GasUsed)
+	tx.EffectiveGasPrice = toQuantity(receipt.EffectiveGasPrice)
+	tx.ContractAddress = storage.NormalizeAddress(receipt.ContractAddress)
+	tx.Fee = transactionFee(receipt)
+}
+
+// transactionFee is the gas used times the effective gas price, plus the
+// blob gas for blob transactions.
+func transactionFee(receipt ReceiptResponse) storage.Quantity {
+	fee := new(big.Int)
+	gasUsed, gasOk := parseQuantity(receipt.GasUsed)
+	gasPrice, priceOk := parseQuantity(receipt.EffectiveGasPrice)
+	if !gasOk || !priceOk {
+		return storage.Quantity{}
+	}
+	fee.Mul(gasUsed, gasPrice)
+
+	if blobGasUsed, ok := parseQuantity(receipt.BlobGasUsed); ok {
+		if blobGasPrice, ok := parseQuantity(receipt.BlobGasPrice); ok {
+			fee.Add(fee, new(big.Int).Mul(blobGasUsed, blobGasPrice))
+		}
+	}
+	return storage.NewQuantity(fee)
+}
+
+// toQuantity converts a hex quantity sent by the node, a missing or malformed
+// quantity gives a missing Quantity.
+func toQuantity(quantity string) storage.Quantity {
+	value, ok := parseQuantity(quantity)
+	if !ok {
+		return storage.Quantity{}
+	}
+	return storage.NewQuantity(value)
+}
+
+func parseQuantity(quantity string) (*big.Int, bool) {
+	if len(quantity) < 3 || quantity[:2] != "0x" {
+		return nil, false
+	}
+	return new(big.Int).SetString(quantity[2:], 16)
+}
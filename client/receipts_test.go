@@ -0,0 +1,25 @@
+package client
+
+import "testing"
+
+func TestTransactionFee(t *testing.T) {
+	tests := []struct {
+		name     string
+		receipt  ReceiptResponse
+		expected string
+	}{
+		{"Regular", ReceiptResponse{GasUsed: "0x5208", EffectiveGasPrice: "0x3b9aca00"}, "21000000000000"},
+		{"Blob", ReceiptResponse{GasUsed: "0x5208", EffectiveGasPrice: "0x1", BlobGasUsed: "0x20000", BlobGasPrice: "0x2"}, "283144"},
+		// larger than 64 bits
+		{"Large", ReceiptResponse{GasUsed: "0x1000000", EffectiveGasPrice: "0x10000000000000000"}, "309485009821345068724781056"},
+		{"MissingGasPrice", ReceiptResponse{GasUsed: "0x5208"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if fee := transactionFee(tt.receipt).String(); fee != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, fee)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultMaxRetries is the number of retries after the first attempt
+	// before a request is given up.
+	DefaultMaxRetries = 4
+	// DefaultBaseBackoff is the delay before the first retry, doubled on
+	// every following one up to DefaultMaxBackoff.
+	DefaultBaseBackoff = 250 * time.Millisecond
+	DefaultMaxBackoff  = 10 * time.Second
+
+	// JSON-RPC error codes providers use for temporary conditions
+	rpcCodeInternalError = -32603
+	rpcCodeLimitExceeded = -32005
+)
+
+type retryConfig struct {
+	maxRetries  int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+// IsTransient reports whether a request that failed with err may succeed
+// when sent again. Transport failures, rate limiting, server errors and
+// RPC errors signalling overload are transient; rejected requests and a
+// cancelled context are not.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= http.StatusInternalServerError
+	}
+
+	var rpcErr *RpcError
+	if errors.As(err, &rpcErr) {
+		return rpcErr.Code == rpcCodeInternalError || rpcErr.Code == rpcCodeLimitExceeded
+	}
+
+	var urlErr *url.Error
+	return errors.As(err, &urlErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// withRetry calls send until it succeeds, fails with a permanent error, the
+// retries are used up or the context is done. The delay between attempts
+// grows exponentially with jitter and is at least the Retry-After the
+// provider asked for.
+func (c *EthClient) withRetry(ctx context.Context, send func() error) error {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if err = send(); err == nil || !IsTransient(err) || attempt >= c.retry.maxRetries {
+			return err
+		}
+
+		timer := time.NewTimer(c.retry.backoff(attempt, retryAfter(err)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (r retryConfig) backoff(attempt int, retryAfter time.Duration) time.Duration {
+	delay := r.baseBackoff << attempt
+	if delay <= 0 || delay > r.maxBackoff {
+		delay = r.maxBackoff
+	}
+	// equal jitter keeps at least half of the delay while spreading retries
+	if half := delay / 2; half > 0 {
+		delay = half + time.Duration(rand.Int63n(int64(half)+1))
+	}
+	return max(delay, retryAfter)
+}
+
+func retryAfter(err error) time.Duration {
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.RetryAfter
+	}
+	return 0
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as
+// an HTTP date.
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
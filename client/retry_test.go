@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestIsTransient(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"TransportError", fmt.Errorf("HTTP request failed: %w", &url.Error{Op: "Post", Err: errors.New("connection refused")}), true},
+		{"RateLimited", &httpStatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"ServerError", &httpStatusError{StatusCode: http.StatusBadGateway}, true},
+		{"BadRequest", &httpStatusError{StatusCode: http.StatusBadRequest}, false},
+		{"RpcLimitExceeded", &RpcError{Code: rpcCodeLimitExceeded}, true},
+		{"RpcInvalidParams", &RpcError{Code: -32602}, false},
+		{"Cancelled", fmt.Errorf("HTTP request failed: %w", &url.Error{Op: "Post", Err: context.Canceled}), false},
+		{"Other", errors.New("failed to decode response"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if transient := IsTransient(tt.err); transient != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, transient)
+			}
+		})
+	}
+}
+
+func TestRetryConfig_Backoff(t *testing.T) {
+	config := retryConfig{maxRetries: 5, baseBackoff: 100 * time.Millisecond, maxBackoff: time.Second}
+
+	for attempt, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second} {
+		delay := config.backoff(attempt, 0)
+		if delay < expected/2 || delay > expected {
+			t.Errorf("Attempt %d: expected a delay between %v and %v, got %v", attempt, expected/2, expected, delay)
+		}
+	}
+
+	if delay := config.backoff(0, 3*time.Second); delay != 3*time.Second {
+		t.Errorf("Expected the Retry-After delay, got %v", delay)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 11, 14, 10, 0, 0, 0, time.UTC)
+
+	if delay := parseRetryAfter("5", now); delay != 5*time.Second {
+		t.Errorf("Expected 5s, got %v", delay)
+	}
+	if delay := parseRetryAfter(now.Add(time.Minute).Format(http.TimeFormat), now); delay != time.Minute {
+		t.Errorf("Expected 1m, got %v", delay)
+	}
+	if delay := parseRetryAfter("soon", now); delay != 0 {
+		t.Errorf("Expected no delay, got %v", delay)
+	}
+}
+
+func TestRateLimiter_Reserve(t *testing.T) {
+	now := time.Now()
+	limiter := newRateLimiter(10, 2)
+	limiter.now = func() time.Time { return now }
+	limiter.last = now
+
+	for i := 0; i < 2; i++ {
+		if delay := limiter.reserve(); delay != 0 {
+			t.Fatalf("Expected request %d of the burst to pass, got a delay of %v", i, delay)
+		}
+	}
+	if delay := limiter.reserve(); delay != 100*time.Millisecond {
+		t.Errorf("Expected to wait 100ms for a token, got %v", delay)
+	}
+
+	now = now.Add(100 * time.Millisecond)
+	if delay := limiter.reserve(); delay != 0 {
+		t.Errorf("Expected a token after 100ms, got a delay of %v", delay)
+	}
+}
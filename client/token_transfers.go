@@ -0,0 +1,43 @@
+package client
+
+import (
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+func decodeTokenTransfers(logs []LogEntry, blockNum int) []storage.TokenTransfer {
+	transfers := []storage.TokenTransfer{}
+	for _, entry := range logs {
+		if transfer, ok := decodeTokenTransfer(entry, blockNum); ok {
+			transfers = append(transfers, transfer)
+		}
+	}
+	return transfers
+}
+
+// decodeTokenTransfer decodes an ERC-20 Transfer log. ERC-721 emits an event
+// with the same signature but indexes the token ID as a fourth topic, those
+// logs are not token transfers.
+func decodeTokenTransfer(entry LogEntry, blockNum int) (storage.TokenTransfer, bool) {
+	if entry.Removed || len(entry.Topics) != 3 || entry.Topics[0] != transferEventTopic {
+		return storage.TokenTransfer{}, false
+	}
+
+	from, fromOk := topicToAddress(entry.Topics[1])
+	to, toOk := topicToAddress(entry.Topics[2])
+	value, valueOk := wordToQuantity(entry.Data)
+	logIndex, err := parseBlockNumber(entry.LogIndex)
+	if !fromOk || !toOk || !valueOk || err != nil {
+		return storage.TokenTransfer{}, false
+	}
+
+	return storage.TokenTransfer{
+		TxHash:    entry.TransactionHash,
+		LogIndex:  logIndex,
+		Token:     storage.NormalizeAddress(entry.Address),
+		From:      from,
+		To:        to,
+		Value:     value,
+		BlockHash: entry.BlockHash,
+		BlockNum:  blockNum,
+	}, true
+}
@@ -0,0 +1,107 @@
+package client
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+func addressTopic(address storage.Address) string {
+	return fmt.Sprintf("0x%064s", address[2:])
+}
+
+// transferLog builds an ERC-20 Transfer log as found in a transaction receipt.
+func transferLog(blockHash, txHash string, from, to storage.Address, value int) map[string]interface{} {
+	return map[string]interface{}{
+		"address":         "0xToken",
+		"topics":          []string{transferEventTopic, addressTopic(from), addressTopic(to)},
+		"data":            fmt.Sprintf("0x%064x", value),
+		"blockHash":       blockHash,
+		"transactionHash": txHash,
+		"logIndex":        "0x2",
+	}
+}
+
+func TestDecodeTokenTransfer(t *testing.T) {
+	from := storage.Address("0x00000000000000000000000000000000000000aa")
+	to := storage.Address("0x00000000000000000000000000000000000000BB")
+
+	tests := []struct {
+		name     string
+		entry    LogEntry
+		expected storage.TokenTransfer
+		ok       bool
+	}{
+		{
+			name: "Erc20",
+			entry: LogEntry{
+				Address:         "0xToken",
+				Topics:          []string{transferEventTopic, addressTopic(from), addressTopic(to)},
+				Data:            fmt.Sprintf("0x%064x", 1000),
+				BlockHash:       "0xblock",
+				TransactionHash: "0xtx",
+				LogIndex:        "0x3",
+			},
+			expected: storage.TokenTransfer{
+				TxHash:    "0xtx",
+				LogIndex:  3,
+				Token:     "0xtoken",
+				From:      from,
+				To:        "0x00000000000000000000000000000000000000bb",
+				Value:     quantity("0x3e8"),
+				BlockHash: "0xblock",
+				BlockNum:  7,
+			},
+			ok: true,
+		},
+		{
+			name: "ZeroValue",
+			entry: LogEntry{
+				Topics:   []string{transferEventTopic, addressTopic(from), addressTopic(to)},
+				Data:     fmt.Sprintf("0x%064x", 0),
+				LogIndex: "0x0",
+			},
+			expected: storage.TokenTransfer{From: from, To: "0x00000000000000000000000000000000000000bb", Value: quantity("0x0"), BlockNum: 7},
+			ok:       true,
+		},
+		{
+			name: "Erc721",
+			entry: LogEntry{
+				Topics:   []string{transferEventTopic, addressTopic(from), addressTopic(to), fmt.Sprintf("0x%064x", 1)},
+				Data:     "0x",
+				LogIndex: "0x0",
+			},
+		},
+		{
+			name: "Removed",
+			entry: LogEntry{
+				Topics:   []string{transferEventTopic, addressTopic(from), addressTopic(to)},
+				Data:     fmt.Sprintf("0x%064x", 1),
+				LogIndex: "0x0",
+				Removed:  true,
+			},
+		},
+		{
+			name: "MalformedData",
+			entry: LogEntry{
+				Topics:   []string{transferEventTopic, addressTopic(from), addressTopic(to)},
+				Data:     "0x01",
+				LogIndex: "0x0",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			transfer, ok := decodeTokenTransfer(tt.entry, 7)
+			if ok != tt.ok {
+				t.Fatalf("Expected ok to be %v, got %v", tt.ok, ok)
+			}
+			if ok && !reflect.DeepEqual(transfer, tt.expected) {
+				t.Errorf("Expected %+v, got %+v", tt.expected, transfer)
+			}
+		})
+	}
+}
@@ -0,0 +1,248 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+type Tracer string
+
+const (
+	// internal transfers are not looked up
+	TracerNone Tracer = "none"
+	// debug_traceBlockByNumber with the callTracer, served by geth and most of its forks
+	TracerCallTracer Tracer = "call-tracer"
+	// trace_block, served by erigon, nethermind and reth
+	TracerParity Tracer = "parity"
+)
+
+func ParseTracer(tracer string) (Tracer, error) {
+	switch Tracer(tracer) {
+	case TracerNone, TracerCallTracer, TracerParity:
+		return Tracer(tracer), nil
+	}
+	return "", fmt.Errorf("unknown tracer %q", tracer)
+}
+
+// callFrame is a call of the call tree returned by the callTracer.
+type callFrame struct {
+	Type  string      `json:"type"`
+	From  string      `json:"from"`
+	To    string      `json:"to"`
+	Value string      `json:"value"`
+	Error string      `json:"error,omitempty"`
+	Calls []callFrame `json:"calls,omitempty"`
+}
+
+type callTracerResult struct {
+	TxHash string    `json:"txHash"`
+	Result callFrame `json:"result"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// parityTrace is a single call of the flat list returned by trace_block.
+type parityTrace struct {
+	Type   string `json:"type"`
+	Action struct {
+		CallType string `json:"callType"`
+		From     string `json:"from"`
+		To       string `json:"to"`
+		Value    string `json:"value"`
+		// set for suicide traces
+		Address       string `json:"address"`
+		RefundAddress string `json:"refundAddress"`
+		Balance       string `json:"balance"`
+	} `json:"action"`
+	Result *struct {
+		// set for create traces
+		Address string `json:"address"`
+	} `json:"result"`
+	Error           string `json:"error,omitempty"`
+	TraceAddress    []int  `json:"traceAddress"`
+	TransactionHash string `json:"transactionHash"`
+	BlockHash       string `json:"blockHash"`
+}
+
+// fetchInternalTransfers traces every block in one batch and extracts the
+// calls made by contracts that moved ETH. Blocks that could not be traced, or
+// whose trace does not match the fetched block because of a reorg, are left
+// out of the result.
+func (c *EthClient) fetchInternalTransfers(ctx context.Context, blocksData map[int]BlockResponse) (map[int][]storage.InternalTransfer, error) {
+	blockNums := make([]int, 0, len(blocksData))
+	payloads := make([]RpcRequest, 0, len(blocksData))
+	for blockNum := range blocksData {
+		blockNums = append(blockNums, blockNum)
+		payload := RpcRequest{Jsonrpc: "2.0", ID: c.nextID()}
+		if c.tracer == TracerParity {
+			payload.Method = "trace_block"
+			payload.Params = []interface{}{fmt.Sprintf("0x%x", blockNum)}
+		} else {
+			payload.Method = "debug_traceBlockByNumber"
+			payload.Params = []interface{}{fmt.Sprintf("0x%x", blockNum), map[string]string{"tracer": "callTracer"}}
+		}
+		payloads = append(payloads, payload)
+	}
+
+	responses, err := c.sendBatch(ctx, payloads)
+	if err != nil {
+		return nil, err
+	}
+
+	transfers := make(map[int][]storage.InternalTransfer, len(blockNums))
+	for i, response := range responses {
+		if response.Error != nil || response.Result == nil {
+			continue
+		}
+		blockNum := blockNums[i]
+		var blockTransfers []storage.InternalTransfer
+		var ok bool
+		if c.tracer == TracerParity {
+			var traces []parityTrace
+			if err := mapToStruct(response.Result, &traces); err != nil {
+				continue
+			}
+			blockTransfers, ok = decodeParityTraces(traces, blocksData[blockNum], blockNum)
+		} else {
+			var results []callTracerResult
+			if err := mapToStruct(response.Result, &results); err != nil {
+				continue
+			}
+			blockTransfers, ok = decodeCallTraces(results, blocksData[blockNum], blockNum)
+		}
+		if ok {
+			transfers[blockNum] = blockTransfers
+		}
+	}
+	return transfers, nil
+}
+
+// decodeCallTraces walks the call tree of every transaction of the block. The
+// results come in the order of the transactions, it fails when they do not
+// match the transactions of the block.
+func decodeCallTraces(results []callTracerResult, blockData BlockResponse, blockNum int) ([]storage.InternalTransfer, bool) {
+	if len(results) != len(blockData.Transactions) {
+		return nil, false
+	}
+
+	transfers := []storage.InternalTransfer{}
+	for i, result := range results {
+		txHash := blockData.Transactions[i].Hash
+		if result.TxHash != "" && result.TxHash != txHash || result.Error != "" {
+			return nil, false
+		}
+		// the top-level call is the transaction itself
+		if result.Result.Error != "" {
+			continue
+		}
+		for j, call := range result.Result.Calls {
+			transfers = appendCallTransfers(transfers, call, []int{j}, txHash, blockData.Hash, blockNum)
+		}
+	}
+	return transfers, true
+}
+
+// appendCallTransfers appends the transfer made by the call and by the calls
+// it made in turn. A reverted call reverts the ones it made as well.
+func appendCallTransfers(transfers []storage.InternalTransfer, call callFrame, traceAddress []int, txHash, blockHash string, blockNum int) []storage.InternalTransfer {
+	if call.Error != "" {
+		return transfers
+	}
+
+	var callType string
+	switch call.Type {
+	case "CALL":
+		callType = storage.CallTypeCall
+	case "CREATE", "CREATE2":
+		callType = storage.CallTypeCreate
+	case "SELFDESTRUCT":
+		callType = storage.CallTypeSelfdestruct
+	}
+	// DELEGATECALL and CALLCODE run code on behalf of the caller without moving ETH
+	value := toQuantity(call.Value)
+	if callType != "" && movesValue(value) {
+		transfers = append(transfers, storage.InternalTransfer{
+			TxHash:       txHash,
+			TraceAddress: traceAddress,
+			CallType:     callType,
+			From:         storage.NormalizeAddress(call.From),
+			To:           storage.NormalizeAddress(call.To),
+			Value:        value,
+			BlockHash:    blockHash,
+			BlockNum:     blockNum,
+		})
+	}
+
+	for i, subcall := range call.Calls {
+		subcallAddress := append(append([]int{}, traceAddress...), i)
+		transfers = appendCallTransfers(transfers, subcall, subcallAddress, txHash, blockHash, blockNum)
+	}
+	return transfers
+}
+
+// decodeParityTraces extracts the transfers from the flat list of calls of the
+// block, it fails when the traces belong to another block.
+func decodeParityTraces(traces []parityTrace, blockData BlockResponse, blockNum int) ([]storage.InternalTransfer, bool) {
+	// trace addresses of the reverted calls, keyed by transaction
+	reverted := make(map[string][][]int)
+	for _, trace := range traces {
+		if trace.BlockHash != "" && trace.BlockHash != blockData.Hash {
+			return nil, false
+		}
+		if trace.Error != "" {
+			reverted[trace.TransactionHash] = append(reverted[trace.TransactionHash], trace.TraceAddress)
+		}
+	}
+
+	transfers := []storage.InternalTransfer{}
+	for _, trace := range traces {
+		// block rewards have no transaction, an empty trace address is the transaction itself
+		if trace.TransactionHash == "" || len(trace.TraceAddress) == 0 {
+			continue
+		}
+		if isReverted(trace.TraceAddress, reverted[trace.TransactionHash]) {
+			continue
+		}
+
+		transfer := storage.InternalTransfer{
+			TxHash:       trace.TransactionHash,
+			TraceAddress: trace.TraceAddress,
+			BlockHash:    blockData.Hash,
+			BlockNum:     blockNum,
+		}
+		switch {
+		case trace.Type == "call" && trace.Action.CallType == "call":
+			transfer.CallType = storage.CallTypeCall
+			transfer.From, transfer.To, transfer.Value = storage.NormalizeAddress(trace.Action.From), storage.NormalizeAddress(trace.Action.To), toQuantity(trace.Action.Value)
+		case trace.Type == "create" && trace.Result != nil:
+			transfer.CallType = storage.CallTypeCreate
+			transfer.From, transfer.To, transfer.Value = storage.NormalizeAddress(trace.Action.From), storage.NormalizeAddress(trace.Result.Address), toQuantity(trace.Action.Value)
+		case trace.Type == "suicide":
+			transfer.CallType = storage.CallTypeSelfdestruct
+			transfer.From, transfer.To, transfer.Value = storage.NormalizeAddress(trace.Action.Address), storage.NormalizeAddress(trace.Action.RefundAddress), toQuantity(trace.Action.Balance)
+		default:
+			continue
+		}
+		if !movesValue(transfer.Value) {
+			continue
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, true
+}
+
+// isReverted tells whether the call, or one of the calls leading to it, reverted.
+func isReverted(traceAddress []int, revertedCalls [][]int) bool {
+	for _, reverted := range revertedCalls {
+		if len(reverted) <= len(traceAddress) && slices.Equal(reverted, traceAddress[:len(reverted)]) {
+			return true
+		}
+	}
+	return false
+}
+
+func movesValue(value storage.Quantity) bool {
+	return value.Cmp(storage.Quantity{}) > 0
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+var tracedBlock = BlockResponse{
+	Hash:         "0xblock",
+	Transactions: []TransactionDetail{{Hash: "0xtx1"}, {Hash: "0xtx2"}},
+}
+
+func TestDecodeCallTraces(t *testing.T) {
+	// tx1 calls a multisig forwarding ETH to a wallet, through a proxy
+	// delegating to its implementation, and a reverted call refunding it.
+	// tx2 reverted as a whole.
+	raw := `[
+		{"txHash": "0xtx1", "result": {"type": "CALL", "from": "0xa", "to": "0xmultisig", "value": "0x0", "calls": [
+			{"type": "DELEGATECALL", "from": "0xmultisig", "to": "0ximpl", "value": "0x0", "calls": [
+				{"type": "CALL", "from": "0xMultisig", "to": "0xWallet", "value": "0xde0b6b3a7640000"},
+				{"type": "STATICCALL", "from": "0xmultisig", "to": "0xoracle"}
+			]},
+			{"type": "CALL", "from": "0xmultisig", "to": "0xa", "value": "0x1", "error": "execution reverted", "calls": [
+				{"type": "CALL", "from": "0xa", "to": "0xb", "value": "0x1"}
+			]},
+			{"type": "SELFDESTRUCT", "from": "0xmultisig", "to": "0xwallet", "value": "0x5"}
+		]}},
+		{"txHash": "0xtx2", "result": {"type": "CALL", "from": "0xa", "to": "0xdex", "value": "0x0", "error": "execution reverted", "calls": [
+			{"type": "CALL", "from": "0xdex", "to": "0xwallet", "value": "0x7"}
+		]}}
+	]`
+	var results []callTracerResult
+	if err := json.Unmarshal([]byte(raw), &results); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	transfers, ok := decodeCallTraces(results, tracedBlock, 42)
+	if !ok {
+		t.Fatalf("Expected the traces to match the block")
+	}
+	expected := []storage.InternalTransfer{
+		{TxHash: "0xtx1", TraceAddress: []int{0, 0}, CallType: storage.CallTypeCall, From: "0xmultisig", To: "0xwallet", Value: quantity("0xde0b6b3a7640000"), BlockHash: "0xblock", BlockNum: 42},
+		{TxHash: "0xtx1", TraceAddress: []int{2}, CallType: storage.CallTypeSelfdestruct, From: "0xmultisig", To: "0xwallet", Value: quantity("0x5"), BlockHash: "0xblock", BlockNum: 42},
+	}
+	if !reflect.DeepEqual(transfers, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, transfers)
+	}
+
+	// traces of a block replaced by a reorg since it was fetched
+	results[0].TxHash = "0xother"
+	if _, ok := decodeCallTraces(results, tracedBlock, 42); ok {
+		t.Errorf("Expected traces of other transactions to be rejected")
+	}
+}
+
+func TestDecodeParityTraces(t *testing.T) {
+	raw := `[
+		{"type": "call", "action": {"callType": "call", "from": "0xa", "to": "0xmultisig", "value": "0x0"}, "traceAddress": [], "transactionHash": "0xtx1", "blockHash": "0xblock"},
+		{"type": "call", "action": {"callType": "call", "from": "0xmultisig", "to": "0xWallet", "value": "0x10"}, "traceAddress": [0], "transactionHash": "0xtx1", "blockHash": "0xblock"},
+		{"type": "call", "action": {"callType": "delegatecall", "from": "0xmultisig", "to": "0ximpl", "value": "0x10"}, "traceAddress": [1], "transactionHash": "0xtx1", "blockHash": "0xblock"},
+		{"type": "call", "action": {"callType": "call", "from": "0xmultisig", "to": "0xdex", "value": "0x2"}, "error": "Reverted", "traceAddress": [2], "transactionHash": "0xtx1", "blockHash": "0xblock"},
+		{"type": "call", "action": {"callType": "call", "from": "0xdex", "to": "0xwallet", "value": "0x2"}, "traceAddress": [2, 0], "transactionHash": "0xtx1", "blockHash": "0xblock"},
+		{"type": "create", "action": {"from": "0xmultisig", "value": "0x3"}, "result": {"address": "0xchild"}, "traceAddress": [3], "transactionHash": "0xtx1", "blockHash": "0xblock"},
+		{"type": "suicide", "action": {"address": "0xchild", "refundAddress": "0xwallet", "balance": "0x3"}, "traceAddress": [3, 0], "transactionHash": "0xtx1", "blockHash": "0xblock"},
+		{"type": "reward", "action": {"author": "0xminer", "value": "0x1bc16d674ec80000", "rewardType": "block"}, "traceAddress": [], "blockHash": "0xblock"}
+	]`
+	var traces []parityTrace
+	if err := json.Unmarshal([]byte(raw), &traces); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	transfers, ok := decodeParityTraces(traces, tracedBlock, 42)
+	if !ok {
+		t.Fatalf("Expected the traces to match the block")
+	}
+	expected := []storage.InternalTransfer{
+		{TxHash: "0xtx1", TraceAddress: []int{0}, CallType: storage.CallTypeCall, From: "0xmultisig", To: "0xwallet", Value: quantity("0x10"), BlockHash: "0xblock", BlockNum: 42},
+		{TxHash: "0xtx1", TraceAddress: []int{3}, CallType: storage.CallTypeCreate, From: "0xmultisig", To: "0xchild", Value: quantity("0x3"), BlockHash: "0xblock", BlockNum: 42},
+		{TxHash: "0xtx1", TraceAddress: []int{3, 0}, CallType: storage.CallTypeSelfdestruct, From: "0xchild", To: "0xwallet", Value: quantity("0x3"), BlockHash: "0xblock", BlockNum: 42},
+	}
+	if !reflect.DeepEqual(transfers, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, transfers)
+	}
+
+	traces[0].BlockHash = "0xother"
+	if _, ok := decodeParityTraces(traces, tracedBlock, 42); ok {
+		t.Errorf("Expected traces of another block to be rejected")
+	}
+}
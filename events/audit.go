@@ -0,0 +1,28 @@
+package events
+
+import (
+	"context"
+	"log"
+)
+
+// Audit logs the changes of the subscriptions and the reorgs received on the
+// subscription until the context is done, then closes it.
+func Audit(ctx context.Context, subscription *Subscription) {
+	defer subscription.Close()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-subscription.Events():
+			switch {
+			case event.Type == Reorg:
+				log.Printf("Audit: blocks %d to %d orphaned by a reorg", event.BlockNum, event.ToBlock)
+			case event.Removed:
+				log.Printf("Audit: unsubscribed from address %s", event.Subscription.Address)
+			default:
+				log.Printf("Audit: subscribed to address %s from block %d, label %q", event.Subscription.Address, event.Subscription.StartBlock, event.Subscription.Label)
+			}
+		}
+	}
+}
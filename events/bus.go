@@ -0,0 +1,278 @@
+package events
+
+import (
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+type Type string
+
+const (
+	// a block was stored, after the transactions matched in it
+	BlockProcessed Type = "block_processed"
+	// a stored transaction touches a subscribed address
+	TxMatched Type = "tx_matched"
+	// the blocks from BlockNum to ToBlock were orphaned, sent before the
+	// blocks replacing them
+	Reorg Type = "reorg"
+	// every block up to BlockNum is processed
+	CursorAdvanced Type = "cursor_advanced"
+	// a subscription was added, or removed when Removed is set
+	SubscriptionChanged Type = "subscription_changed"
+)
+
+// Event is published on the bus, only the fields of its type are set.
+type Event struct {
+	Type Type
+	// set by the bus when the event is published
+	Time time.Time
+	// set by the bus when the event is published, it grows with every event
+	// and across restarts
+	Seq       uint64
+	BlockNum  int
+	BlockHash string
+	ToBlock   int
+	// the transaction of a TxMatched event and the subscribed addresses it
+	// was stored for
+	Transaction storage.Transaction
+	Addresses   []storage.Address
+	// the subscription of a SubscriptionChanged event, only its address is
+	// set when it was removed
+	Subscription storage.Subscription
+	Removed      bool
+}
+
+// Policy tells what happens to an event for a subscriber whose buffer is full.
+type Policy int
+
+const (
+	// PolicyDrop drops the event, for consumers that can miss some such as metrics
+	PolicyDrop Policy = iota
+	// PolicyBlock makes the publisher wait for room in the buffer, for
+	// consumers that must see every event
+	PolicyBlock
+	// PolicyClose closes the subscription, for consumers that can resync on
+	// their own such as stream clients reconnecting
+	PolicyClose
+)
+
+const (
+	defaultBufferSize = 256
+	// most recent events kept, a consumer that missed events catches up from them
+	historySize = 1024
+)
+
+// Bus fans the events published in the process out to its subscribers. Every
+// subscriber gets its own bounded buffer, so a slow one only affects the
+// publisher when it subscribed with PolicyBlock.
+type Bus struct {
+	mu sync.RWMutex
+	// replaced on every change, so publishing does not hold the lock
+	subscriptions []*Subscription
+
+	// held while an event is published, so every subscriber gets the events
+	// in the order of their Seq
+	publishMu sync.Mutex
+	seq       uint64
+
+	historyMu sync.Mutex
+	// ring of the last events, the oldest at historyStart
+	history      []Event
+	historyStart int
+}
+
+// NewBus returns a bus whose sequence starts at the current time in
+// nanoseconds, so the Seq of an event of a previous run is always lower.
+func NewBus() *Bus {
+	return &Bus{seq: uint64(time.Now().UnixNano())}
+}
+
+// Subscription receives the events of the bus until it is closed. A consumer
+// must close it once it stops reading, a publisher blocked on it is released.
+type Subscription struct {
+	bus     *Bus
+	name    string
+	events  chan Event
+	policy  Policy
+	types   map[Type]bool
+	filter  func(Event) bool
+	dropped atomic.Uint64
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+type Option func(*Subscription)
+
+// WithBufferSize sets how many events are buffered for the subscriber.
+func WithBufferSize(size int) Option {
+	return func(s *Subscription) {
+		s.events = make(chan Event, size)
+	}
+}
+
+// WithPolicy sets what happens to an event when the buffer is full,
+// PolicyDrop by default.
+func WithPolicy(policy Policy) Option {
+	return func(s *Subscription) {
+		s.policy = policy
+	}
+}
+
+// WithTypes only delivers the events of the given types.
+func WithTypes(types ...Type) Option {
+	return func(s *Subscription) {
+		s.types = make(map[Type]bool, len(types))
+		for _, eventType := range types {
+			s.types[eventType] = true
+		}
+	}
+}
+
+// WithFilter only delivers the events the filter accepts. It is called on the
+// goroutine of the publisher and must not block.
+func WithFilter(filter func(Event) bool) Option {
+	return func(s *Subscription) {
+		s.filter = filter
+	}
+}
+
+// Subscribe registers a subscriber, the name identifies it in the logs.
+func (b *Bus) Subscribe(name string, opts ...Option) *Subscription {
+	s := &Subscription{
+		bus:    b,
+		name:   name,
+		events: make(chan Event, defaultBufferSize),
+		done:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subscriptions := make([]*Subscription, len(b.subscriptions), len(b.subscriptions)+1)
+	copy(subscriptions, b.subscriptions)
+	b.subscriptions = append(subscriptions, s)
+	return s
+}
+
+// Publish delivers the event to every subscriber interested in it.
+func (b *Bus) Publish(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now().UTC()
+	}
+
+	b.publishMu.Lock()
+	defer b.publishMu.Unlock()
+	b.seq++
+	event.Seq = b.seq
+
+	b.historyMu.Lock()
+	if len(b.history) < historySize {
+		b.history = append(b.history, event)
+	} else {
+		b.history[b.historyStart] = event
+		b.historyStart = (b.historyStart + 1) % historySize
+	}
+	b.historyMu.Unlock()
+
+	b.mu.RLock()
+	subscriptions := b.subscriptions
+	b.mu.RUnlock()
+
+	for _, s := range subscriptions {
+		s.deliver(event)
+	}
+}
+
+// Since returns the kept events published after the one with the given Seq.
+// It returns false when some of them are no longer kept, or when the Seq was
+// never published.
+func (b *Bus) Since(seq uint64) ([]Event, bool) {
+	b.historyMu.Lock()
+	defer b.historyMu.Unlock()
+	if len(b.history) == 0 {
+		return nil, false
+	}
+	first := b.history[b.historyStart].Seq
+	last := first + uint64(len(b.history)) - 1
+	if seq < first-1 || seq > last {
+		return nil, false
+	}
+	missed := make([]Event, 0, last-seq)
+	for i := int(seq - first + 1); i < len(b.history); i++ {
+		missed = append(missed, b.history[(b.historyStart+i)%len(b.history)])
+	}
+	return missed, true
+}
+
+func (b *Bus) remove(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subscriptions := make([]*Subscription, 0, len(b.subscriptions))
+	for _, subscription := range b.subscriptions {
+		if subscription != s {
+			subscriptions = append(subscriptions, subscription)
+		}
+	}
+	b.subscriptions = subscriptions
+}
+
+// Events returns the channel the events are delivered on. It is never
+// closed, Done tells when no more events are coming.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed once the subscription is closed, by the consumer or by the
+// bus under PolicyClose.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Dropped returns how many events were dropped because the buffer was full.
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// Close stops the delivery of events, it can be called several times.
+func (s *Subscription) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.bus.remove(s)
+	})
+}
+
+func (s *Subscription) deliver(event Event) {
+	if s.types != nil && !s.types[event.Type] {
+		return
+	}
+	if s.filter != nil && !s.filter(event) {
+		return
+	}
+
+	if s.policy == PolicyBlock {
+		select {
+		case s.events <- event:
+		case <-s.done:
+		}
+		return
+	}
+
+	select {
+	case <-s.done:
+	case s.events <- event:
+	default:
+		if s.dropped.Add(1) == 1 || s.policy == PolicyClose {
+			log.Printf("Event subscriber %s is too slow, %d events dropped", s.name, s.Dropped())
+		}
+		if s.policy == PolicyClose {
+			s.Close()
+		}
+	}
+}
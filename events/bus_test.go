@@ -0,0 +1,135 @@
+package events
+
+import (
+	"testing"
+	"time"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+// received drains the events buffered for the subscription.
+func received(s *Subscription) []Event {
+	var events []Event
+	for {
+		select {
+		case event := <-s.Events():
+			events = append(events, event)
+		default:
+			return events
+		}
+	}
+}
+
+func TestBus_DeliversToEverySubscriber(t *testing.T) {
+	bus := NewBus()
+	all := bus.Subscribe("all")
+	blocks := bus.Subscribe("blocks", WithTypes(BlockProcessed))
+	watched := storage.Address("0x00000000000000000000000000000000000000aa")
+	filtered := bus.Subscribe("filtered", WithFilter(func(event Event) bool {
+		return event.Transaction.From == watched
+	}))
+
+	bus.Publish(Event{Type: TxMatched, BlockNum: 1, Transaction: storage.Transaction{Hash: "0x1", From: watched}})
+	bus.Publish(Event{Type: TxMatched, BlockNum: 1, Transaction: storage.Transaction{Hash: "0x2"}})
+	bus.Publish(Event{Type: BlockProcessed, BlockNum: 1, BlockHash: "0xb1"})
+
+	if events := received(all); len(events) != 3 || events[0].Time.IsZero() {
+		t.Errorf("Expected every event stamped with its time, got %+v", events)
+	}
+	if events := received(blocks); len(events) != 1 || events[0].BlockHash != "0xb1" {
+		t.Errorf("Expected the block event only, got %+v", events)
+	}
+	if events := received(filtered); len(events) != 1 || events[0].Transaction.Hash != "0x1" {
+		t.Errorf("Expected the transaction of the watched address only, got %+v", events)
+	}
+
+	all.Close()
+	all.Close()
+	bus.Publish(Event{Type: BlockProcessed, BlockNum: 2})
+	if events := received(all); len(events) != 0 {
+		t.Errorf("Expected no event after the subscription is closed, got %+v", events)
+	}
+}
+
+func TestBus_Policies(t *testing.T) {
+	bus := NewBus()
+	dropping := bus.Subscribe("dropping", WithBufferSize(2))
+	closing := bus.Subscribe("closing", WithBufferSize(2), WithPolicy(PolicyClose))
+
+	for block := 1; block <= 3; block++ {
+		bus.Publish(Event{Type: BlockProcessed, BlockNum: block})
+	}
+
+	if events := received(dropping); len(events) != 2 || events[1].BlockNum != 2 || dropping.Dropped() != 1 {
+		t.Errorf("Expected the event after the full buffer to be dropped, got %+v and %d dropped", events, dropping.Dropped())
+	}
+	select {
+	case <-closing.Done():
+	default:
+		t.Errorf("Expected the subscription to be closed once its buffer was full")
+	}
+}
+
+func TestBus_BlockPolicyWaitsForTheSubscriber(t *testing.T) {
+	bus := NewBus()
+	blocking := bus.Subscribe("blocking", WithBufferSize(1), WithPolicy(PolicyBlock))
+
+	bus.Publish(Event{Type: BlockProcessed, BlockNum: 1})
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(Event{Type: BlockProcessed, BlockNum: 2})
+		close(published)
+	}()
+
+	select {
+	case <-published:
+		t.Fatalf("Expected the publisher to wait while the buffer is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if event := <-blocking.Events(); event.BlockNum != 1 {
+		t.Errorf("Expected block 1, got %+v", event)
+	}
+	<-published
+	if event := <-blocking.Events(); event.BlockNum != 2 {
+		t.Errorf("Expected block 2, got %+v", event)
+	}
+
+	// closing releases a waiting publisher
+	bus.Publish(Event{Type: BlockProcessed, BlockNum: 3})
+	go blocking.Close()
+	bus.Publish(Event{Type: BlockProcessed, BlockNum: 4})
+}
+
+func TestBus_Since(t *testing.T) {
+	bus := NewBus()
+	if _, complete := bus.Since(1); complete {
+		t.Errorf("Expected nothing to be kept before the first event")
+	}
+
+	all := bus.Subscribe("all", WithBufferSize(historySize+2))
+	for block := 1; block <= historySize+2; block++ {
+		bus.Publish(Event{Type: BlockProcessed, BlockNum: block})
+	}
+	// the first two events are no longer kept
+	latest := received(all)[2:]
+
+	missed, complete := bus.Since(latest[0].Seq + 10)
+	if !complete || len(missed) != historySize-11 || missed[0].Seq != latest[0].Seq+11 || missed[0].BlockNum != 14 {
+		t.Errorf("Expected the events after the given one in order, got %d from %+v", len(missed), missed[0])
+	}
+	for i := 1; i < len(missed); i++ {
+		if missed[i].Seq != missed[i-1].Seq+1 {
+			t.Fatalf("Expected consecutive sequence numbers, got %d after %d", missed[i].Seq, missed[i-1].Seq)
+		}
+	}
+	if missed, complete := bus.Since(latest[len(latest)-1].Seq); !complete || len(missed) != 0 {
+		t.Errorf("Expected no event after the last one, got %+v", missed)
+	}
+	if _, complete := bus.Since(latest[0].Seq - 2); complete {
+		t.Errorf("Expected events dropped from the history to be reported")
+	}
+	if _, complete := bus.Since(latest[len(latest)-1].Seq + 1); complete {
+		t.Errorf("Expected an unknown sequence number to be reported")
+	}
+}
@@ -2,4 +2,10 @@ module github.com/oanatmaria/ethblkcn-observer
 
 go 1.23
 
-require github.com/golang/mock v1.6.0
+require (
+	github.com/golang/mock v1.6.0
+	github.com/gorilla/websocket v1.5.3
+	golang.org/x/crypto v0.31.0
+)
+
+require golang.org/x/sys v0.28.0 // indirect
@@ -2,18 +2,42 @@ package main
 
 import (
 	"context"
+	"flag"
 	"log"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/oanatmaria/ethblkcn-observer/client"
+	"github.com/oanatmaria/ethblkcn-observer/events"
 	"github.com/oanatmaria/ethblkcn-observer/parser"
 	"github.com/oanatmaria/ethblkcn-observer/server"
 	"github.com/oanatmaria/ethblkcn-observer/storage"
+	"github.com/oanatmaria/ethblkcn-observer/webhook"
 )
 
 func main() {
+	confirmationDepth := flag.Int("confirmations", parser.DefaultConfirmationDepth, "number of blocks, including its own, after which a transaction is confirmed")
+	followFinalityTags := flag.Bool("finality-tags", false, "use the node's safe/finalized block tags instead of the confirmation depth")
+	startBlock := flag.Int("start-block", -1, "block to start processing from instead of the stored cursor")
+	storageType := flag.String("storage", "memory", "storage backend: memory or file")
+	storagePath := flag.String("storage-path", "ethblkcn-observer.log", "path of the log file used by the file storage")
+	rpcURLs := flag.String("rpc-urls", client.DefaultEndpoint, "comma-separated list of RPC endpoints, in priority order")
+	rpcPolicy := flag.String("rpc-policy", string(client.PolicyPriority), "how requests are spread over the RPC endpoints: priority, round-robin or lowest-latency")
+	wsURL := flag.String("ws-url", "", "WebSocket endpoint used to process blocks as soon as a new head arrives, polling is used when empty")
+	healthCheckInterval := flag.Duration("health-check-interval", 30*time.Second, "how often the RPC endpoints are health checked")
+	rpcTimeout := flag.Duration("rpc-timeout", time.Minute, "deadline of a single RPC call, including its retries")
+	rpcRetries := flag.Int("rpc-retries", client.DefaultMaxRetries, "how many times a request failing with a transient error is retried")
+	rpcRateLimit := flag.Float64("rpc-rate-limit", 0, "most RPC requests sent per second, 0 for no limit")
+	rpcBurst := flag.Int("rpc-burst", 10, "most RPC requests sent at once when rate limited")
+	tracerName := flag.String("tracer", string(client.TracerNone), "how blocks are traced to find internal transfers: none, call-tracer or parity")
+	webhookSecret := flag.String("webhook-secret", "", "secret the webhook payloads are signed with, webhooks are disabled when empty")
+	webhookAttempts := flag.Int("webhook-attempts", webhook.DefaultMaxAttempts, "how many times a webhook delivery is attempted before it is marked as failed")
+	flag.Parse()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
@@ -24,9 +48,63 @@ func main() {
 		cancel()
 	}()
 
-	storage := storage.NewMemoryStorage()
-	client := client.NewEthClient()
-	parser, err := parser.NewEthParser(storage, client)
+	var store storage.Storage
+	switch *storageType {
+	case "memory":
+		store = storage.NewMemoryStorage()
+	case "file":
+		fileStorage, err := storage.NewFileStorage(*storagePath)
+		if err != nil {
+			log.Fatalf("Server error: can not open storage, err: %v", err)
+		}
+		defer func() {
+			if err := fileStorage.Close(); err != nil {
+				log.Printf("Error closing storage: %v", err)
+			}
+		}()
+		store = fileStorage
+	default:
+		log.Fatalf("Server error: unknown storage backend %q", *storageType)
+	}
+
+	policy, err := client.ParsePolicy(*rpcPolicy)
+	if err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+	tracer, err := client.ParseTracer(*tracerName)
+	if err != nil {
+		log.Fatalf("Server error: %v", err)
+	}
+	ethClient := client.NewEthClient(
+		client.WithEndpoints(strings.Split(*rpcURLs, ",")...),
+		client.WithPolicy(policy),
+		client.WithRequestTimeout(*rpcTimeout),
+		client.WithRetry(*rpcRetries, client.DefaultBaseBackoff, client.DefaultMaxBackoff),
+		client.WithRateLimit(*rpcRateLimit, *rpcBurst),
+		client.WithTracer(tracer),
+	)
+	go ethClient.RunHealthChecks(ctx, *healthCheckInterval)
+
+	bus := events.NewBus()
+	go events.Audit(ctx, bus.Subscribe("audit", events.WithTypes(events.SubscriptionChanged, events.Reorg)))
+
+	parserOpts := []parser.Option{
+		parser.WithConfirmationDepth(*confirmationDepth),
+		parser.WithFinalityTags(*followFinalityTags),
+		parser.WithStartBlock(*startBlock),
+		parser.WithPublisher(bus),
+	}
+	serverOpts := []server.Option{server.WithHealthReporter(ethClient), server.WithEventBus(bus)}
+	if *webhookSecret != "" {
+		dispatcher := webhook.NewDispatcher(store,
+			webhook.WithSecret(*webhookSecret),
+			webhook.WithRetry(*webhookAttempts, webhook.DefaultBaseBackoff, webhook.DefaultMaxBackoff),
+		)
+		parserOpts = append(parserOpts, parser.WithOutbox(dispatcher))
+		serverOpts = append(serverOpts, server.WithWebhooks(dispatcher))
+	}
+
+	parser, err := parser.NewEthParser(ctx, store, ethClient, parserOpts...)
 	if err != nil {
 		log.Fatalf("Server error: can not start server, err: %v", err)
 	}
@@ -35,10 +113,14 @@ func main() {
 		log.Fatal("Server error: can not start server, failed to fetch latest block number")
 	}
 
-	server := server.NewHttpServer(":8080", parser)
+	if *wsURL != "" {
+		serverOpts = append(serverOpts, server.WithHeadSource(client.NewHeadSubscriber(*wsURL)))
+	}
+	server := server.NewHttpServer(":8080", parser, serverOpts...)
 
 	log.Println("Starting server...")
-	if err := server.Start(ctx); err != nil {
+	// a graceful shutdown returns http.ErrServerClosed, let the deferred cleanup run
+	if err := server.Start(ctx); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("Server error: %v", err)
 	}
 }
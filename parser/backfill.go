@@ -0,0 +1,119 @@
+package parser
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+// number of blocks a backfill job advances on every ProcessBackfills call
+const backfillBatchSize = 100
+
+var (
+	ErrInvalidBackfillRange = errors.New("fromBlock must be between 0 and the last ingested block")
+	ErrBackfillInProgress   = errors.New("a backfill is already running for this address")
+)
+
+func (p *EthParser) Backfill(address storage.Address, fromBlock int) error {
+	// the blocks up to the last one ingested may have been stored before the
+	// address was subscribed, the cursor can still be behind them
+	lastBlock := p.lastIngestedBlock()
+	if fromBlock < 0 || fromBlock > lastBlock {
+		return ErrInvalidBackfillRange
+	}
+
+	p.backfillMu.Lock()
+	defer p.backfillMu.Unlock()
+	if job, exists := p.GetBackfillStatus(address); exists && !job.Done {
+		return ErrBackfillInProgress
+	}
+
+	// blocks after the last ingested one are picked up by ProcessNewBlocks
+	p.storage.SaveBackfillJob(storage.BackfillJob{
+		Address:   address,
+		FromBlock: fromBlock,
+		ToBlock:   lastBlock,
+		NextBlock: fromBlock,
+	})
+	return nil
+}
+
+func (p *EthParser) GetBackfillStatus(address storage.Address) (storage.BackfillJob, bool) {
+	for _, job := range p.storage.GetBackfillJobs() {
+		if job.Address == address {
+			return job, true
+		}
+	}
+	return storage.BackfillJob{}, false
+}
+
+// ProcessBackfills runs independently of ProcessNewBlocks. Progress is saved
+// after every batch, so unfinished jobs found in storage are resumed after a
+// restart.
+func (p *EthParser) ProcessBackfills(ctx context.Context) {
+	for _, job := range p.storage.GetBackfillJobs() {
+		if job.Done {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if err := p.advanceBackfill(ctx, job); err != nil {
+			log.Printf("Error backfilling %s: %v\n", job.Address, err)
+		}
+	}
+}
+
+func (p *EthParser) advanceBackfill(ctx context.Context, job storage.BackfillJob) error {
+	lastBlock := min(job.NextBlock+backfillBatchSize-1, job.ToBlock)
+	var blockNums []int
+	for blockNum := job.NextBlock; blockNum <= lastBlock; blockNum++ {
+		blockNums = append(blockNums, blockNum)
+	}
+
+	// historical ranges are fetched with batch requests, which is far cheaper
+	// than one request per block and per transaction
+	blocks, err := p.client.GetBlocksByNumber(ctx, blockNums)
+	if err != nil {
+		return fmt.Errorf("failed to fetch blocks %d to %d: %v", job.NextBlock, lastBlock, err)
+	}
+
+	// the fetch may have raced with an unsubscribe or a new backfill, the
+	// batch is only stored if the job is still the one that was fetched
+	p.backfillMu.Lock()
+	defer p.backfillMu.Unlock()
+	if current, exists := p.GetBackfillStatus(job.Address); !exists || current != job {
+		log.Printf("Backfill for %s was dropped, discarding blocks %d to %d\n", job.Address, job.NextBlock, lastBlock)
+		return nil
+	}
+
+	for ; job.NextBlock <= lastBlock; job.NextBlock++ {
+		block, fetched := blocks[job.NextBlock]
+		if !fetched {
+			// retried on the next call
+			err = fmt.Errorf("block %d could not be fetched", job.NextBlock)
+			break
+		}
+		p.storage.AddAddressTransactions(job.Address, block.Transactions...)
+		if len(block.TokenTransfers) > 0 {
+			p.storage.AddAddressTokenTransfers(job.Address, block.TokenTransfers...)
+		}
+		if len(block.NftTransfers) > 0 {
+			p.storage.AddAddressNftTransfers(job.Address, block.NftTransfers...)
+		}
+		if len(block.InternalTransfers) > 0 {
+			p.storage.AddAddressInternalTransfers(job.Address, block.InternalTransfers...)
+		}
+	}
+
+	job.Done = job.NextBlock > job.ToBlock
+	p.storage.SaveBackfillJob(job)
+	if job.Done {
+		log.Printf("Backfill for %s finished at block %d\n", job.Address, job.ToBlock)
+	}
+
+	return err
+}
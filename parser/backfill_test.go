@@ -0,0 +1,184 @@
+package parser_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/oanatmaria/ethblkcn-observer/client"
+	"github.com/oanatmaria/ethblkcn-observer/parser"
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+func TestEthParser_Backfill(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockStorage.EXPECT().GetBackfillJobs().Return(nil)
+	mockStorage.EXPECT().SaveBackfillJob(storage.BackfillJob{
+		Address: "0xAddress", FromBlock: 90, ToBlock: 100, NextBlock: 90,
+	})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	if err := ethParser.Backfill("0xAddress", 90); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := ethParser.Backfill("0xAddress", 101); !errors.Is(err, parser.ErrInvalidBackfillRange) {
+		t.Errorf("expected ErrInvalidBackfillRange, got %v", err)
+	}
+}
+
+func TestEthParser_Backfill_AlreadyRunning(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockStorage.EXPECT().GetBackfillJobs().Return([]storage.BackfillJob{
+		{Address: "0xAddress", FromBlock: 10, ToBlock: 100, NextBlock: 20},
+	})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	if err := ethParser.Backfill("0xAddress", 90); !errors.Is(err, parser.ErrBackfillInProgress) {
+		t.Errorf("expected ErrBackfillInProgress, got %v", err)
+	}
+}
+
+func TestEthParser_ProcessBackfills(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockStorage.EXPECT().GetBackfillJobs().Return([]storage.BackfillJob{
+		{Address: "0xDone", FromBlock: 1, ToBlock: 2, NextBlock: 3, Done: true},
+		{Address: "0xAddress", FromBlock: 10, ToBlock: 12, NextBlock: 11},
+	}).Times(2)
+
+	blocks := make(map[int]client.Block)
+	for _, blockNum := range []int{11, 12} {
+		tx := storage.Transaction{Hash: "tx", From: "0xAddress", BlockNum: blockNum}
+		blocks[blockNum] = client.Block{Number: blockNum, Transactions: []storage.Transaction{tx}}
+		mockStorage.EXPECT().AddAddressTransactions(storage.Address("0xAddress"), tx)
+	}
+	transfer := storage.TokenTransfer{TxHash: "tx", To: "0xAddress", BlockNum: 12}
+	blocks[12] = client.Block{Number: 12, Transactions: blocks[12].Transactions, TokenTransfers: []storage.TokenTransfer{transfer}}
+	mockStorage.EXPECT().AddAddressTokenTransfers(storage.Address("0xAddress"), transfer)
+	mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{11, 12}).Return(blocks, nil)
+	mockStorage.EXPECT().SaveBackfillJob(storage.BackfillJob{
+		Address: "0xAddress", FromBlock: 10, ToBlock: 12, NextBlock: 13, Done: true,
+	})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	ethParser.ProcessBackfills(ctx)
+}
+
+func TestEthParser_ProcessBackfills_ResumesAfterFailure(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockStorage.EXPECT().GetBackfillJobs().Return([]storage.BackfillJob{
+		{Address: "0xAddress", FromBlock: 10, ToBlock: 12, NextBlock: 10},
+	}).Times(2)
+
+	// block 11 is missing from the response
+	mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{10, 11, 12}).Return(map[int]client.Block{
+		10: {Number: 10},
+		12: {Number: 12},
+	}, nil)
+	mockStorage.EXPECT().AddAddressTransactions(storage.Address("0xAddress"))
+	mockStorage.EXPECT().SaveBackfillJob(storage.BackfillJob{
+		Address: "0xAddress", FromBlock: 10, ToBlock: 12, NextBlock: 11,
+	})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	ethParser.ProcessBackfills(ctx)
+}
+
+func TestEthParser_ProcessBackfills_UnsubscribedWhileFetching(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+
+	// the job is removed with its subscription while its blocks are fetched,
+	// neither the job nor the blocks are stored afterwards
+	gomock.InOrder(
+		mockStorage.EXPECT().GetBackfillJobs().Return([]storage.BackfillJob{
+			{Address: "0xAddress", FromBlock: 10, ToBlock: 12, NextBlock: 10},
+		}),
+		mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{10, 11, 12}).Return(map[int]client.Block{
+			10: {Number: 10}, 11: {Number: 11}, 12: {Number: 12},
+		}, nil),
+		mockStorage.EXPECT().GetBackfillJobs().Return(nil),
+	)
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	ethParser.ProcessBackfills(ctx)
+}
+
+func TestEthParser_ProcessBackfills_BatchFails(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockStorage.EXPECT().GetBackfillJobs().Return([]storage.BackfillJob{
+		{Address: "0xAddress", FromBlock: 10, ToBlock: 12, NextBlock: 10},
+	})
+
+	// the job is left untouched and retried on the next call
+	mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{10, 11, 12}).Return(nil, errors.New("batch error"))
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	ethParser.ProcessBackfills(ctx)
+}
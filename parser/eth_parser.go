@@ -4,60 +4,460 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/oanatmaria/ethblkcn-observer/client"
+	"github.com/oanatmaria/ethblkcn-observer/events"
 	"github.com/oanatmaria/ethblkcn-observer/storage"
 )
 
+const (
+	numWorkers = 4
+	// how many recent block hashes are kept to detect and unwind reorgs
+	maxReorgDepth = 64
+	// DefaultConfirmationDepth is the number of blocks, including its own, a
+	// transaction needs before it is confirmed.
+	DefaultConfirmationDepth = 12
+	// most blocks fetched at once, a longer range is processed in several batches
+	maxBlocksPerBatch = 500
+
+	safeBlockTag      = "safe"
+	finalizedBlockTag = "finalized"
+)
+
 type EthParser struct {
 	storage storage.Storage
 	client  client.Client
+
+	// held while a block is stored and while a subscription is added, so an
+	// address sees every block ingested after ingestedBlock as it was read
+	ingestMu sync.Mutex
+	// held while a backfill batch is stored and while a subscription is
+	// removed, so a job dropped with its subscription is not saved back
+	backfillMu sync.Mutex
+
+	blocksMu      sync.Mutex
+	trackedBlocks map[int]blockRef
+	// blocks after the cursor that were ingested while an earlier one failed,
+	// at most maxReorgDepth of them as ingestion stops behind a failing block
+	completedBlocks map[int]bool
+	// blocks that failed and are retried on the next run
+	pendingBlocks map[int]bool
+	// highest block handled by the live processing, the blocks after the
+	// cursor up to it are either completed or pending
+	ingestedBlock int
+
+	confirmationDepth  int
+	followFinalityTags bool
+	startBlock         int
+	publisher          Publisher
+	outbox             Outbox
+
+	chainMu        sync.RWMutex
+	headBlock      int
+	safeBlock      int
+	finalizedBlock int
+}
+
+type blockRef struct {
+	hash       string
+	parentHash string
+}
+
+type Option func(*EthParser)
+
+// WithConfirmationDepth sets how many blocks, including its own, a
+// transaction needs before it is reported as confirmed.
+func WithConfirmationDepth(depth int) Option {
+	return func(p *EthParser) {
+		p.confirmationDepth = depth
+	}
+}
+
+// WithFinalityTags makes the parser follow the node's "safe" and "finalized"
+// block tags instead of counting confirmations.
+func WithFinalityTags(follow bool) Option {
+	return func(p *EthParser) {
+		p.followFinalityTags = follow
+	}
+}
+
+// WithStartBlock makes the parser start processing at the given block
+// instead of resuming from the stored cursor.
+func WithStartBlock(block int) Option {
+	return func(p *EthParser) {
+		p.startBlock = block
+	}
+}
+
+// WithPublisher publishes the events of the blocks processed from now on and
+// of the subscription changes, backfilled transactions are left out.
+func WithPublisher(publisher Publisher) Option {
+	return func(p *EthParser) {
+		p.publisher = publisher
+	}
 }
 
-func NewEthParser(storage storage.Storage, client client.Client) (Parser, error) {
-	latestBlock, err := client.GetLatestBlockNumber()
+// WithOutbox queues the deliveries of the matched transactions in the outbox
+// as their block is stored.
+func WithOutbox(outbox Outbox) Option {
+	return func(p *EthParser) {
+		p.outbox = outbox
+	}
+}
+
+func NewEthParser(ctx context.Context, storage storage.Storage, client client.Client, opts ...Option) (Parser, error) {
+	latestBlock, err := client.GetLatestBlockNumber(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching latest block: %v", err)
 	}
 
-	storage.UpdateCurrentBlock(latestBlock)
+	p := &EthParser{
+		storage:           storage,
+		client:            client,
+		trackedBlocks:     make(map[int]blockRef),
+		completedBlocks:   make(map[int]bool),
+		pendingBlocks:     make(map[int]bool),
+		confirmationDepth: DefaultConfirmationDepth,
+		startBlock:        -1,
+		headBlock:         latestBlock,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	// the cursor is the last fully processed block
+	switch storedBlock := storage.GetCurrentBlock(); {
+	case p.startBlock >= 0:
+		log.Printf("Starting from block %d\n", p.startBlock)
+		p.ingestedBlock = p.startBlock - 1
+		storage.UpdateCurrentBlock(p.ingestedBlock)
+	case storedBlock > 0:
+		log.Printf("Resuming after block %d, %d blocks behind the chain head\n", storedBlock, latestBlock-storedBlock)
+		p.ingestedBlock = storedBlock
+	default:
+		p.ingestedBlock = latestBlock
+		storage.UpdateCurrentBlock(latestBlock)
+	}
+
+	if p.followFinalityTags {
+		p.updateFinalityTags(ctx)
+	}
 
-	return &EthParser{
-		storage: storage,
-		client:  client,
-	}, nil
+	return p, nil
 }
 
 func (p *EthParser) GetCurrentBlock() int {
 	return p.storage.GetCurrentBlock()
 }
 
-func (p *EthParser) Subscribe(address string) bool {
-	return p.storage.AddObservedAddress(address)
+func (p *EthParser) GetLastIngestedBlock() int {
+	return p.lastIngestedBlock()
+}
+
+func (p *EthParser) Subscribe(subscription storage.Subscription) bool {
+	if subscription.CreatedAt.IsZero() {
+		subscription.CreatedAt = time.Now().UTC()
+	}
+
+	// the cursor lags behind the blocks already stored while a batch is
+	// processed, new subscriptions start after the last block stored instead
+	p.ingestMu.Lock()
+	if subscription.StartBlock < 0 {
+		subscription.StartBlock = p.lastIngestedBlock() + 1
+	}
+	added := p.storage.AddSubscription(subscription)
+	p.ingestMu.Unlock()
+	if !added {
+		return false
+	}
+	p.publish(events.Event{Type: events.SubscriptionChanged, Subscription: subscription})
+	return true
+}
+
+func (p *EthParser) Unsubscribe(address storage.Address, purge bool) bool {
+	p.backfillMu.Lock()
+	removed := p.storage.RemoveSubscription(address, purge)
+	p.backfillMu.Unlock()
+	if !removed {
+		return false
+	}
+	p.publish(events.Event{Type: events.SubscriptionChanged, Subscription: storage.Subscription{Address: address}, Removed: true})
+	return true
+}
+
+func (p *EthParser) GetSubscriptions() []storage.Subscription {
+	return p.storage.GetSubscriptions()
+}
+
+func (p *EthParser) GetPendingBlocks() []int {
+	p.blocksMu.Lock()
+	defer p.blocksMu.Unlock()
+	pending := make([]int, 0, len(p.pendingBlocks))
+	for blockNum := range p.pendingBlocks {
+		pending = append(pending, blockNum)
+	}
+	sort.Ints(pending)
+	return pending
+}
+
+func (p *EthParser) GetTransactions(address storage.Address) []storage.Transaction {
+	return withConfirmationStatus(p, p.storage.GetTransactions(address), transactionStatus)
 }
 
-func (p *EthParser) GetTransactions(address string) []storage.Transaction {
-	return p.storage.GetTransactions(address)
+func (p *EthParser) QueryTransactions(address storage.Address, query storage.TransactionQuery, status string) storage.TransactionPage {
+	if status != "" {
+		// the status of a transaction follows from its block, so it narrows the block range
+		from, to, ok := p.statusBlocks(status)
+		if !ok {
+			return storage.TransactionPage{}
+		}
+		if from > query.FromBlock {
+			query.FromBlock = from
+		}
+		if to > 0 && (query.ToBlock == 0 || to < query.ToBlock) {
+			query.ToBlock = to
+		}
+		if query.ToBlock > 0 && query.FromBlock > query.ToBlock {
+			return storage.TransactionPage{}
+		}
+	}
+
+	page := p.storage.QueryTransactions(address, query)
+	page.Transactions = withConfirmationStatus(p, page.Transactions, transactionStatus)
+	return page
+}
+
+func (p *EthParser) GetTokenTransfers(address storage.Address) []storage.TokenTransfer {
+	return withConfirmationStatus(p, p.storage.GetTokenTransfers(address), func(transfer *storage.TokenTransfer) (int, *string) {
+		return transfer.BlockNum, &transfer.ConfirmationStatus
+	})
+}
+
+func (p *EthParser) GetNftTransfers(address storage.Address) []storage.NftTransfer {
+	return withConfirmationStatus(p, p.storage.GetNftTransfers(address), func(transfer *storage.NftTransfer) (int, *string) {
+		return transfer.BlockNum, &transfer.ConfirmationStatus
+	})
+}
+
+func (p *EthParser) GetInternalTransfers(address storage.Address) []storage.InternalTransfer {
+	return withConfirmationStatus(p, p.storage.GetInternalTransfers(address), func(transfer *storage.InternalTransfer) (int, *string) {
+		return transfer.BlockNum, &transfer.ConfirmationStatus
+	})
 }
+
+func transactionStatus(tx *storage.Transaction) (int, *string) {
+	return tx.BlockNum, &tx.ConfirmationStatus
+}
+
+// withConfirmationStatus copies the records read from the storage, which must
+// not be changed, setting the confirmation status of each from its block.
+// fields returns the block of a record and its status field.
+func withConfirmationStatus[T any](p *EthParser, stored []T, fields func(record *T) (int, *string)) []T {
+	if stored == nil {
+		return nil
+	}
+
+	records := make([]T, len(stored))
+	copy(records, stored)
+	for i := range records {
+		blockNum, status := fields(&records[i])
+		*status = p.confirmationStatus(blockNum)
+	}
+	return records
+}
+
 func (p *EthParser) ProcessNewBlocks(ctx context.Context) {
-	latestBlock, err := p.client.GetLatestBlockNumber()
+	latestBlock, err := p.client.GetLatestBlockNumber(ctx)
 	if err != nil {
 		log.Printf("Error fetching latest block: %v\n", err)
 		return
 	}
 
+	p.chainMu.Lock()
+	p.headBlock = latestBlock
+	p.chainMu.Unlock()
+
+	if p.followFinalityTags {
+		p.updateFinalityTags(ctx)
+	}
+
 	currentBlock := p.storage.GetCurrentBlock()
-	if currentBlock >= latestBlock {
+
+	// failed blocks are retried, but new blocks keep being fetched past them
+	// so a block failing for a few runs does not hold up the live processing
+	if pending := p.GetPendingBlocks(); len(pending) > 0 {
+		if !p.processBlocks(ctx, pending) {
+			return
+		}
+		currentBlock = p.moveCursor(currentBlock)
+	}
+
+	for lastIngested := max(p.lastIngestedBlock(), currentBlock); lastIngested < latestBlock; {
+		log.Println(currentBlock)
+
+		// the cursor is stored after every batch, so catching up after a
+		// long downtime keeps its progress if interrupted
+		lastBlock := min(lastIngested+maxBlocksPerBatch, latestBlock)
+		if limit, limited := p.ingestLimit(); limited {
+			lastBlock = min(lastBlock, limit)
+		}
+		if lastBlock <= lastIngested {
+			break
+		}
+		var blockNums []int
+		for blockNum := lastIngested + 1; blockNum <= lastBlock; blockNum++ {
+			blockNums = append(blockNums, blockNum)
+		}
+		if !p.processBlocks(ctx, blockNums) {
+			return
+		}
+		currentBlock = p.moveCursor(currentBlock)
+		if p.lastIngestedBlock() < lastBlock {
+			break
+		}
+		lastIngested = lastBlock
+	}
+
+	if pending := p.GetPendingBlocks(); len(pending) > 0 {
+		log.Printf("Blocks pending retry: %v\n", pending)
+	}
+	if limit, limited := p.ingestLimit(); limited && p.lastIngestedBlock() >= limit {
+		log.Printf("Error: ingestion stopped at block %d, block %d keeps failing and must be ingested before newer blocks\n", limit, limit-maxReorgDepth+2)
+	}
+}
+
+// moveCursor stores the cursor once it moved past completed blocks and
+// returns it.
+func (p *EthParser) moveCursor(currentBlock int) int {
+	// the cursor only moves over blocks without a failed one before them
+	advanced := p.advanceCursor(currentBlock)
+	if advanced != currentBlock {
+		p.storage.UpdateCurrentBlock(advanced)
+		p.publish(events.Event{Type: events.CursorAdvanced, BlockNum: advanced})
+	}
+	return advanced
+}
+
+// processBlocks fetches and ingests the blocks, which must be in ascending
+// order. Blocks that fail are marked as pending, the blocks past the ingest
+// limit are left for a later run. It reports false when the context was
+// cancelled.
+func (p *EthParser) processBlocks(ctx context.Context, blockNums []int) bool {
+	blocks, ok := p.fetchBlocks(ctx, blockNums)
+	if !ok {
+		return false
+	}
+
+	// blocks are fetched concurrently but ingested in order, so every block
+	// can be checked against the hash of its parent
+	for _, blockNum := range blockNums {
+		if limit, limited := p.ingestLimit(); limited && blockNum > limit {
+			break
+		}
+		p.handleBlock(ctx, blockNum, blocks)
+	}
+
+	return true
+}
+
+// handleBlock ingests a fetched block or marks it as pending, and moves the
+// last ingested block past it.
+func (p *EthParser) handleBlock(ctx context.Context, blockNum int, blocks map[int]client.Block) {
+	block, fetched := blocks[blockNum]
+	var canonical map[int]client.Block
+	if fetched {
+		// fetched before taking the lock, so the requests of a reorg do not
+		// hold up new subscriptions
+		var err error
+		if canonical, err = p.canonicalAncestors(ctx, blockNum, block); err != nil {
+			log.Printf("Error handling reorg at block %d: %v\n", blockNum, err)
+			fetched = false
+		}
+	}
+
+	p.ingestMu.Lock()
+	defer p.ingestMu.Unlock()
+	defer p.setIngestedBlock(blockNum)
+
+	if !fetched {
+		p.markPending(blockNum)
 		return
 	}
+	p.ingestBlock(blockNum, block, canonical)
+	p.markCompleted(blockNum)
+}
+
+func (p *EthParser) lastIngestedBlock() int {
+	p.blocksMu.Lock()
+	defer p.blocksMu.Unlock()
+	return p.ingestedBlock
+}
+
+func (p *EthParser) setIngestedBlock(blockNum int) {
+	p.blocksMu.Lock()
+	defer p.blocksMu.Unlock()
+	p.ingestedBlock = max(p.ingestedBlock, blockNum)
+}
+
+func (p *EthParser) isCompleted(blockNum int) bool {
+	p.blocksMu.Lock()
+	defer p.blocksMu.Unlock()
+	return p.completedBlocks[blockNum]
+}
+
+func (p *EthParser) markCompleted(blockNum int) {
+	p.blocksMu.Lock()
+	defer p.blocksMu.Unlock()
+	p.completedBlocks[blockNum] = true
+	delete(p.pendingBlocks, blockNum)
+}
+
+func (p *EthParser) markPending(blockNum int) {
+	p.blocksMu.Lock()
+	defer p.blocksMu.Unlock()
+	p.pendingBlocks[blockNum] = true
+}
 
-	log.Println(currentBlock)
+// ingestLimit returns the highest block that can be ingested while blocks
+// are pending. A retried block is checked against the hashes of its parent
+// and child, so no block is ingested that would stop them being tracked.
+func (p *EthParser) ingestLimit() (int, bool) {
+	p.blocksMu.Lock()
+	defer p.blocksMu.Unlock()
+	limit, limited := 0, false
+	for blockNum := range p.pendingBlocks {
+		if !limited || blockNum+maxReorgDepth-2 < limit {
+			limit, limited = blockNum+maxReorgDepth-2, true
+		}
+	}
+	return limit, limited
+}
 
-	blockChan := make(chan int)
+// advanceCursor returns the highest block reachable from the cursor through
+// completed blocks only, forgetting the completion of the blocks it passes.
+func (p *EthParser) advanceCursor(cursor int) int {
+	p.blocksMu.Lock()
+	defer p.blocksMu.Unlock()
+	for p.completedBlocks[cursor+1] {
+		cursor++
+		delete(p.completedBlocks, cursor)
+	}
+	return cursor
+}
+
+// fetchBlocks fetches the blocks with batch requests of at most
+// client.MaxBatchSize blocks sent concurrently. Blocks that could not be
+// fetched are left out of the result. It reports false when the context was
+// cancelled before all blocks were fetched.
+func (p *EthParser) fetchBlocks(ctx context.Context, blockNums []int) (map[int]client.Block, bool) {
+	requestChan := make(chan []int)
 	var wg sync.WaitGroup
+	var mu sync.Mutex
+	blocks := make(map[int]client.Block, len(blockNums))
 
-	numWorkers := 4
 	for i := 0; i < numWorkers; i++ {
 		wg.Add(1)
 		go func() {
@@ -66,33 +466,248 @@ func (p *EthParser) ProcessNewBlocks(ctx context.Context) {
 				select {
 				case <-ctx.Done():
 					return
-				case blockNum, ok := <-blockChan:
+				case requested, ok := <-requestChan:
 					if !ok {
 						return
 					}
-					block, err := p.client.GetBlockByNumber(blockNum)
+					fetched, err := p.client.GetBlocksByNumber(ctx, requested)
 					if err != nil {
-						log.Printf("Error fetching block %d: %v\n", blockNum, err)
+						if ctx.Err() == nil {
+							log.Printf("Error fetching blocks %d to %d: %v\n", requested[0], requested[len(requested)-1], err)
+						}
 						continue
 					}
-					p.storage.AddTransactions(block.Transactions...)
+					mu.Lock()
+					for blockNum, block := range fetched {
+						blocks[blockNum] = block
+					}
+					mu.Unlock()
 				}
 			}
 
 		}()
 	}
 
-	for blockNum := currentBlock + 1; blockNum <= latestBlock; blockNum++ {
+	for start := 0; start < len(blockNums); start += client.MaxBatchSize {
 		select {
 		case <-ctx.Done():
-			close(blockChan)
-			return
-		case blockChan <- blockNum:
+			close(requestChan)
+			return nil, false
+		case requestChan <- blockNums[start:min(start+client.MaxBatchSize, len(blockNums))]:
 		}
 	}
-	close(blockChan)
+	close(requestChan)
 
 	wg.Wait()
 
-	p.storage.UpdateCurrentBlock(latestBlock)
+	return blocks, ctx.Err() == nil
+}
+
+// ingestBlock stores the block after replacing the orphaned blocks before it
+// with their canonical counterparts, if any.
+func (p *EthParser) ingestBlock(blockNum int, block client.Block, canonical map[int]client.Block) {
+	if canonical != nil {
+		p.replaceOrphaned(blockNum, canonical)
+	}
+
+	p.storeBlock(block)
+	p.trackBlock(blockNum, block)
+
+	// a block retried after a failure may not be the parent of the blocks
+	// already ingested after it, in that case they are processed again
+	if child, known := p.trackedBlock(blockNum + 1); known && child.parentHash != "" && child.parentHash != block.Hash {
+		log.Printf("Block %d is not the parent of the ingested block %d, discarding the blocks after it\n", blockNum, blockNum+1)
+		p.discardBlocksAfter(blockNum)
+	}
+}
+
+// storeBlock stores the records of the block touching the subscribed addresses.
+func (p *EthParser) storeBlock(block client.Block) {
+	matches := p.storage.AddTransactions(block.Transactions...)
+	// most blocks emit no transfers
+	if len(block.TokenTransfers) > 0 {
+		p.storage.AddTokenTransfers(block.TokenTransfers...)
+	}
+	if len(block.NftTransfers) > 0 {
+		p.storage.AddNftTransfers(block.NftTransfers...)
+	}
+	if len(block.InternalTransfers) > 0 {
+		p.storage.AddInternalTransfers(block.InternalTransfers...)
+	}
+	// the bus may drop events, the outbox must not miss any
+	if p.outbox != nil && len(matches) > 0 {
+		p.outbox.QueueMatches(matches...)
+	}
+
+	for _, match := range matches {
+		p.publish(events.Event{Type: events.TxMatched, BlockNum: block.Number, BlockHash: block.Hash, Transaction: match.Transaction, Addresses: match.Addresses})
+	}
+	p.publish(events.Event{Type: events.BlockProcessed, BlockNum: block.Number, BlockHash: block.Hash})
+}
+
+func (p *EthParser) publish(event events.Event) {
+	if p.publisher != nil {
+		p.publisher.Publish(event)
+	}
+}
+
+// discardBlocksAfter drops the completed blocks following blockNum, they are
+// fetched again on the next run.
+func (p *EthParser) discardBlocksAfter(blockNum int) {
+	for next := blockNum + 1; p.isCompleted(next); next++ {
+		p.storage.RollbackBlock(next)
+
+		p.blocksMu.Lock()
+		delete(p.completedBlocks, next)
+		delete(p.trackedBlocks, next)
+		p.pendingBlocks[next] = true
+		p.blocksMu.Unlock()
+	}
+}
+
+// canonicalAncestors returns the canonical blocks of the orphaned ancestors of
+// block, nil when it follows the tracked hash of its parent. It walks back from
+// the parent until it finds a block whose canonical hash still matches the
+// tracked one.
+func (p *EthParser) canonicalAncestors(ctx context.Context, blockNum int, block client.Block) (map[int]client.Block, error) {
+	parentHash, known := p.blockHash(blockNum - 1)
+	if !known || block.ParentHash == "" || block.ParentHash == parentHash {
+		return nil, nil
+	}
+	log.Printf("Reorg detected at block %d: expected parent %s, got %s\n", blockNum, parentHash, block.ParentHash)
+
+	canonical := make(map[int]client.Block)
+	for ancestor := blockNum - 1; ; ancestor-- {
+		trackedHash, known := p.blockHash(ancestor)
+		if !known {
+			// at most maxReorgDepth blocks are tracked, and none after a restart
+			log.Printf("Error: reorg at block %d goes past the tracked blocks, the records of block %d and before may belong to orphaned blocks\n", blockNum, ancestor)
+			return canonical, nil
+		}
+		ancestorBlock, err := p.client.GetBlockByNumber(ctx, ancestor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch block %d: %v", ancestor, err)
+		}
+		if ancestorBlock.Hash == trackedHash {
+			return canonical, nil
+		}
+		canonical[ancestor] = ancestorBlock
+	}
+}
+
+// replaceOrphaned replaces the data of the orphaned blocks before blockNum
+// with their canonical counterparts.
+func (p *EthParser) replaceOrphaned(blockNum int, canonical map[int]client.Block) {
+	first := blockNum - len(canonical)
+	if first < blockNum {
+		p.publish(events.Event{Type: events.Reorg, BlockNum: first, ToBlock: blockNum - 1})
+	}
+	for orphaned := first; orphaned < blockNum; orphaned++ {
+		block := canonical[orphaned]
+		p.storage.RollbackBlock(orphaned)
+		p.storeBlock(block)
+		p.trackBlock(orphaned, block)
+	}
+	log.Printf("Reorg resolved: replaced blocks %d to %d\n", first, blockNum-1)
+}
+
+func (p *EthParser) blockHash(blockNum int) (string, bool) {
+	ref, known := p.trackedBlock(blockNum)
+	return ref.hash, known && ref.hash != ""
+}
+
+func (p *EthParser) trackedBlock(blockNum int) (blockRef, bool) {
+	p.blocksMu.Lock()
+	defer p.blocksMu.Unlock()
+	ref, known := p.trackedBlocks[blockNum]
+	return ref, known
+}
+
+func (p *EthParser) trackBlock(blockNum int, block client.Block) {
+	p.blocksMu.Lock()
+	defer p.blocksMu.Unlock()
+	p.trackedBlocks[blockNum] = blockRef{hash: block.Hash, parentHash: block.ParentHash}
+
+	highest := blockNum
+	for tracked := range p.trackedBlocks {
+		highest = max(highest, tracked)
+	}
+	for tracked := range p.trackedBlocks {
+		if tracked <= highest-maxReorgDepth {
+			delete(p.trackedBlocks, tracked)
+		}
+	}
+}
+
+func (p *EthParser) updateFinalityTags(ctx context.Context) {
+	safeBlock, err := p.client.GetBlockNumberByTag(ctx, safeBlockTag)
+	if err != nil {
+		log.Printf("Error fetching %s block: %v\n", safeBlockTag, err)
+		return
+	}
+
+	finalizedBlock, err := p.client.GetBlockNumberByTag(ctx, finalizedBlockTag)
+	if err != nil {
+		log.Printf("Error fetching %s block: %v\n", finalizedBlockTag, err)
+		return
+	}
+
+	p.chainMu.Lock()
+	defer p.chainMu.Unlock()
+	p.safeBlock = safeBlock
+	p.finalizedBlock = finalizedBlock
+}
+
+// statusBlocks returns the range of the blocks having a confirmation status,
+// to is 0 when the range is unbounded. It returns false when no block with
+// transactions has the status, the genesis block has none, or the status is
+// unknown.
+func (p *EthParser) statusBlocks(status string) (from, to int, ok bool) {
+	p.chainMu.RLock()
+	defer p.chainMu.RUnlock()
+
+	if p.followFinalityTags {
+		switch status {
+		case storage.StatusFinalized:
+			return 0, p.finalizedBlock, p.finalizedBlock > 0
+		case storage.StatusConfirmed:
+			from = p.finalizedBlock + 1
+			return from, p.safeBlock, p.safeBlock > 0 && p.safeBlock >= from
+		case storage.StatusPendingConfirmation:
+			return max(p.finalizedBlock, p.safeBlock) + 1, 0, true
+		default:
+			return 0, 0, false
+		}
+	}
+
+	lastConfirmed := p.headBlock - p.confirmationDepth + 1
+	switch status {
+	case storage.StatusConfirmed:
+		return 0, lastConfirmed, lastConfirmed > 0
+	case storage.StatusPendingConfirmation:
+		return max(lastConfirmed+1, 0), 0, true
+	default:
+		return 0, 0, false
+	}
+}
+
+func (p *EthParser) confirmationStatus(blockNum int) string {
+	p.chainMu.RLock()
+	defer p.chainMu.RUnlock()
+
+	if p.followFinalityTags {
+		switch {
+		case p.finalizedBlock > 0 && blockNum <= p.finalizedBlock:
+			return storage.StatusFinalized
+		case p.safeBlock > 0 && blockNum <= p.safeBlock:
+			return storage.StatusConfirmed
+		default:
+			return storage.StatusPendingConfirmation
+		}
+	}
+
+	if p.headBlock-blockNum+1 >= p.confirmationDepth {
+		return storage.StatusConfirmed
+	}
+	return storage.StatusPendingConfirmation
 }
@@ -4,11 +4,15 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
+	"slices"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
 	"github.com/oanatmaria/ethblkcn-observer/client"
+	"github.com/oanatmaria/ethblkcn-observer/events"
 	"github.com/oanatmaria/ethblkcn-observer/parser"
 	"github.com/oanatmaria/ethblkcn-observer/storage"
 )
@@ -20,10 +24,11 @@ func TestNewEthParser(t *testing.T) {
 	mockClient := client.NewMockClient(ctrl)
 	mockStorage := storage.NewMockStorage(ctrl)
 
-	mockClient.EXPECT().GetLatestBlockNumber().Return(100, nil)
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
 	mockStorage.EXPECT().UpdateCurrentBlock(100)
 
-	ethParser, err := parser.NewEthParser(mockStorage, mockClient)
+	ethParser, err := parser.NewEthParser(context.Background(), mockStorage, mockClient)
 	if err != nil {
 		t.Errorf("unexpected error: %v", err)
 	}
@@ -32,6 +37,38 @@ func TestNewEthParser(t *testing.T) {
 	}
 }
 
+func TestNewEthParser_ResumesFromStoredBlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := client.NewMockClient(ctrl)
+	mockStorage := storage.NewMockStorage(ctrl)
+
+	// the stored cursor is kept, UpdateCurrentBlock must not be called
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(90)
+
+	if _, err := parser.NewEthParser(context.Background(), mockStorage, mockClient); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestNewEthParser_WithStartBlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockClient := client.NewMockClient(ctrl)
+	mockStorage := storage.NewMockStorage(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(90)
+	mockStorage.EXPECT().UpdateCurrentBlock(49)
+
+	if _, err := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithStartBlock(50)); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
 func TestNewEthParser_ErrorFetchingLatestBlock(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -39,9 +76,9 @@ func TestNewEthParser_ErrorFetchingLatestBlock(t *testing.T) {
 	mockClient := client.NewMockClient(ctrl)
 	mockStorage := storage.NewMockStorage(ctrl)
 
-	mockClient.EXPECT().GetLatestBlockNumber().Return(0, errors.New("network error"))
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(0, errors.New("network error"))
 
-	ethParser, err := parser.NewEthParser(mockStorage, mockClient)
+	ethParser, err := parser.NewEthParser(context.Background(), mockStorage, mockClient)
 	if err == nil {
 		t.Errorf("expected an error but got none")
 	}
@@ -57,11 +94,12 @@ func TestEthParser_GetCurrentBlock(t *testing.T) {
 	mockStorage := storage.NewMockStorage(ctrl)
 	mockClient := client.NewMockClient(ctrl)
 
-	mockClient.EXPECT().GetLatestBlockNumber().Return(100, nil)
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
 	mockStorage.EXPECT().UpdateCurrentBlock(100)
 	mockStorage.EXPECT().GetCurrentBlock().Return(100)
 
-	ethParser, _ := parser.NewEthParser(mockStorage, mockClient)
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
 	currentBlock := ethParser.GetCurrentBlock()
 	if currentBlock != 100 {
 		t.Errorf("expected currentBlock to be 100, got %d", currentBlock)
@@ -75,17 +113,101 @@ func TestEthParser_Subscribe(t *testing.T) {
 	mockStorage := storage.NewMockStorage(ctrl)
 	mockClient := client.NewMockClient(ctrl)
 
-	mockClient.EXPECT().GetLatestBlockNumber().Return(100, nil)
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
 	mockStorage.EXPECT().UpdateCurrentBlock(100)
-	mockStorage.EXPECT().AddObservedAddress("0xAddress").Return(true)
+	var stored storage.Subscription
+	mockStorage.EXPECT().AddSubscription(gomock.Any()).DoAndReturn(func(subscription storage.Subscription) bool {
+		if subscription.Address != "0xAddress" || subscription.Label != "treasury" || subscription.StartBlock != 101 || subscription.CreatedAt.IsZero() {
+			t.Errorf("expected the subscription to start after block 100, got %+v", subscription)
+		}
+		stored = subscription
+		return true
+	})
+	mockPublisher := parser.NewMockPublisher(ctrl)
+	mockPublisher.EXPECT().Publish(gomock.Any()).Do(func(event events.Event) {
+		if event.Type != events.SubscriptionChanged || event.Removed || event.Subscription != stored {
+			t.Errorf("expected the stored subscription to be published, got %+v", event)
+		}
+	})
 
-	ethParser, _ := parser.NewEthParser(mockStorage, mockClient)
-	result := ethParser.Subscribe("0xAddress")
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithPublisher(mockPublisher))
+	result := ethParser.Subscribe(storage.Subscription{Address: "0xAddress", Label: "treasury", StartBlock: -1})
 	if !result {
 		t.Errorf("expected Subscribe to return true")
 	}
 }
 
+func TestEthParser_Subscribe_AfterIngestedBlocks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+
+	// block 102 fails, so the cursor stays at 101 while block 103 is stored
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(103, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(100).AnyTimes()
+	mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{101, 102, 103}).DoAndReturn(blocksOf(102))
+	mockStorage.EXPECT().AddTransactions().Times(2)
+	mockStorage.EXPECT().UpdateCurrentBlock(101)
+
+	mockStorage.EXPECT().AddSubscription(gomock.Any()).DoAndReturn(func(subscription storage.Subscription) bool {
+		if subscription.StartBlock != 104 {
+			t.Errorf("expected the subscription to start after block 103, got %d", subscription.StartBlock)
+		}
+		return true
+	})
+	mockStorage.EXPECT().GetBackfillJobs().Return(nil)
+	mockStorage.EXPECT().SaveBackfillJob(storage.BackfillJob{
+		Address: "0xBackfilled", FromBlock: 90, ToBlock: 103, NextBlock: 90,
+	})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	ethParser.ProcessNewBlocks(ctx)
+
+	if !ethParser.Subscribe(storage.Subscription{Address: "0xAddress", StartBlock: -1}) {
+		t.Errorf("expected Subscribe to return true")
+	}
+	// the backfill covers the blocks stored before the subscription
+	if err := ethParser.Backfill("0xBackfilled", 90); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestEthParser_Unsubscribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+	mockPublisher := parser.NewMockPublisher(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockStorage.EXPECT().RemoveSubscription(storage.Address("0xAddress"), true).Return(true)
+	mockPublisher.EXPECT().Publish(events.Event{Type: events.SubscriptionChanged, Subscription: storage.Subscription{Address: "0xAddress"}, Removed: true})
+	// nothing is published for an address that was not subscribed
+	mockStorage.EXPECT().RemoveSubscription(storage.Address("0xOther"), false).Return(false)
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithPublisher(mockPublisher))
+	if !ethParser.Unsubscribe("0xAddress", true) {
+		t.Errorf("expected Unsubscribe to return true")
+	}
+	if ethParser.Unsubscribe("0xOther", false) {
+		t.Errorf("expected Unsubscribe to return false")
+	}
+}
+
 func TestEthParser_GetTransactions(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -98,44 +220,301 @@ func TestEthParser_GetTransactions(t *testing.T) {
 		{Hash: "tx2"},
 	}
 
-	mockClient.EXPECT().GetLatestBlockNumber().Return(100, nil)
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
 	mockStorage.EXPECT().UpdateCurrentBlock(100)
-	mockStorage.EXPECT().GetTransactions("0xAddress").Return(transactions)
+	mockStorage.EXPECT().GetTransactions(storage.Address("0xAddress")).Return(transactions)
 
-	ethParser, _ := parser.NewEthParser(mockStorage, mockClient)
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
 	result := ethParser.GetTransactions("0xAddress")
 	if len(result) != len(transactions) {
 		t.Errorf("expected %d transactions, got %d", len(transactions), len(result))
 	}
 	for i, tx := range result {
-		if tx != transactions[i] {
-			t.Errorf("expected transaction %v, got %v", transactions[i], tx)
+		expected := transactions[i]
+		expected.ConfirmationStatus = storage.StatusConfirmed
+		if !reflect.DeepEqual(tx, expected) {
+			t.Errorf("expected transaction %v, got %v", expected, tx)
+		}
+	}
+}
+
+func TestEthParser_GetTransactions_ConfirmationDepth(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockStorage.EXPECT().GetTransactions(storage.Address("0xAddress")).Return([]storage.Transaction{
+		{Hash: "tx1", BlockNum: 98},
+		{Hash: "tx2", BlockNum: 99},
+	})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithConfirmationDepth(3))
+	result := ethParser.GetTransactions("0xAddress")
+
+	if result[0].ConfirmationStatus != storage.StatusConfirmed {
+		t.Errorf("expected tx1 to be %s, got %s", storage.StatusConfirmed, result[0].ConfirmationStatus)
+	}
+	if result[1].ConfirmationStatus != storage.StatusPendingConfirmation {
+		t.Errorf("expected tx2 to be %s, got %s", storage.StatusPendingConfirmation, result[1].ConfirmationStatus)
+	}
+}
+
+func TestEthParser_GetTransactions_FinalityTags(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockClient.EXPECT().GetBlockNumberByTag(gomock.Any(), "safe").Return(90, nil)
+	mockClient.EXPECT().GetBlockNumberByTag(gomock.Any(), "finalized").Return(80, nil)
+	mockStorage.EXPECT().GetTransactions(storage.Address("0xAddress")).Return([]storage.Transaction{
+		{Hash: "tx1", BlockNum: 80},
+		{Hash: "tx2", BlockNum: 85},
+		{Hash: "tx3", BlockNum: 95},
+	})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithFinalityTags(true))
+	result := ethParser.GetTransactions("0xAddress")
+
+	expected := []string{storage.StatusFinalized, storage.StatusConfirmed, storage.StatusPendingConfirmation}
+	for i, tx := range result {
+		if tx.ConfirmationStatus != expected[i] {
+			t.Errorf("expected %s to be %s, got %s", tx.Hash, expected[i], tx.ConfirmationStatus)
 		}
 	}
 }
 
+func TestEthParser_QueryTransactions(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []parser.Option
+		status   string
+		query    storage.TransactionQuery
+		expected *storage.TransactionQuery
+	}{
+		{"no status", nil, "", storage.TransactionQuery{FromBlock: 10, Limit: 5}, &storage.TransactionQuery{FromBlock: 10, Limit: 5}},
+		{"confirmed by depth", []parser.Option{parser.WithConfirmationDepth(3)}, storage.StatusConfirmed, storage.TransactionQuery{FromBlock: 10}, &storage.TransactionQuery{FromBlock: 10, ToBlock: 98}},
+		{"pending by depth", []parser.Option{parser.WithConfirmationDepth(3)}, storage.StatusPendingConfirmation, storage.TransactionQuery{ToBlock: 120}, &storage.TransactionQuery{FromBlock: 99, ToBlock: 120}},
+		{"finalized by depth", []parser.Option{parser.WithConfirmationDepth(3)}, storage.StatusFinalized, storage.TransactionQuery{}, nil},
+		{"finalized by tags", []parser.Option{parser.WithFinalityTags(true)}, storage.StatusFinalized, storage.TransactionQuery{ToBlock: 90}, &storage.TransactionQuery{ToBlock: 80}},
+		{"confirmed by tags", []parser.Option{parser.WithFinalityTags(true)}, storage.StatusConfirmed, storage.TransactionQuery{}, &storage.TransactionQuery{FromBlock: 81, ToBlock: 90}},
+		{"pending by tags", []parser.Option{parser.WithFinalityTags(true)}, storage.StatusPendingConfirmation, storage.TransactionQuery{}, &storage.TransactionQuery{FromBlock: 91}},
+		{"outside the status", []parser.Option{parser.WithFinalityTags(true)}, storage.StatusFinalized, storage.TransactionQuery{FromBlock: 85}, nil},
+		{"unknown status by depth", nil, "bogus", storage.TransactionQuery{}, nil},
+		{"unknown status by tags", []parser.Option{parser.WithFinalityTags(true)}, "bogus", storage.TransactionQuery{}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockStorage := storage.NewMockStorage(ctrl)
+			mockClient := client.NewMockClient(ctrl)
+
+			mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+			mockStorage.EXPECT().GetCurrentBlock().Return(0)
+			mockStorage.EXPECT().UpdateCurrentBlock(100)
+			mockClient.EXPECT().GetBlockNumberByTag(gomock.Any(), "safe").Return(90, nil).AnyTimes()
+			mockClient.EXPECT().GetBlockNumberByTag(gomock.Any(), "finalized").Return(80, nil).AnyTimes()
+			if tt.expected != nil {
+				mockStorage.EXPECT().QueryTransactions(storage.Address("0xAddress"), *tt.expected).Return(storage.TransactionPage{
+					Transactions: []storage.Transaction{{Hash: "tx1", BlockNum: 98}},
+					Total:        1,
+				})
+			}
+
+			ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, tt.opts...)
+			page := ethParser.QueryTransactions("0xAddress", tt.query, tt.status)
+
+			if tt.expected == nil {
+				if page.Total != 0 || len(page.Transactions) != 0 {
+					t.Errorf("expected an empty page, got %+v", page)
+				}
+				return
+			}
+			if len(page.Transactions) != 1 || page.Transactions[0].ConfirmationStatus == "" {
+				t.Errorf("expected tx1 with its confirmation status, got %+v", page.Transactions)
+			}
+		})
+	}
+}
+
+func TestEthParser_GetTokenTransfers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockStorage.EXPECT().GetTokenTransfers(storage.Address("0xAddress")).Return([]storage.TokenTransfer{
+		{TxHash: "tx1", BlockNum: 98},
+		{TxHash: "tx2", BlockNum: 99},
+	})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithConfirmationDepth(3))
+	result := ethParser.GetTokenTransfers("0xAddress")
+
+	if len(result) != 2 {
+		t.Fatalf("expected 2 transfers, got %d", len(result))
+	}
+	if result[0].ConfirmationStatus != storage.StatusConfirmed {
+		t.Errorf("expected tx1 to be %s, got %s", storage.StatusConfirmed, result[0].ConfirmationStatus)
+	}
+	if result[1].ConfirmationStatus != storage.StatusPendingConfirmation {
+		t.Errorf("expected tx2 to be %s, got %s", storage.StatusPendingConfirmation, result[1].ConfirmationStatus)
+	}
+}
+
+func TestEthParser_GetNftTransfers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockStorage.EXPECT().GetNftTransfers(storage.Address("0xAddress")).Return([]storage.NftTransfer{
+		{TxHash: "tx1", BlockNum: 99},
+	})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithConfirmationDepth(3))
+	result := ethParser.GetNftTransfers("0xAddress")
+
+	if len(result) != 1 || result[0].ConfirmationStatus != storage.StatusPendingConfirmation {
+		t.Errorf("expected tx1 to be %s, got %+v", storage.StatusPendingConfirmation, result)
+	}
+}
+
+func TestEthParser_GetInternalTransfers(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+	mockStorage.EXPECT().GetInternalTransfers(storage.Address("0xAddress")).Return([]storage.InternalTransfer{
+		{TxHash: "tx1", TraceAddress: []int{0}, BlockNum: 90},
+	})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithConfirmationDepth(3))
+	result := ethParser.GetInternalTransfers("0xAddress")
+
+	if len(result) != 1 || result[0].ConfirmationStatus != storage.StatusConfirmed {
+		t.Errorf("expected tx1 to be %s, got %+v", storage.StatusConfirmed, result)
+	}
+}
+
 func TestEthParser_ProcessNewBlocks(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockStorage := storage.NewMockStorage(ctrl)
 	mockClient := client.NewMockClient(ctrl)
+	mockPublisher := parser.NewMockPublisher(ctrl)
 
-	mockClient.EXPECT().GetLatestBlockNumber().Return(100, nil)
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
 	mockStorage.EXPECT().UpdateCurrentBlock(100)
 	mockStorage.EXPECT().GetCurrentBlock().Return(100)
-	mockClient.EXPECT().GetLatestBlockNumber().Return(105, nil)
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(106, nil)
 
+	blocks := make(map[int]client.Block)
 	for i := 101; i <= 105; i++ {
-		mockClient.EXPECT().GetBlockByNumber(i).Return(client.Block{
+		blocks[i] = client.Block{
+			Number:       i,
+			Hash:         fmt.Sprintf("0xb%d", i),
 			Transactions: []storage.Transaction{{Hash: fmt.Sprintf("tx%d", i)}},
-		}, nil)
-		mockStorage.EXPECT().AddTransactions(storage.Transaction{Hash: fmt.Sprintf("tx%d", i)})
+		}
+		tx := storage.Transaction{Hash: fmt.Sprintf("tx%d", i)}
+		// only the transactions of the odd blocks touch a subscribed address,
+		// the other blocks and block 106 only publish the block itself
+		if i%2 == 1 {
+			match := storage.TransactionMatch{Transaction: tx, Addresses: []storage.Address{"0xaddress"}}
+			mockStorage.EXPECT().AddTransactions(tx).Return([]storage.TransactionMatch{match})
+			mockPublisher.EXPECT().Publish(events.Event{Type: events.TxMatched, BlockNum: i, BlockHash: fmt.Sprintf("0xb%d", i), Transaction: tx, Addresses: match.Addresses})
+		} else {
+			mockStorage.EXPECT().AddTransactions(tx).Return(nil)
+		}
+		mockPublisher.EXPECT().Publish(events.Event{Type: events.BlockProcessed, BlockNum: i, BlockHash: fmt.Sprintf("0xb%d", i)})
+	}
+	transfer := storage.TokenTransfer{TxHash: "tx106", Token: "0xToken", BlockNum: 106}
+	nftTransfer := storage.NftTransfer{TxHash: "tx106", Contract: "0xNft", Standard: storage.StandardErc721, BlockNum: 106}
+	internalTransfer := storage.InternalTransfer{TxHash: "tx106", TraceAddress: []int{0}, CallType: storage.CallTypeCall, BlockNum: 106}
+	blocks[106] = client.Block{
+		Number:            106,
+		Hash:              "0xb106",
+		TokenTransfers:    []storage.TokenTransfer{transfer},
+		NftTransfers:      []storage.NftTransfer{nftTransfer},
+		InternalTransfers: []storage.InternalTransfer{internalTransfer},
 	}
+	// the new blocks are fetched with a single batch request
+	mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{101, 102, 103, 104, 105, 106}).Return(blocks, nil)
+	mockStorage.EXPECT().AddTransactions()
+	mockStorage.EXPECT().AddTokenTransfers(transfer)
+	mockStorage.EXPECT().AddNftTransfers(nftTransfer)
+	mockStorage.EXPECT().AddInternalTransfers(internalTransfer)
+	mockPublisher.EXPECT().Publish(events.Event{Type: events.BlockProcessed, BlockNum: 106, BlockHash: "0xb106"})
+
+	mockStorage.EXPECT().UpdateCurrentBlock(106)
+	mockPublisher.EXPECT().Publish(events.Event{Type: events.CursorAdvanced, BlockNum: 106})
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithPublisher(mockPublisher))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
 
-	mockStorage.EXPECT().UpdateCurrentBlock(105)
+	ethParser.ProcessNewBlocks(ctx)
+}
 
-	ethParser, _ := parser.NewEthParser(mockStorage, mockClient)
+func TestEthParser_ProcessNewBlocks_QueuesMatchesInOutbox(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+	mockOutbox := parser.NewMockOutbox(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+
+	tx := storage.Transaction{Hash: "tx101", BlockNum: 101}
+	match := storage.TransactionMatch{Transaction: tx, Addresses: []storage.Address{"0xaddress"}}
+	// the deliveries are queued before the cursor moves past the block
+	gomock.InOrder(
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(102, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(100),
+		mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{101, 102}).Return(map[int]client.Block{
+			101: {Number: 101, Transactions: []storage.Transaction{tx}},
+			102: {Number: 102},
+		}, nil),
+		mockStorage.EXPECT().AddTransactions(tx).Return([]storage.TransactionMatch{match}),
+		mockOutbox.EXPECT().QueueMatches(match),
+		// a block without matches queues nothing
+		mockStorage.EXPECT().AddTransactions().Return(nil),
+		mockStorage.EXPECT().UpdateCurrentBlock(102),
+	)
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithOutbox(mockOutbox))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
@@ -150,23 +529,301 @@ func TestEthParser_ProcessNewBlocks_ErrorFetchingBlock(t *testing.T) {
 	mockStorage := storage.NewMockStorage(ctrl)
 	mockClient := client.NewMockClient(ctrl)
 
-	mockClient.EXPECT().GetLatestBlockNumber().Return(100, nil)
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+
+	// the failed block keeps the cursor at 100, the blocks after it are not fetched again
+	gomock.InOrder(
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(105, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(100),
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(105, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(100),
+		mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{101}).Return(map[int]client.Block{
+			101: {Transactions: []storage.Transaction{{Hash: "tx101"}}},
+		}, nil),
+		mockStorage.EXPECT().UpdateCurrentBlock(105),
+	)
+
+	fetched := make(map[int]client.Block)
+	for i := 102; i <= 105; i++ {
+		fetched[i] = client.Block{Transactions: []storage.Transaction{{Hash: fmt.Sprintf("tx%d", i)}}}
+	}
+	mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{101, 102, 103, 104, 105}).Return(fetched, nil)
+	mockStorage.EXPECT().AddTransactions(gomock.Any()).Times(5)
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	ethParser.ProcessNewBlocks(ctx)
+	if pending := ethParser.GetPendingBlocks(); !reflect.DeepEqual(pending, []int{101}) {
+		t.Errorf("expected block 101 to be pending, got %v", pending)
+	}
+
+	ethParser.ProcessNewBlocks(ctx)
+	if pending := ethParser.GetPendingBlocks(); len(pending) != 0 {
+		t.Errorf("expected no pending blocks, got %v", pending)
+	}
+}
+
+func TestEthParser_ProcessNewBlocks_RetriedBlockIsNotParent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
 	mockStorage.EXPECT().UpdateCurrentBlock(100)
+
+	gomock.InOrder(
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(102, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(100),
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(102, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(100),
+		// the retried block 101 belongs to another chain than the ingested 102
+		mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{101}).Return(map[int]client.Block{
+			101: {Hash: "0xb101"},
+		}, nil),
+		mockStorage.EXPECT().RollbackBlock(102),
+		mockStorage.EXPECT().UpdateCurrentBlock(101),
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(102, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(101),
+		mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{102}).Return(map[int]client.Block{
+			102: {Hash: "0xb102", ParentHash: "0xb101"},
+		}, nil),
+		mockStorage.EXPECT().UpdateCurrentBlock(102),
+	)
+
+	mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{101, 102}).Return(map[int]client.Block{
+		102: {Hash: "0xa102", ParentHash: "0xa101"},
+	}, nil)
+	mockStorage.EXPECT().AddTransactions().Times(3)
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	ethParser.ProcessNewBlocks(ctx)
+	ethParser.ProcessNewBlocks(ctx)
+	ethParser.ProcessNewBlocks(ctx)
+}
+
+func TestEthParser_ProcessNewBlocks_CatchUpInBatches(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(1000, nil)
 	mockStorage.EXPECT().GetCurrentBlock().Return(100)
-	mockClient.EXPECT().GetLatestBlockNumber().Return(105, nil)
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(1000, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(100)
+
+	// every batch request asks for at most 100 blocks
+	mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), gomock.Len(100)).DoAndReturn(blocksOf()).Times(9)
+	mockStorage.EXPECT().AddTransactions().Times(900)
+	gomock.InOrder(
+		mockStorage.EXPECT().UpdateCurrentBlock(600),
+		mockStorage.EXPECT().UpdateCurrentBlock(1000),
+	)
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ethParser.ProcessNewBlocks(ctx)
+}
+
+func TestEthParser_ProcessNewBlocks_BlockKeepsFailing(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+
+	gomock.InOrder(
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(110, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(100),
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(650, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(100),
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(700, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(100),
+	)
+
+	// block 101 fails on every run, the blocks after it are fetched once
+	// until ingestion stops behind it
+	var fetchedMu sync.Mutex
+	fetched := make(map[int]int)
+	mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(ctx context.Context, blockNums []int) (map[int]client.Block, error) {
+			fetchedMu.Lock()
+			defer fetchedMu.Unlock()
+			for _, blockNum := range blockNums {
+				fetched[blockNum]++
+			}
+			return blocksOf(101)(ctx, blockNums)
+		}).AnyTimes()
+	mockStorage.EXPECT().AddTransactions().Times(62)
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ethParser.ProcessNewBlocks(ctx)
+	ethParser.ProcessNewBlocks(ctx)
+	ethParser.ProcessNewBlocks(ctx)
+
+	if fetched[101] != 3 {
+		t.Errorf("expected block 101 to be retried on every run, fetched %d times", fetched[101])
+	}
+	for blockNum := 102; blockNum <= 163; blockNum++ {
+		if fetched[blockNum] != 1 {
+			t.Errorf("expected block %d to be fetched once, got %d", blockNum, fetched[blockNum])
+		}
+	}
+	// the parent and child of block 101 stay tracked to check it once it succeeds
+	for blockNum := 164; blockNum <= 700; blockNum++ {
+		if fetched[blockNum] > 1 {
+			t.Errorf("expected block %d past the ingest limit to be fetched at most once, got %d", blockNum, fetched[blockNum])
+		}
+	}
+	if pending := ethParser.GetPendingBlocks(); !reflect.DeepEqual(pending, []int{101}) {
+		t.Errorf("expected block 101 to be pending, got %v", pending)
+	}
+}
 
-	mockClient.EXPECT().GetBlockByNumber(101).Return(client.Block{}, errors.New("block fetch error")).Times(1)
-	mockClient.EXPECT().GetBlockByNumber(gomock.Any()).Return(client.Block{
-		Transactions: []storage.Transaction{{Hash: "tx"}},
-	}, nil).AnyTimes()
+func TestEthParser_ProcessNewBlocks_Reorg(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
 
-	mockStorage.EXPECT().AddTransactions(gomock.Any()).AnyTimes()
-	mockStorage.EXPECT().UpdateCurrentBlock(105)
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+	mockPublisher := parser.NewMockPublisher(ctrl)
 
-	ethParser, _ := parser.NewEthParser(mockStorage, mockClient)
+	orphanedTx := storage.Transaction{Hash: "orphaned", BlockNum: 101}
+	canonicalTx := storage.Transaction{Hash: "canonical", BlockNum: 101}
+	newTx := storage.Transaction{Hash: "new", BlockNum: 102}
+	watched := []storage.Address{"0xaddress"}
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+
+	gomock.InOrder(
+		// first tick ingests the block that later gets orphaned
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(101, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(100),
+		mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{101}).Return(map[int]client.Block{
+			101: {Number: 101, Hash: "0xa101", ParentHash: "0x100", Transactions: []storage.Transaction{orphanedTx}},
+		}, nil),
+		mockStorage.EXPECT().AddTransactions(orphanedTx).Return([]storage.TransactionMatch{{Transaction: orphanedTx, Addresses: watched}}),
+		mockPublisher.EXPECT().Publish(events.Event{Type: events.TxMatched, BlockNum: 101, BlockHash: "0xa101", Transaction: orphanedTx, Addresses: watched}),
+		mockPublisher.EXPECT().Publish(events.Event{Type: events.BlockProcessed, BlockNum: 101, BlockHash: "0xa101"}),
+		mockStorage.EXPECT().UpdateCurrentBlock(101),
+		mockPublisher.EXPECT().Publish(events.Event{Type: events.CursorAdvanced, BlockNum: 101}),
+
+		// second tick sees a block whose parent is not the tracked 101
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(102, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(101),
+		mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{102}).Return(map[int]client.Block{
+			102: {Number: 102, Hash: "0xb102", ParentHash: "0xb101", Transactions: []storage.Transaction{newTx}},
+		}, nil),
+		mockClient.EXPECT().GetBlockByNumber(gomock.Any(), 101).Return(client.Block{
+			Number: 101, Hash: "0xb101", ParentHash: "0x100", Transactions: []storage.Transaction{canonicalTx},
+		}, nil),
+		// the reorg is published before the canonical block replacing the orphaned one
+		mockPublisher.EXPECT().Publish(events.Event{Type: events.Reorg, BlockNum: 101, ToBlock: 101}),
+		mockStorage.EXPECT().RollbackBlock(101),
+		// the canonical transaction touches no subscribed address, so it is not published
+		mockStorage.EXPECT().AddTransactions(canonicalTx).Return(nil),
+		mockPublisher.EXPECT().Publish(events.Event{Type: events.BlockProcessed, BlockNum: 101, BlockHash: "0xb101"}),
+		mockStorage.EXPECT().AddTransactions(newTx).Return([]storage.TransactionMatch{{Transaction: newTx, Addresses: watched}}),
+		mockPublisher.EXPECT().Publish(events.Event{Type: events.TxMatched, BlockNum: 102, BlockHash: "0xb102", Transaction: newTx, Addresses: watched}),
+		mockPublisher.EXPECT().Publish(events.Event{Type: events.BlockProcessed, BlockNum: 102, BlockHash: "0xb102"}),
+		mockStorage.EXPECT().UpdateCurrentBlock(102),
+		mockPublisher.EXPECT().Publish(events.Event{Type: events.CursorAdvanced, BlockNum: 102}),
+	)
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient, parser.WithPublisher(mockPublisher))
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
 	ethParser.ProcessNewBlocks(ctx)
+	ethParser.ProcessNewBlocks(ctx)
+}
+
+func TestEthParser_ProcessNewBlocks_ReorgDoesNotHoldUpSubscribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockStorage := storage.NewMockStorage(ctrl)
+	mockClient := client.NewMockClient(ctrl)
+
+	mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(100, nil)
+	mockStorage.EXPECT().GetCurrentBlock().Return(0)
+	mockStorage.EXPECT().UpdateCurrentBlock(100)
+
+	ethParser, _ := parser.NewEthParser(context.Background(), mockStorage, mockClient)
+
+	gomock.InOrder(
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(101, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(100),
+		mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{101}).Return(map[int]client.Block{
+			101: {Number: 101, Hash: "0xa101", ParentHash: "0x100"},
+		}, nil),
+		mockStorage.EXPECT().UpdateCurrentBlock(101),
+		mockClient.EXPECT().GetLatestBlockNumber(gomock.Any()).Return(102, nil),
+		mockStorage.EXPECT().GetCurrentBlock().Return(101),
+		mockClient.EXPECT().GetBlocksByNumber(gomock.Any(), []int{102}).Return(map[int]client.Block{
+			102: {Number: 102, Hash: "0xb102", ParentHash: "0xb101"},
+		}, nil),
+		// an address is subscribed while the canonical ancestor is fetched
+		mockClient.EXPECT().GetBlockByNumber(gomock.Any(), 101).DoAndReturn(func(context.Context, int) (client.Block, error) {
+			subscribed := make(chan bool)
+			go func() { subscribed <- ethParser.Subscribe(storage.Subscription{Address: "0xaddress", StartBlock: -1}) }()
+			select {
+			case <-subscribed:
+			case <-time.After(time.Second):
+				t.Error("expected the subscription not to wait for the reorg")
+			}
+			return client.Block{Number: 101, Hash: "0xb101", ParentHash: "0x100"}, nil
+		}),
+		mockStorage.EXPECT().RollbackBlock(101),
+		mockStorage.EXPECT().UpdateCurrentBlock(102),
+	)
+	mockStorage.EXPECT().AddSubscription(gomock.Any()).Return(true)
+	mockStorage.EXPECT().AddTransactions().Times(3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ethParser.ProcessNewBlocks(ctx)
+	ethParser.ProcessNewBlocks(ctx)
+}
+
+// blocksOf answers GetBlocksByNumber with an empty block for every requested
+// block but the failed ones, which are left out like the client does.
+func blocksOf(failed ...int) func(context.Context, []int) (map[int]client.Block, error) {
+	return func(_ context.Context, blockNums []int) (map[int]client.Block, error) {
+		blocks := make(map[int]client.Block)
+		for _, blockNum := range blockNums {
+			if !slices.Contains(failed, blockNum) {
+				blocks[blockNum] = client.Block{}
+			}
+		}
+		return blocks, nil
+	}
 }
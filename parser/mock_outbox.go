@@ -0,0 +1,51 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/oanatmaria/ethblkcn-observer/parser (interfaces: Outbox)
+
+// Package parser is a generated GoMock package.
+package parser
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+	storage "github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+// MockOutbox is a mock of Outbox interface.
+type MockOutbox struct {
+	ctrl     *gomock.Controller
+	recorder *MockOutboxMockRecorder
+}
+
+// MockOutboxMockRecorder is the mock recorder for MockOutbox.
+type MockOutboxMockRecorder struct {
+	mock *MockOutbox
+}
+
+// NewMockOutbox creates a new mock instance.
+func NewMockOutbox(ctrl *gomock.Controller) *MockOutbox {
+	mock := &MockOutbox{ctrl: ctrl}
+	mock.recorder = &MockOutboxMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockOutbox) EXPECT() *MockOutboxMockRecorder {
+	return m.recorder
+}
+
+// QueueMatches mocks base method.
+func (m *MockOutbox) QueueMatches(arg0 ...storage.TransactionMatch) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "QueueMatches", varargs...)
+}
+
+// QueueMatches indicates an expected call of QueueMatches.
+func (mr *MockOutboxMockRecorder) QueueMatches(arg0 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueueMatches", reflect.TypeOf((*MockOutbox)(nil).QueueMatches), arg0...)
+}
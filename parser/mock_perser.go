@@ -35,6 +35,35 @@ func (m *MockParser) EXPECT() *MockParserMockRecorder {
 	return m.recorder
 }
 
+// Backfill mocks base method.
+func (m *MockParser) Backfill(arg0 storage.Address, arg1 int) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Backfill", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Backfill indicates an expected call of Backfill.
+func (mr *MockParserMockRecorder) Backfill(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Backfill", reflect.TypeOf((*MockParser)(nil).Backfill), arg0, arg1)
+}
+
+// GetBackfillStatus mocks base method.
+func (m *MockParser) GetBackfillStatus(arg0 storage.Address) (storage.BackfillJob, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBackfillStatus", arg0)
+	ret0, _ := ret[0].(storage.BackfillJob)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetBackfillStatus indicates an expected call of GetBackfillStatus.
+func (mr *MockParserMockRecorder) GetBackfillStatus(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBackfillStatus", reflect.TypeOf((*MockParser)(nil).GetBackfillStatus), arg0)
+}
+
 // GetCurrentBlock mocks base method.
 func (m *MockParser) GetCurrentBlock() int {
 	m.ctrl.T.Helper()
@@ -49,8 +78,92 @@ func (mr *MockParserMockRecorder) GetCurrentBlock() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrentBlock", reflect.TypeOf((*MockParser)(nil).GetCurrentBlock))
 }
 
+// GetInternalTransfers mocks base method.
+func (m *MockParser) GetInternalTransfers(arg0 storage.Address) []storage.InternalTransfer {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInternalTransfers", arg0)
+	ret0, _ := ret[0].([]storage.InternalTransfer)
+	return ret0
+}
+
+// GetInternalTransfers indicates an expected call of GetInternalTransfers.
+func (mr *MockParserMockRecorder) GetInternalTransfers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInternalTransfers", reflect.TypeOf((*MockParser)(nil).GetInternalTransfers), arg0)
+}
+
+// GetLastIngestedBlock mocks base method.
+func (m *MockParser) GetLastIngestedBlock() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetLastIngestedBlock")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GetLastIngestedBlock indicates an expected call of GetLastIngestedBlock.
+func (mr *MockParserMockRecorder) GetLastIngestedBlock() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetLastIngestedBlock", reflect.TypeOf((*MockParser)(nil).GetLastIngestedBlock))
+}
+
+// GetNftTransfers mocks base method.
+func (m *MockParser) GetNftTransfers(arg0 storage.Address) []storage.NftTransfer {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNftTransfers", arg0)
+	ret0, _ := ret[0].([]storage.NftTransfer)
+	return ret0
+}
+
+// GetNftTransfers indicates an expected call of GetNftTransfers.
+func (mr *MockParserMockRecorder) GetNftTransfers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNftTransfers", reflect.TypeOf((*MockParser)(nil).GetNftTransfers), arg0)
+}
+
+// GetPendingBlocks mocks base method.
+func (m *MockParser) GetPendingBlocks() []int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPendingBlocks")
+	ret0, _ := ret[0].([]int)
+	return ret0
+}
+
+// GetPendingBlocks indicates an expected call of GetPendingBlocks.
+func (mr *MockParserMockRecorder) GetPendingBlocks() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingBlocks", reflect.TypeOf((*MockParser)(nil).GetPendingBlocks))
+}
+
+// GetSubscriptions mocks base method.
+func (m *MockParser) GetSubscriptions() []storage.Subscription {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSubscriptions")
+	ret0, _ := ret[0].([]storage.Subscription)
+	return ret0
+}
+
+// GetSubscriptions indicates an expected call of GetSubscriptions.
+func (mr *MockParserMockRecorder) GetSubscriptions() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscriptions", reflect.TypeOf((*MockParser)(nil).GetSubscriptions))
+}
+
+// GetTokenTransfers mocks base method.
+func (m *MockParser) GetTokenTransfers(arg0 storage.Address) []storage.TokenTransfer {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTokenTransfers", arg0)
+	ret0, _ := ret[0].([]storage.TokenTransfer)
+	return ret0
+}
+
+// GetTokenTransfers indicates an expected call of GetTokenTransfers.
+func (mr *MockParserMockRecorder) GetTokenTransfers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTokenTransfers", reflect.TypeOf((*MockParser)(nil).GetTokenTransfers), arg0)
+}
+
 // GetTransactions mocks base method.
-func (m *MockParser) GetTransactions(arg0 string) []storage.Transaction {
+func (m *MockParser) GetTransactions(arg0 storage.Address) []storage.Transaction {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetTransactions", arg0)
 	ret0, _ := ret[0].([]storage.Transaction)
@@ -63,6 +176,18 @@ func (mr *MockParserMockRecorder) GetTransactions(arg0 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransactions", reflect.TypeOf((*MockParser)(nil).GetTransactions), arg0)
 }
 
+// ProcessBackfills mocks base method.
+func (m *MockParser) ProcessBackfills(arg0 context.Context) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "ProcessBackfills", arg0)
+}
+
+// ProcessBackfills indicates an expected call of ProcessBackfills.
+func (mr *MockParserMockRecorder) ProcessBackfills(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessBackfills", reflect.TypeOf((*MockParser)(nil).ProcessBackfills), arg0)
+}
+
 // ProcessNewBlocks mocks base method.
 func (m *MockParser) ProcessNewBlocks(arg0 context.Context) {
 	m.ctrl.T.Helper()
@@ -75,8 +200,22 @@ func (mr *MockParserMockRecorder) ProcessNewBlocks(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ProcessNewBlocks", reflect.TypeOf((*MockParser)(nil).ProcessNewBlocks), arg0)
 }
 
+// QueryTransactions mocks base method.
+func (m *MockParser) QueryTransactions(arg0 storage.Address, arg1 storage.TransactionQuery, arg2 string) storage.TransactionPage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryTransactions", arg0, arg1, arg2)
+	ret0, _ := ret[0].(storage.TransactionPage)
+	return ret0
+}
+
+// QueryTransactions indicates an expected call of QueryTransactions.
+func (mr *MockParserMockRecorder) QueryTransactions(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryTransactions", reflect.TypeOf((*MockParser)(nil).QueryTransactions), arg0, arg1, arg2)
+}
+
 // Subscribe mocks base method.
-func (m *MockParser) Subscribe(arg0 string) bool {
+func (m *MockParser) Subscribe(arg0 storage.Subscription) bool {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Subscribe", arg0)
 	ret0, _ := ret[0].(bool)
@@ -88,3 +227,17 @@ func (mr *MockParserMockRecorder) Subscribe(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Subscribe", reflect.TypeOf((*MockParser)(nil).Subscribe), arg0)
 }
+
+// Unsubscribe mocks base method.
+func (m *MockParser) Unsubscribe(arg0 storage.Address, arg1 bool) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Unsubscribe", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Unsubscribe indicates an expected call of Unsubscribe.
+func (mr *MockParserMockRecorder) Unsubscribe(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Unsubscribe", reflect.TypeOf((*MockParser)(nil).Unsubscribe), arg0, arg1)
+}
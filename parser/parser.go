@@ -3,6 +3,7 @@ package parser
 import (
 	"context"
 
+	"github.com/oanatmaria/ethblkcn-observer/events"
 	"github.com/oanatmaria/ethblkcn-observer/storage"
 )
 
@@ -11,10 +12,50 @@ import (
 type Parser interface {
 	// last parsed block
 	GetCurrentBlock() int
-	// add address to observer
-	Subscribe(address string) bool
+	// last block ingested, ahead of the current block while an earlier one is retried
+	GetLastIngestedBlock() int
+	// add address to observer, a negative StartBlock starts after the last ingested block
+	Subscribe(subscription storage.Subscription) bool
+	// remove address from observer, purge drops the records stored for it
+	Unsubscribe(address storage.Address, purge bool) bool
+	GetSubscriptions() []storage.Subscription
 	// list of inbound or outbound transactions for an address
-	GetTransactions(address string) []storage.Transaction
+	GetTransactions(address storage.Address) []storage.Transaction
+	// page of the transactions of an address matching the query, only the ones
+	// with the given confirmation status when it is not empty
+	QueryTransactions(address storage.Address, query storage.TransactionQuery, status string) storage.TransactionPage
+	// list of inbound or outbound ERC-20 transfers for an address
+	GetTokenTransfers(address storage.Address) []storage.TokenTransfer
+	// list of inbound or outbound ERC-721 and ERC-1155 transfers for an address
+	GetNftTransfers(address storage.Address) []storage.NftTransfer
+	// list of ETH moved to or from an address by calls made by contracts
+	GetInternalTransfers(address storage.Address) []storage.InternalTransfer
 
 	ProcessNewBlocks(ctx context.Context)
+	// blocks that failed to be processed and are retried on the next run
+	GetPendingBlocks() []int
+
+	// schedule a scan of the blocks from fromBlock up to the last ingested block for an address
+	Backfill(address storage.Address, fromBlock int) error
+	// progress of the backfill scheduled for an address
+	GetBackfillStatus(address storage.Address) (storage.BackfillJob, bool)
+	// advance every unfinished backfill job by one batch of blocks
+	ProcessBackfills(ctx context.Context)
+}
+
+//go:generate mockgen -destination=mock_outbox.go -package=parser github.com/oanatmaria/ethblkcn-observer/parser Outbox
+
+// Outbox queues the deliveries of the transactions matched by a block. It is
+// called while the block is ingested, before the cursor can move past it, so
+// a crash never loses a delivery of a block counted as processed.
+type Outbox interface {
+	QueueMatches(matches ...storage.TransactionMatch)
+}
+
+//go:generate mockgen -destination=mock_publisher.go -package=parser github.com/oanatmaria/ethblkcn-observer/parser Publisher
+
+// Publisher receives the events of the parser, an events.Bus fans them out to
+// its consumers.
+type Publisher interface {
+	Publish(event events.Event)
 }
@@ -5,37 +5,133 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
-	"regexp"
+	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/oanatmaria/ethblkcn-observer/client"
+	"github.com/oanatmaria/ethblkcn-observer/events"
 	"github.com/oanatmaria/ethblkcn-observer/parser"
+	"github.com/oanatmaria/ethblkcn-observer/storage"
 )
 
 type HttpServer struct {
-	parser parser.Parser
-	addr   string
-	server *http.Server
+	parser         parser.Parser
+	addr           string
+	server         *http.Server
+	healthReporter HealthReporter
+	headSource     HeadSource
+	webhooks       Webhooks
+	events         *events.Bus
 }
 
-func NewHttpServer(addr string, parser parser.Parser) Server {
-	return &HttpServer{
+// HealthReporter reports the health of the RPC endpoints used by the parser.
+type HealthReporter interface {
+	EndpointHealth() []client.EndpointHealth
+}
+
+// HeadSource reports new chain heads as soon as the node sees them.
+type HeadSource interface {
+	Run(ctx context.Context, heads chan<- int)
+	Connected() bool
+}
+
+// Webhooks delivers the transactions matched by subscriptions to their webhook.
+type Webhooks interface {
+	Run(ctx context.Context)
+	GetDeliveries(address storage.Address) []storage.WebhookDelivery
+	Redeliver(id string) (storage.WebhookDelivery, bool)
+}
+
+type Option func(*HttpServer)
+
+// WithHealthReporter exposes the health of the RPC endpoints on GET /health.
+func WithHealthReporter(reporter HealthReporter) Option {
+	return func(s *HttpServer) {
+		s.healthReporter = reporter
+	}
+}
+
+// WithHeadSource processes blocks as soon as a new head arrives instead of
+// polling, the polling is only kept while the source is disconnected.
+func WithHeadSource(source HeadSource) Option {
+	return func(s *HttpServer) {
+		s.headSource = source
+	}
+}
+
+// WithWebhooks lets subscriptions register a webhook and exposes the
+// deliveries on /deliveries.
+func WithWebhooks(webhooks Webhooks) Option {
+	return func(s *HttpServer) {
+		s.webhooks = webhooks
+	}
+}
+
+// WithEventBus pushes the events published by the parser to the clients of
+// GET /stream and GET /ws.
+func WithEventBus(bus *events.Bus) Option {
+	return func(s *HttpServer) {
+		s.events = bus
+	}
+}
+
+func NewHttpServer(addr string, parser parser.Parser, opts ...Option) Server {
+	s := &HttpServer{
 		parser: parser,
 		addr:   addr,
 	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
+const (
+	blockProcessingInterval    = 10 * time.Second
+	backfillProcessingInterval = time.Second
+	maxLabelLength             = 100
+	// page size of GET /transactions when a cursor is given without a limit,
+	// and the largest limit, without either every transaction is returned
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
 func (s *HttpServer) Start(ctx context.Context) error {
 	go s.startBlockProcessing(ctx)
+	go s.startBackfillProcessing(ctx)
 
 	mux := http.NewServeMux()
 	mux.HandleFunc("POST /subscribe", s.wrapHandler(s.handleSubscribe))
+	mux.HandleFunc("DELETE /subscribe", s.wrapHandler(s.handleUnsubscribe))
+	mux.HandleFunc("GET /subscriptions", s.wrapHandler(s.handleSubscriptions))
 	mux.HandleFunc("GET /transactions", s.wrapHandler(s.handleTransactions))
+	mux.HandleFunc("GET /token_transfers", s.wrapHandler(s.handleTokenTransfers))
+	mux.HandleFunc("GET /nft_transfers", s.wrapHandler(s.handleNftTransfers))
+	mux.HandleFunc("GET /internal_transfers", s.wrapHandler(s.handleInternalTransfers))
 	mux.HandleFunc("GET /current_block", s.wrapHandler(s.handleCurrentBlock))
+	mux.HandleFunc("GET /pending_blocks", s.wrapHandler(s.handlePendingBlocks))
+	mux.HandleFunc("GET /backfill", s.wrapHandler(s.handleBackfillStatus))
+	if s.healthReporter != nil {
+		mux.HandleFunc("GET /health", s.wrapHandler(s.handleHealth))
+	}
+	if s.webhooks != nil {
+		go s.webhooks.Run(ctx)
+		mux.HandleFunc("GET /deliveries", s.wrapHandler(s.handleDeliveries))
+		mux.HandleFunc("POST /deliveries/redeliver", s.wrapHandler(s.handleRedeliver))
+	}
+	if s.events != nil {
+		mux.HandleFunc("GET /stream", s.wrapHandler(s.handleStream))
+		mux.HandleFunc("GET /ws", s.wrapHandler(s.handleWebSocket))
+	}
 
 	s.server = &http.Server{
 		Addr:    s.addr,
 		Handler: mux,
+		// requests are cancelled on shutdown, so open streams do not hold it up
+		BaseContext: func(net.Listener) context.Context { return ctx },
 	}
 
 	go func() {
@@ -53,18 +149,50 @@ func (s *HttpServer) Start(ctx context.Context) error {
 }
 
 func (s *HttpServer) startBlockProcessing(ctx context.Context) {
-	ticker := time.NewTicker(10 * time.Second)
+	ticker := time.NewTicker(blockProcessingInterval)
 	defer ticker.Stop()
 
+	// without a head source the channel stays nil and only the ticker fires
+	var heads chan int
+	if s.headSource != nil {
+		heads = make(chan int, 1)
+		go s.headSource.Run(ctx, heads)
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
 			log.Println("Stopping block processing...")
 			return
+		case head := <-heads:
+			log.Printf("Processing blocks up to new head %d...\n", head)
+			s.processNewBlocks(ctx)
 		case <-ticker.C:
+			if s.headSource != nil && s.headSource.Connected() {
+				continue
+			}
 			log.Println("Processing blocks...")
-			s.parser.ProcessNewBlocks(ctx)
-			log.Println("Done processing latest blocks...")
+			s.processNewBlocks(ctx)
+		}
+	}
+}
+
+func (s *HttpServer) processNewBlocks(ctx context.Context) {
+	s.parser.ProcessNewBlocks(ctx)
+	log.Println("Done processing latest blocks...")
+}
+
+func (s *HttpServer) startBackfillProcessing(ctx context.Context) {
+	ticker := time.NewTicker(backfillProcessingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Stopping backfill processing...")
+			return
+		case <-ticker.C:
+			s.parser.ProcessBackfills(ctx)
 		}
 	}
 }
@@ -86,39 +214,207 @@ func (s *HttpServer) wrapHandler(handler func(http.ResponseWriter, *http.Request
 }
 
 func (s *HttpServer) handleSubscribe(w http.ResponseWriter, r *http.Request) error {
-	address := r.URL.Query().Get("address")
-	if address == "" {
-		http.Error(w, "Missing address parameter", http.StatusBadRequest)
+	address, ok := addressParam(w, r)
+	if !ok {
 		return nil
 	}
 
-	if !isValidEthAddress(address) {
-		http.Error(w, "Invalid Ethereum address", http.StatusBadRequest)
+	fromBlock := -1
+	if fromBlockParam := r.URL.Query().Get("fromBlock"); fromBlockParam != "" {
+		parsed, err := strconv.Atoi(fromBlockParam)
+		// checked against the same block as Backfill, so a subscription is not
+		// added for a backfill that is then refused
+		if err != nil || parsed < 0 || parsed > s.parser.GetLastIngestedBlock() {
+			http.Error(w, "Invalid fromBlock parameter", http.StatusBadRequest)
+			return nil
+		}
+		fromBlock = parsed
+	}
+
+	label := r.URL.Query().Get("label")
+	if len(label) > maxLabelLength {
+		http.Error(w, fmt.Sprintf("Label longer than %d characters", maxLabelLength), http.StatusBadRequest)
 		return nil
 	}
 
-	subscribed := s.parser.Subscribe(address)
-	if subscribed {
-		w.WriteHeader(http.StatusOK)
-		if _, err := fmt.Fprintf(w, "Subscribed to address: %s\n", address); err != nil {
-			log.Printf("Error writing response: %v", err)
+	webhookURL := r.URL.Query().Get("webhookUrl")
+	if webhookURL != "" {
+		if s.webhooks == nil {
+			http.Error(w, "Webhooks are not enabled", http.StatusBadRequest)
+			return nil
 		}
-	} else {
+		if !isValidWebhookURL(webhookURL) {
+			http.Error(w, "Invalid webhookUrl parameter", http.StatusBadRequest)
+			return nil
+		}
+	}
+
+	subscribed := s.parser.Subscribe(storage.Subscription{
+		Address:    address,
+		Label:      label,
+		StartBlock: fromBlock,
+		WebhookURL: webhookURL,
+	})
+	if !subscribed {
 		http.Error(w, fmt.Sprintf("Address already subscribed: %s", address), http.StatusBadRequest)
+		return nil
+	}
+
+	if fromBlock >= 0 {
+		if err := s.parser.Backfill(address, fromBlock); err != nil {
+			return fmt.Errorf("subscribed to address %s but failed to schedule backfill: %v", address, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "Subscribed to address: %s\n", address); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+	return nil
+}
+
+func (s *HttpServer) handleUnsubscribe(w http.ResponseWriter, r *http.Request) error {
+	address, ok := addressParam(w, r)
+	if !ok {
+		return nil
+	}
+
+	purge := false
+	if purgeParam := r.URL.Query().Get("purge"); purgeParam != "" {
+		parsed, err := strconv.ParseBool(purgeParam)
+		if err != nil {
+			http.Error(w, "Invalid purge parameter", http.StatusBadRequest)
+			return nil
+		}
+		purge = parsed
+	}
+
+	if !s.parser.Unsubscribe(address, purge) {
+		http.Error(w, fmt.Sprintf("Address not subscribed: %s", address), http.StatusNotFound)
+		return nil
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if _, err := fmt.Fprintf(w, "Unsubscribed from address: %s\n", address); err != nil {
+		log.Printf("Error writing response: %v", err)
 	}
 	return nil
 }
 
+func (s *HttpServer) handleSubscriptions(w http.ResponseWriter, r *http.Request) error {
+	subscriptions := s.parser.GetSubscriptions()
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(subscriptions)
+}
+
 func (s *HttpServer) handleTransactions(w http.ResponseWriter, r *http.Request) error {
-	address := r.URL.Query().Get("address")
-	if address == "" {
-		http.Error(w, "Missing address parameter", http.StatusBadRequest)
+	address, status, ok := statusParams(w, r)
+	if !ok {
+		return nil
+	}
+
+	amounts, ok := parseAmountParams(r)
+	if !ok {
+		http.Error(w, "Invalid unit or minValue parameter", http.StatusBadRequest)
+		return nil
+	}
+
+	query, ok := transactionQueryParams(w, r)
+	if !ok {
 		return nil
 	}
+	query.MinValue = amounts.minValue
 
-	transactions := s.parser.GetTransactions(address)
+	page := s.parser.QueryTransactions(address, query, status)
+	transactions := page.Transactions
+	if transactions == nil {
+		transactions = []storage.Transaction{}
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	if page.Next != nil {
+		w.Header().Set("X-Next-Cursor", page.Next.String())
+	}
 	w.Header().Set("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(transactions)
+	if amounts.unit == "" {
+		return json.NewEncoder(w).Encode(transactions)
+	}
+	views := make([]transactionView, len(transactions))
+	for i, tx := range transactions {
+		views[i] = transactionView{Transaction: tx, Formatted: &formattedAmounts{
+			Unit:  amounts.unit,
+			Value: tx.Value.Format(amounts.decimals),
+			Fee:   tx.Fee.Format(amounts.decimals),
+		}}
+	}
+	return json.NewEncoder(w).Encode(views)
+}
+
+func (s *HttpServer) handleTokenTransfers(w http.ResponseWriter, r *http.Request) error {
+	return handleRecords(w, r, s.parser.GetTokenTransfers, func(transfer storage.TokenTransfer) string {
+		return transfer.ConfirmationStatus
+	})
+}
+
+func (s *HttpServer) handleNftTransfers(w http.ResponseWriter, r *http.Request) error {
+	return handleRecords(w, r, s.parser.GetNftTransfers, func(transfer storage.NftTransfer) string {
+		return transfer.ConfirmationStatus
+	})
+}
+
+// handleRecords answers with the records of the address, only the ones with
+// the confirmation status when one is given.
+func handleRecords[T any](w http.ResponseWriter, r *http.Request, get func(storage.Address) []T, statusOf func(T) string) error {
+	address, status, ok := statusParams(w, r)
+	if !ok {
+		return nil
+	}
+
+	records := get(address)
+	if status != "" {
+		records = filterByStatus(records, status, statusOf)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(records)
+}
+
+func (s *HttpServer) handleInternalTransfers(w http.ResponseWriter, r *http.Request) error {
+	address, status, ok := statusParams(w, r)
+	if !ok {
+		return nil
+	}
+
+	amounts, ok := parseAmountParams(r)
+	if !ok {
+		http.Error(w, "Invalid unit or minValue parameter", http.StatusBadRequest)
+		return nil
+	}
+
+	transfers := s.parser.GetInternalTransfers(address)
+	if status != "" {
+		transfers = filterByStatus(transfers, status, func(transfer storage.InternalTransfer) string {
+			return transfer.ConfirmationStatus
+		})
+	}
+	if amounts.minValue.IsSet() {
+		transfers = filterByMinValue(transfers, amounts.minValue, func(transfer storage.InternalTransfer) storage.Quantity {
+			return transfer.Value
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if amounts.unit == "" {
+		return json.NewEncoder(w).Encode(transfers)
+	}
+	views := make([]internalTransferView, len(transfers))
+	for i, transfer := range transfers {
+		views[i] = internalTransferView{InternalTransfer: transfer, Formatted: &formattedAmounts{
+			Unit:  amounts.unit,
+			Value: transfer.Value.Format(amounts.decimals),
+		}}
+	}
+	return json.NewEncoder(w).Encode(views)
 }
 
 func (s *HttpServer) handleCurrentBlock(w http.ResponseWriter, r *http.Request) error {
@@ -127,8 +423,281 @@ func (s *HttpServer) handleCurrentBlock(w http.ResponseWriter, r *http.Request)
 	return json.NewEncoder(w).Encode(currentBlock)
 }
 
+func (s *HttpServer) handlePendingBlocks(w http.ResponseWriter, r *http.Request) error {
+	pendingBlocks := s.parser.GetPendingBlocks()
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(pendingBlocks)
+}
+
+type backfillStatus struct {
+	storage.BackfillJob
+	// percentage of the requested range that was already scanned
+	Progress float64
+}
+
+func (s *HttpServer) handleBackfillStatus(w http.ResponseWriter, r *http.Request) error {
+	address, ok := addressParam(w, r)
+	if !ok {
+		return nil
+	}
+
+	job, exists := s.parser.GetBackfillStatus(address)
+	if !exists {
+		http.Error(w, fmt.Sprintf("No backfill for address: %s", address), http.StatusNotFound)
+		return nil
+	}
+
+	scanned := job.NextBlock - job.FromBlock
+	total := job.ToBlock - job.FromBlock + 1
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(backfillStatus{
+		BackfillJob: job,
+		Progress:    float64(scanned) * 100 / float64(total),
+	})
+}
+
+type healthStatus struct {
+	Healthy   bool
+	Endpoints []client.EndpointHealth
+}
+
+func (s *HttpServer) handleDeliveries(w http.ResponseWriter, r *http.Request) error {
+	address, ok := addressParam(w, r)
+	if !ok {
+		return nil
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && !isValidDeliveryStatus(status) {
+		http.Error(w, "Invalid status parameter", http.StatusBadRequest)
+		return nil
+	}
+
+	deliveries := s.webhooks.GetDeliveries(address)
+	if status != "" {
+		deliveries = filterByStatus(deliveries, status, func(delivery storage.WebhookDelivery) string { return delivery.Status })
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(deliveries)
+}
+
+func (s *HttpServer) handleRedeliver(w http.ResponseWriter, r *http.Request) error {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		return nil
+	}
+
+	delivery, exists := s.webhooks.Redeliver(id)
+	if !exists {
+		http.Error(w, fmt.Sprintf("No delivery with id: %s", id), http.StatusNotFound)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(delivery)
+}
+
+// handleHealth answers 503 when none of the RPC endpoints is healthy.
+func (s *HttpServer) handleHealth(w http.ResponseWriter, r *http.Request) error {
+	status := healthStatus{Endpoints: s.healthReporter.EndpointHealth()}
+	for _, endpoint := range status.Endpoints {
+		if endpoint.Healthy {
+			status.Healthy = true
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if !status.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return json.NewEncoder(w).Encode(status)
+}
+
+// amountParams are the unit and minValue query parameters of the endpoints
+// returning amounts of wei. minValue is given in unit, which defaults to wei.
+type amountParams struct {
+	unit     string
+	decimals int
+	minValue storage.Quantity
+}
+
+func parseAmountParams(r *http.Request) (amountParams, bool) {
+	var params amountParams
+	if params.unit = r.URL.Query().Get("unit"); params.unit != "" {
+		decimals, ok := storage.UnitDecimals(params.unit)
+		if !ok {
+			return amountParams{}, false
+		}
+		params.decimals = decimals
+	}
+	if minValue := r.URL.Query().Get("minValue"); minValue != "" {
+		parsed, err := storage.ParseAmount(minValue, params.decimals)
+		if err != nil {
+			return amountParams{}, false
+		}
+		params.minValue = parsed
+	}
+	return params, true
+}
+
+// formattedAmounts holds the amounts of a record in the unit asked for.
+type formattedAmounts struct {
+	Unit  string
+	Value string
+	Fee   string `json:",omitempty"`
+}
+
+type transactionView struct {
+	storage.Transaction
+	Formatted *formattedAmounts
+}
+
+type internalTransferView struct {
+	storage.InternalTransfer
+	Formatted *formattedAmounts
+}
+
+// transactionQueryParams reads the pagination, ordering and filters of GET
+// /transactions, it answers with a bad request when one is invalid.
+func transactionQueryParams(w http.ResponseWriter, r *http.Request) (storage.TransactionQuery, bool) {
+	params := r.URL.Query()
+	// filters on the envelope type in TxType, not on the kind of transaction in Type
+	query := storage.TransactionQuery{TxType: params.Get("txType")}
+
+	if params.Has("cursor") {
+		query.Limit = defaultPageSize
+	}
+	if limit := params.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > maxPageSize {
+			http.Error(w, "Invalid limit parameter", http.StatusBadRequest)
+			return storage.TransactionQuery{}, false
+		}
+		query.Limit = parsed
+	}
+
+	if cursor := params.Get("cursor"); cursor != "" {
+		parsed, err := storage.ParseTransactionCursor(cursor)
+		if err != nil {
+			http.Error(w, "Invalid cursor parameter", http.StatusBadRequest)
+			return storage.TransactionQuery{}, false
+		}
+		query.After = &parsed
+	}
+
+	blocks := []struct {
+		name  string
+		block *int
+	}{{"fromBlock", &query.FromBlock}, {"toBlock", &query.ToBlock}}
+	for _, param := range blocks {
+		if value := params.Get(param.name); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				http.Error(w, fmt.Sprintf("Invalid %s parameter", param.name), http.StatusBadRequest)
+				return storage.TransactionQuery{}, false
+			}
+			*param.block = parsed
+		}
+	}
+
+	switch direction := params.Get("direction"); direction {
+	case "", storage.DirectionIn, storage.DirectionOut:
+		query.Direction = direction
+	default:
+		http.Error(w, "Invalid direction parameter", http.StatusBadRequest)
+		return storage.TransactionQuery{}, false
+	}
+
+	switch params.Get("order") {
+	case "", "asc":
+	case "desc":
+		query.Descending = true
+	default:
+		http.Error(w, "Invalid order parameter", http.StatusBadRequest)
+		return storage.TransactionQuery{}, false
+	}
+	return query, true
+}
+
+func filterByMinValue[T any](records []T, minValue storage.Quantity, valueOf func(T) storage.Quantity) []T {
+	filtered := []T{}
+	for _, record := range records {
+		if valueOf(record).Cmp(minValue) >= 0 {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+func filterByStatus[T any](records []T, status string, statusOf func(T) string) []T {
+	filtered := []T{}
+	for _, record := range records {
+		if statusOf(record) == status {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// statusParams reads the address and the optional confirmation status, it
+// answers with a bad request when one is invalid.
+func statusParams(w http.ResponseWriter, r *http.Request) (storage.Address, string, bool) {
+	address, ok := addressParam(w, r)
+	if !ok {
+		return "", "", false
+	}
+
+	status := r.URL.Query().Get("status")
+	if status != "" && !isValidConfirmationStatus(status) {
+		http.Error(w, "Invalid status parameter", http.StatusBadRequest)
+		return "", "", false
+	}
+	return address, status, true
+}
+
+func isValidConfirmationStatus(status string) bool {
+	switch status {
+	case storage.StatusPendingConfirmation, storage.StatusConfirmed, storage.StatusFinalized:
+		return true
+	}
+	return false
+}
+
+// addressParam reads the address parameter in its canonical form, it answers
+// with a bad request when the address is missing or invalid.
+func addressParam(w http.ResponseWriter, r *http.Request) (storage.Address, bool) {
+	address := r.URL.Query().Get("address")
+	if address == "" {
+		http.Error(w, "Missing address parameter", http.StatusBadRequest)
+		return "", false
+	}
+
+	if !isValidEthAddress(address) {
+		http.Error(w, "Invalid Ethereum address", http.StatusBadRequest)
+		return "", false
+	}
+	return storage.NormalizeAddress(address), true
+}
+
+func isValidDeliveryStatus(status string) bool {
+	switch status {
+	case storage.DeliveryStatusPending, storage.DeliveryStatusDelivered, storage.DeliveryStatusFailed:
+		return true
+	}
+	return false
+}
+
+// isValidWebhookURL accepts absolute http and https URLs.
+func isValidWebhookURL(webhookURL string) bool {
+	parsed, err := url.Parse(webhookURL)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// isValidEthAddress accepts an address in a single case, or a mixed-case
+// address with a valid EIP-55 checksum.
 func isValidEthAddress(address string) bool {
-	regex := `^0x[0-9a-fA-F]{40}$`
-	matched, _ := regexp.MatchString(regex, address)
-	return matched
+	_, err := storage.ParseAddress(address)
+	return err == nil
 }
@@ -2,12 +2,19 @@ package server
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/golang/mock/gomock"
+	"github.com/oanatmaria/ethblkcn-observer/client"
 	"github.com/oanatmaria/ethblkcn-observer/parser"
 	"github.com/oanatmaria/ethblkcn-observer/storage"
 )
@@ -21,7 +28,7 @@ func TestHandleSubscribe(t *testing.T) {
 
 	tests := []struct {
 		name           string
-		address        string
+		address        storage.Address
 		subscribeResp  bool
 		expectCall     bool
 		expectedStatus int
@@ -35,10 +42,10 @@ func TestHandleSubscribe(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.expectCall {
-				mockParser.EXPECT().Subscribe(tt.address).Return(tt.subscribeResp)
+				mockParser.EXPECT().Subscribe(storage.Subscription{Address: tt.address, StartBlock: -1}).Return(tt.subscribeResp)
 			}
 
-			req := httptest.NewRequest("POST", "/subscribe?address="+tt.address, nil)
+			req := httptest.NewRequest("POST", "/subscribe?address="+tt.address.String(), nil)
 			w := httptest.NewRecorder()
 
 			err := srv.(*HttpServer).handleSubscribe(w, req)
@@ -54,7 +61,50 @@ func TestHandleSubscribe(t *testing.T) {
 	}
 }
 
-func TestHandleTransactions(t *testing.T) {
+func TestHandleSubscribe_FromBlock(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser)
+	address := storage.Address("0x1234567890abcdef1234567890abcdef12345678")
+
+	tests := []struct {
+		name           string
+		fromBlock      string
+		expectCall     bool
+		backfillErr    error
+		expectedStatus int
+	}{
+		{"ValidFromBlock", "50", true, nil, http.StatusOK},
+		{"BackfillFails", "50", true, errors.New("backfill error"), http.StatusInternalServerError},
+		{"FromBlockAfterLastIngestedBlock", "101", false, nil, http.StatusBadRequest},
+		{"NegativeFromBlock", "-1", false, nil, http.StatusBadRequest},
+		{"InvalidFromBlock", "abc", false, nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockParser.EXPECT().GetLastIngestedBlock().Return(100).AnyTimes()
+			if tt.expectCall {
+				mockParser.EXPECT().Subscribe(storage.Subscription{Address: address, StartBlock: 50}).Return(true)
+				mockParser.EXPECT().Backfill(address, 50).Return(tt.backfillErr)
+			}
+
+			req := httptest.NewRequest("POST", "/subscribe?address="+address.String()+"&fromBlock="+tt.fromBlock, nil)
+			w := httptest.NewRecorder()
+
+			srv.(*HttpServer).wrapHandler(srv.(*HttpServer).handleSubscribe)(w, req)
+
+			resp := w.Result()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandleSubscribe_NormalizesAddress(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
@@ -64,21 +114,202 @@ func TestHandleTransactions(t *testing.T) {
 	tests := []struct {
 		name           string
 		address        string
+		expectCall     bool
+		expectedStatus int
+	}{
+		{"ValidChecksum", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", true, http.StatusOK},
+		{"Uppercase", "0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", true, http.StatusOK},
+		{"InvalidChecksum", "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", false, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expectCall {
+				mockParser.EXPECT().Subscribe(storage.Subscription{Address: "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", StartBlock: -1}).Return(true)
+			}
+
+			req := httptest.NewRequest("POST", "/subscribe?address="+tt.address, nil)
+			w := httptest.NewRecorder()
+			if err := srv.(*HttpServer).handleSubscribe(w, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if resp := w.Result(); resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandleSubscribe_Label(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser)
+	address := storage.Address("0x1234567890abcdef1234567890abcdef12345678")
+
+	mockParser.EXPECT().Subscribe(storage.Subscription{Address: address, Label: "cold wallet", StartBlock: -1}).Return(true)
+	req := httptest.NewRequest("POST", "/subscribe?address="+address.String()+"&label=cold+wallet", nil)
+	w := httptest.NewRecorder()
+	if err := srv.(*HttpServer).handleSubscribe(w, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if w.Result().StatusCode != http.StatusOK {
+		t.Errorf("Expected status %d, got %d", http.StatusOK, w.Result().StatusCode)
+	}
+
+	req = httptest.NewRequest("POST", "/subscribe?address="+address.String()+"&label="+strings.Repeat("a", maxLabelLength+1), nil)
+	w = httptest.NewRecorder()
+	if err := srv.(*HttpServer).handleSubscribe(w, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if w.Result().StatusCode != http.StatusBadRequest {
+		t.Errorf("Expected status %d for a long label, got %d", http.StatusBadRequest, w.Result().StatusCode)
+	}
+}
+
+func TestHandleUnsubscribe(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser)
+	address := storage.Address("0x1234567890abcdef1234567890abcdef12345678")
+
+	tests := []struct {
+		name           string
+		query          string
+		expectPurge    bool
+		expectCall     bool
+		unsubscribed   bool
+		expectedStatus int
+	}{
+		{"RetainRecords", "address=" + address.String(), false, true, true, http.StatusOK},
+		{"PurgeRecords", "address=" + address.String() + "&purge=true", true, true, true, http.StatusOK},
+		{"NotSubscribed", "address=" + address.String(), false, true, false, http.StatusNotFound},
+		{"InvalidPurge", "address=" + address.String() + "&purge=maybe", false, false, false, http.StatusBadRequest},
+		{"MissingAddress", "", false, false, false, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expectCall {
+				mockParser.EXPECT().Unsubscribe(address, tt.expectPurge).Return(tt.unsubscribed)
+			}
+
+			req := httptest.NewRequest("DELETE", "/subscribe?"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			if err := srv.(*HttpServer).handleUnsubscribe(w, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if resp := w.Result(); resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandleSubscriptions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser)
+
+	subscriptions := []storage.Subscription{
+		{Address: "0x1234567890abcdef1234567890abcdef12345678", Label: "treasury", CreatedAt: time.Date(2024, 11, 14, 10, 0, 0, 0, time.UTC), StartBlock: 21196000},
+	}
+	mockParser.EXPECT().GetSubscriptions().Return(subscriptions)
+
+	req := httptest.NewRequest("GET", "/subscriptions", nil)
+	w := httptest.NewRecorder()
+	if err := srv.(*HttpServer).handleSubscriptions(w, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var result []storage.Subscription
+	if err := json.NewDecoder(w.Result().Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if !reflect.DeepEqual(result, subscriptions) {
+		t.Errorf("Expected %+v, got %+v", subscriptions, result)
+	}
+}
+
+func TestHandleBackfillStatus(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser)
+	address := storage.Address("0x1234567890abcdef1234567890abcdef12345678")
+
+	mockParser.EXPECT().GetBackfillStatus(address).Return(storage.BackfillJob{
+		Address: address, FromBlock: 0, ToBlock: 99, NextBlock: 25,
+	}, true)
+
+	req := httptest.NewRequest("GET", "/backfill?address="+address.String(), nil)
+	w := httptest.NewRecorder()
+
+	if err := srv.(*HttpServer).handleBackfillStatus(w, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var status backfillStatus
+	if err := json.NewDecoder(w.Result().Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if status.Progress != 25 {
+		t.Errorf("Expected progress 25, got %v", status.Progress)
+	}
+
+	mockParser.EXPECT().GetBackfillStatus(address).Return(storage.BackfillJob{}, false)
+	w = httptest.NewRecorder()
+	if err := srv.(*HttpServer).handleBackfillStatus(w, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if w.Result().StatusCode != http.StatusNotFound {
+		t.Errorf("Expected status %d, got %d", http.StatusNotFound, w.Result().StatusCode)
+	}
+}
+
+func TestHandleTransactions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser)
+
+	confirmed := []storage.Transaction{
+		{Hash: "tx1", ConfirmationStatus: storage.StatusConfirmed},
+	}
+
+	tests := []struct {
+		name           string
+		address        storage.Address
+		status         string
 		mockResponse   []storage.Transaction
 		expectCall     bool
 		expectedStatus int
+		expectedCount  int
 	}{
-		{"ValidAddressWithTransactions", "0x1234567890abcdef1234567890abcdef12345678", []storage.Transaction{}, true, http.StatusOK},
-		{"MissingAddress", "", nil, false, http.StatusBadRequest},
+		{"ValidAddressWithTransactions", "0x1234567890abcdef1234567890abcdef12345678", "", nil, true, http.StatusOK, 0},
+		{"FilterByStatus", "0x1234567890abcdef1234567890abcdef12345678", storage.StatusConfirmed, confirmed, true, http.StatusOK, 1},
+		{"InvalidStatus", "0x1234567890abcdef1234567890abcdef12345678", "unknown", nil, false, http.StatusBadRequest, 0},
+		{"MissingAddress", "", "", nil, false, http.StatusBadRequest, 0},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			if tt.expectCall {
-				mockParser.EXPECT().GetTransactions(tt.address).Return(tt.mockResponse)
+				mockParser.EXPECT().QueryTransactions(tt.address, storage.TransactionQuery{}, tt.status).
+					Return(storage.TransactionPage{Transactions: tt.mockResponse, Total: len(tt.mockResponse)})
 			}
 
-			req := httptest.NewRequest("GET", "/transactions?address="+tt.address, nil)
+			req := httptest.NewRequest("GET", "/transactions?address="+tt.address.String()+"&status="+tt.status, nil)
 			w := httptest.NewRecorder()
 
 			err := srv.(*HttpServer).handleTransactions(w, req)
@@ -90,10 +321,257 @@ func TestHandleTransactions(t *testing.T) {
 			if resp.StatusCode != tt.expectedStatus {
 				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
 			}
+
+			if resp.StatusCode == http.StatusOK {
+				var transactions []storage.Transaction
+				if err := json.NewDecoder(resp.Body).Decode(&transactions); err != nil {
+					t.Fatalf("Failed to decode response: %v", err)
+				}
+				if transactions == nil || len(transactions) != tt.expectedCount {
+					t.Errorf("Expected an array of %d transactions, got %v", tt.expectedCount, transactions)
+				}
+				if total := resp.Header.Get("X-Total-Count"); total != strconv.Itoa(tt.expectedCount) {
+					t.Errorf("Expected a total count of %d, got %q", tt.expectedCount, total)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleTransactions_Pagination(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser)
+
+	address := storage.Address("0x1234567890abcdef1234567890abcdef12345678")
+	cursor := storage.TransactionCursor{BlockNum: 12, TxIndex: 3, Hash: "0xabc"}
+	next := storage.TransactionCursor{BlockNum: 10, TxIndex: 0, Hash: "0xdef"}
+
+	tests := []struct {
+		name           string
+		query          string
+		expected       *storage.TransactionQuery
+		expectedStatus int
+	}{
+		{"Defaults", "", &storage.TransactionQuery{}, http.StatusOK},
+		{"CursorWithoutLimit", "&cursor=" + cursor.String(), &storage.TransactionQuery{After: &cursor, Limit: defaultPageSize}, http.StatusOK},
+		{
+			"EveryParameter",
+			"&limit=2&cursor=" + cursor.String() + "&fromBlock=5&toBlock=20&direction=in&txType=eip-1559&order=desc",
+			&storage.TransactionQuery{FromBlock: 5, ToBlock: 20, Direction: storage.DirectionIn, TxType: storage.TxTypeDynamicFee, Descending: true, After: &cursor, Limit: 2},
+			http.StatusOK,
+		},
+		{"ZeroLimit", "&limit=0", nil, http.StatusBadRequest},
+		{"LimitTooLarge", "&limit=1001", nil, http.StatusBadRequest},
+		{"InvalidCursor", "&cursor=not-a-cursor", nil, http.StatusBadRequest},
+		{"NegativeFromBlock", "&fromBlock=-1", nil, http.StatusBadRequest},
+		{"InvalidToBlock", "&toBlock=latest", nil, http.StatusBadRequest},
+		{"InvalidDirection", "&direction=both", nil, http.StatusBadRequest},
+		{"InvalidOrder", "&order=newest", nil, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.expected != nil {
+				mockParser.EXPECT().QueryTransactions(address, *tt.expected, "").Return(storage.TransactionPage{
+					Transactions: []storage.Transaction{{Hash: "0xdef"}},
+					Total:        7,
+					Next:         &next,
+				})
+			}
+
+			req := httptest.NewRequest("GET", "/transactions?address="+address.String()+tt.query, nil)
+			w := httptest.NewRecorder()
+			if err := srv.(*HttpServer).handleTransactions(w, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			resp := w.Result()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			if total := resp.Header.Get("X-Total-Count"); total != "7" {
+				t.Errorf("Expected a total count of 7, got %q", total)
+			}
+			if nextCursor := resp.Header.Get("X-Next-Cursor"); nextCursor != next.String() {
+				t.Errorf("Expected the next cursor %q, got %q", next.String(), nextCursor)
+			}
+		})
+	}
+}
+
+func TestHandleTransactions_Amounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser)
+
+	address := storage.Address("0x1234567890abcdef1234567890abcdef12345678")
+
+	tests := []struct {
+		name             string
+		query            string
+		expectCall       bool
+		expectedStatus   int
+		expectedMinValue storage.Quantity
+	}{
+		// 1.5 ETH, above 2^53 wei
+		{"MinValueInWei", "&minValue=1500000000000000000", true, http.StatusOK, storage.NewQuantityFromUint64(1500000000000000000)},
+		{"MinValueInEther", "&unit=eth&minValue=1.4", true, http.StatusOK, storage.NewQuantityFromUint64(1400000000000000000)},
+		{"InvalidUnit", "&unit=finney", false, http.StatusBadRequest, storage.Quantity{}},
+		{"TooManyDecimals", "&unit=gwei&minValue=0.0000000001", false, http.StatusBadRequest, storage.Quantity{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var minValue storage.Quantity
+			if tt.expectCall {
+				mockParser.EXPECT().QueryTransactions(address, gomock.Any(), "").
+					DoAndReturn(func(_ storage.Address, query storage.TransactionQuery, _ string) storage.TransactionPage {
+						minValue = query.MinValue
+						return storage.TransactionPage{}
+					})
+			}
+
+			req := httptest.NewRequest("GET", "/transactions?address="+address.String()+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			if err := srv.(*HttpServer).handleTransactions(w, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			resp := w.Result()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			if minValue.Cmp(tt.expectedMinValue) != 0 {
+				t.Errorf("Expected a minimum value of %s wei, got %s", tt.expectedMinValue, minValue)
+			}
 		})
 	}
 }
 
+func TestHandleTransactions_FormatsAmounts(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser)
+
+	address := storage.Address("0x1234567890abcdef1234567890abcdef12345678")
+	mockParser.EXPECT().QueryTransactions(address, storage.TransactionQuery{}, "").Return(storage.TransactionPage{
+		Transactions: []storage.Transaction{
+			{Hash: "tx1", Value: storage.NewQuantityFromUint64(1500000000000000000), Fee: storage.NewQuantityFromUint64(21000000000000)},
+		},
+		Total: 1,
+	})
+
+	req := httptest.NewRequest("GET", "/transactions?address="+address.String()+"&unit=eth", nil)
+	w := httptest.NewRecorder()
+	if err := srv.(*HttpServer).handleTransactions(w, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var views []map[string]interface{}
+	if err := json.NewDecoder(w.Result().Body).Decode(&views); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	expected := map[string]interface{}{"Unit": "eth", "Value": "1.5", "Fee": "0.000021"}
+	if len(views) != 1 || views[0]["Value"] != "1500000000000000000" || !reflect.DeepEqual(views[0]["Formatted"], expected) {
+		t.Errorf("Expected the value in wei and formatted in ETH, got %+v", views)
+	}
+}
+
+func TestHandleTransfers(t *testing.T) {
+	confirmed := storage.StatusConfirmed
+	pending := storage.StatusPendingConfirmation
+
+	// the kinds of transfers, each parser returns one confirmed and one
+	// pending transfer
+	kinds := []struct {
+		name    string
+		path    string
+		handler func(s *HttpServer, w http.ResponseWriter, r *http.Request) error
+		expect  func(mockParser *parser.MockParser, address storage.Address)
+	}{
+		{"TokenTransfers", "/token_transfers", (*HttpServer).handleTokenTransfers, func(mockParser *parser.MockParser, address storage.Address) {
+			mockParser.EXPECT().GetTokenTransfers(address).Return([]storage.TokenTransfer{
+				{TxHash: "tx1", ConfirmationStatus: confirmed}, {TxHash: "tx2", ConfirmationStatus: pending},
+			})
+		}},
+		{"NftTransfers", "/nft_transfers", (*HttpServer).handleNftTransfers, func(mockParser *parser.MockParser, address storage.Address) {
+			mockParser.EXPECT().GetNftTransfers(address).Return([]storage.NftTransfer{
+				{TxHash: "tx1", ConfirmationStatus: confirmed}, {TxHash: "tx2", ConfirmationStatus: pending},
+			})
+		}},
+		{"InternalTransfers", "/internal_transfers", (*HttpServer).handleInternalTransfers, func(mockParser *parser.MockParser, address storage.Address) {
+			mockParser.EXPECT().GetInternalTransfers(address).Return([]storage.InternalTransfer{
+				{TxHash: "tx1", ConfirmationStatus: confirmed}, {TxHash: "tx2", ConfirmationStatus: pending},
+			})
+		}},
+	}
+
+	tests := []struct {
+		name           string
+		address        storage.Address
+		status         string
+		expectCall     bool
+		expectedStatus int
+		expectedCount  int
+	}{
+		{"ValidAddress", "0x1234567890abcdef1234567890abcdef12345678", "", true, http.StatusOK, 2},
+		{"FilterByStatus", "0x1234567890abcdef1234567890abcdef12345678", pending, true, http.StatusOK, 1},
+		{"InvalidStatus", "0x1234567890abcdef1234567890abcdef12345678", "unknown", false, http.StatusBadRequest, 0},
+		{"MissingAddress", "", "", false, http.StatusBadRequest, 0},
+	}
+
+	for _, kind := range kinds {
+		for _, tt := range tests {
+			t.Run(kind.name+"/"+tt.name, func(t *testing.T) {
+				ctrl := gomock.NewController(t)
+				defer ctrl.Finish()
+
+				mockParser := parser.NewMockParser(ctrl)
+				srv := NewHttpServer(":8080", mockParser).(*HttpServer)
+				if tt.expectCall {
+					kind.expect(mockParser, tt.address)
+				}
+
+				req := httptest.NewRequest("GET", kind.path+"?address="+tt.address.String()+"&status="+tt.status, nil)
+				w := httptest.NewRecorder()
+
+				if err := kind.handler(srv, w, req); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+
+				resp := w.Result()
+				if resp.StatusCode != tt.expectedStatus {
+					t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+				}
+
+				if resp.StatusCode == http.StatusOK {
+					var transfers []json.RawMessage
+					if err := json.NewDecoder(resp.Body).Decode(&transfers); err != nil {
+						t.Fatalf("Failed to decode response: %v", err)
+					}
+					if len(transfers) != tt.expectedCount {
+						t.Errorf("Expected %d transfers, got %d", tt.expectedCount, len(transfers))
+					}
+				}
+			})
+		}
+	}
+}
+
 func TestHandleCurrentBlock(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -117,11 +595,246 @@ func TestHandleCurrentBlock(t *testing.T) {
 	}
 }
 
+func TestHandlePendingBlocks(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser)
+
+	mockParser.EXPECT().GetPendingBlocks().Return([]int{101, 103})
+
+	req := httptest.NewRequest("GET", "/pending_blocks", nil)
+	w := httptest.NewRecorder()
+
+	if err := srv.(*HttpServer).handlePendingBlocks(w, req); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var pendingBlocks []int
+	if err := json.NewDecoder(w.Result().Body).Decode(&pendingBlocks); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if len(pendingBlocks) != 2 || pendingBlocks[0] != 101 || pendingBlocks[1] != 103 {
+		t.Errorf("Expected pending blocks [101 103], got %v", pendingBlocks)
+	}
+}
+
+type staticHealthReporter []client.EndpointHealth
+
+func (r staticHealthReporter) EndpointHealth() []client.EndpointHealth {
+	return r
+}
+
+func TestHandleHealth(t *testing.T) {
+	tests := []struct {
+		name           string
+		endpoints      staticHealthReporter
+		expectedStatus int
+	}{
+		{"OneHealthy", staticHealthReporter{{URL: "http://a", Healthy: false}, {URL: "http://b", Healthy: true}}, http.StatusOK},
+		{"NoneHealthy", staticHealthReporter{{URL: "http://a", Healthy: false}}, http.StatusServiceUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			srv := NewHttpServer(":8080", parser.NewMockParser(ctrl), WithHealthReporter(tt.endpoints))
+
+			req := httptest.NewRequest("GET", "/health", nil)
+			w := httptest.NewRecorder()
+
+			if err := srv.(*HttpServer).handleHealth(w, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			resp := w.Result()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+
+			var status healthStatus
+			if err := json.NewDecoder(resp.Body).Decode(&status); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(status.Endpoints) != len(tt.endpoints) {
+				t.Errorf("Expected %d endpoints, got %+v", len(tt.endpoints), status.Endpoints)
+			}
+		})
+	}
+}
+
+// staticWebhooks serves a fixed set of deliveries.
+type staticWebhooks []storage.WebhookDelivery
+
+func (w staticWebhooks) Run(ctx context.Context) {}
+
+func (w staticWebhooks) GetDeliveries(address storage.Address) []storage.WebhookDelivery {
+	deliveries := []storage.WebhookDelivery{}
+	for _, delivery := range w {
+		if delivery.Address == address {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	return deliveries
+}
+
+func (w staticWebhooks) Redeliver(id string) (storage.WebhookDelivery, bool) {
+	for _, delivery := range w {
+		if delivery.ID == id {
+			delivery.Status, delivery.Attempts = storage.DeliveryStatusPending, 0
+			return delivery, true
+		}
+	}
+	return storage.WebhookDelivery{}, false
+}
+
+func TestHandleSubscribe_Webhook(t *testing.T) {
+	address := storage.Address("0x1234567890abcdef1234567890abcdef12345678")
+
+	tests := []struct {
+		name           string
+		webhooks       Webhooks
+		webhookURL     string
+		expectCall     bool
+		expectedStatus int
+	}{
+		{"Registered", staticWebhooks{}, "https://hooks.example.com/eth", true, http.StatusOK},
+		{"NotEnabled", nil, "https://hooks.example.com/eth", false, http.StatusBadRequest},
+		{"RelativeURL", staticWebhooks{}, "/eth", false, http.StatusBadRequest},
+		{"UnsupportedScheme", staticWebhooks{}, "ftp://hooks.example.com", false, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			mockParser := parser.NewMockParser(ctrl)
+			var opts []Option
+			if tt.webhooks != nil {
+				opts = append(opts, WithWebhooks(tt.webhooks))
+			}
+			srv := NewHttpServer(":8080", mockParser, opts...)
+
+			if tt.expectCall {
+				mockParser.EXPECT().Subscribe(storage.Subscription{Address: address, StartBlock: -1, WebhookURL: tt.webhookURL}).Return(true)
+			}
+
+			query := url.Values{"address": {address.String()}, "webhookUrl": {tt.webhookURL}}
+			req := httptest.NewRequest("POST", "/subscribe?"+query.Encode(), nil)
+			w := httptest.NewRecorder()
+			if err := srv.(*HttpServer).handleSubscribe(w, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if resp := w.Result(); resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandleDeliveries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	address := storage.Address("0x1234567890abcdef1234567890abcdef12345678")
+	webhooks := staticWebhooks{
+		{ID: "d1", Address: address, Status: storage.DeliveryStatusDelivered, Attempts: 1},
+		{ID: "d2", Address: address, Status: storage.DeliveryStatusFailed, Attempts: 8, LastStatusCode: 500},
+	}
+	srv := NewHttpServer(":8080", parser.NewMockParser(ctrl), WithWebhooks(webhooks))
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+		expectedCount  int
+	}{
+		{"AllDeliveries", "address=" + address.String(), http.StatusOK, 2},
+		{"FilterByStatus", "address=" + address.String() + "&status=failed", http.StatusOK, 1},
+		{"InvalidStatus", "address=" + address.String() + "&status=unknown", http.StatusBadRequest, 0},
+		{"MissingAddress", "", http.StatusBadRequest, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/deliveries?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			if err := srv.(*HttpServer).handleDeliveries(w, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			resp := w.Result()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			var deliveries []storage.WebhookDelivery
+			if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if len(deliveries) != tt.expectedCount {
+				t.Errorf("Expected %d deliveries, got %+v", tt.expectedCount, deliveries)
+			}
+		})
+	}
+}
+
+func TestHandleRedeliver(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	webhooks := staticWebhooks{{ID: "d1", Status: storage.DeliveryStatusFailed, Attempts: 8}}
+	srv := NewHttpServer(":8080", parser.NewMockParser(ctrl), WithWebhooks(webhooks))
+
+	tests := []struct {
+		name           string
+		query          string
+		expectedStatus int
+	}{
+		{"Requeued", "id=d1", http.StatusOK},
+		{"UnknownID", "id=d2", http.StatusNotFound},
+		{"MissingID", "", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/deliveries/redeliver?"+tt.query, nil)
+			w := httptest.NewRecorder()
+			if err := srv.(*HttpServer).handleRedeliver(w, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			resp := w.Result()
+			if resp.StatusCode != tt.expectedStatus {
+				t.Fatalf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+			var delivery storage.WebhookDelivery
+			if err := json.NewDecoder(resp.Body).Decode(&delivery); err != nil {
+				t.Fatalf("Failed to decode response: %v", err)
+			}
+			if delivery.Status != storage.DeliveryStatusPending {
+				t.Errorf("Expected the delivery to be pending again, got %+v", delivery)
+			}
+		})
+	}
+}
+
 func TestStartServerAndShutdown(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	mockParser := parser.NewMockParser(ctrl)
+	mockParser.EXPECT().ProcessBackfills(gomock.Any()).AnyTimes()
 	srv := NewHttpServer(":8080", mockParser)
 
 	ctx, cancel := context.WithCancel(context.Background())
@@ -138,3 +851,48 @@ func TestStartServerAndShutdown(t *testing.T) {
 		t.Fatalf("Unexpected error: %v", err)
 	}
 }
+
+// fakeHeadSource sends its heads once and then reports its connection state.
+type fakeHeadSource struct {
+	heads     []int
+	connected bool
+}
+
+func (f *fakeHeadSource) Run(ctx context.Context, heads chan<- int) {
+	for _, head := range f.heads {
+		select {
+		case <-ctx.Done():
+			return
+		case heads <- head:
+		}
+	}
+}
+
+func (f *fakeHeadSource) Connected() bool {
+	return f.connected
+}
+
+func TestStartBlockProcessing_ProcessesOnNewHead(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	mockParser := parser.NewMockParser(ctrl)
+	mockParser.EXPECT().ProcessNewBlocks(gomock.Any()).Do(func(context.Context) { cancel() })
+
+	srv := NewHttpServer(":8080", mockParser, WithHeadSource(&fakeHeadSource{heads: []int{100}, connected: true}))
+
+	done := make(chan struct{})
+	go func() {
+		srv.(*HttpServer).startBlockProcessing(ctx)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(blockProcessingInterval / 2):
+		t.Fatalf("Expected the blocks to be processed on the new head")
+	}
+}
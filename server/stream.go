@@ -0,0 +1,273 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oanatmaria/ethblkcn-observer/events"
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+const (
+	// events buffered per client, a client falling further behind is
+	// disconnected and resumes with Last-Event-ID
+	streamBufferSize = 256
+	// how often a comment is sent on an idle stream to keep proxies from closing it
+	streamKeepAlive = 15 * time.Second
+
+	streamEventTransaction = "transaction"
+	streamEventBlock       = "block"
+	streamEventReorg       = "reorg"
+	streamEventCursor      = "cursor"
+)
+
+// BlockEvent is the data of the event sent for every processed block.
+type BlockEvent struct {
+	Number int
+	Hash   string
+}
+
+// ReorgEvent is the data of the event sent when blocks are orphaned, the
+// blocks replacing them are sent after it.
+type ReorgEvent struct {
+	FromBlock int
+	ToBlock   int
+}
+
+// streamClient is a client of GET /stream or GET /ws, it gets the matched
+// transactions of the addresses it watches and the other events of its types.
+type streamClient struct {
+	mu           sync.Mutex
+	addresses    map[storage.Address]bool
+	subscription *events.Subscription
+}
+
+// subscribeStream subscribes a client to the bus. A client falling too far
+// behind has its subscription closed instead of holding up the parser.
+func (s *HttpServer) subscribeStream(name string, types []events.Type, addresses []storage.Address) *streamClient {
+	client := &streamClient{addresses: make(map[storage.Address]bool, len(addresses))}
+	for _, address := range addresses {
+		client.addresses[address] = true
+	}
+	client.subscription = s.events.Subscribe(name,
+		events.WithTypes(types...),
+		events.WithFilter(client.wants),
+		events.WithBufferSize(streamBufferSize),
+		events.WithPolicy(events.PolicyClose),
+	)
+	return client
+}
+
+func (c *streamClient) wants(event events.Event) bool {
+	if event.Type != events.TxMatched {
+		return true
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, address := range event.Addresses {
+		if c.addresses[address] {
+			return true
+		}
+	}
+	return false
+}
+
+// watch adds addresses to the ones of the client, or removes them, and
+// returns the resulting addresses.
+func (c *streamClient) watch(addresses []storage.Address, watched bool) []storage.Address {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, address := range addresses {
+		if watched {
+			c.addresses[address] = true
+		} else {
+			delete(c.addresses, address)
+		}
+	}
+
+	current := make([]storage.Address, 0, len(c.addresses))
+	for address := range c.addresses {
+		current = append(current, address)
+	}
+	sort.Slice(current, func(i, j int) bool { return current[i] < current[j] })
+	return current
+}
+
+// handleStream sends the transactions of subscribed addresses and every
+// processed block as server-sent events. The ID of an event is its sequence
+// number on the bus. A client reconnecting with Last-Event-ID first gets the
+// events it missed, including retried blocks and the ones replacing blocks
+// orphaned by a reorg. When they are no longer kept it gets every stored
+// transaction of its addresses instead.
+func (s *HttpServer) handleStream(w http.ResponseWriter, r *http.Request) error {
+	addresses, ok := addressesParam(w, r)
+	if !ok {
+		return nil
+	}
+	if address, found := s.unsubscribedAddress(addresses); found {
+		http.Error(w, fmt.Sprintf("Address not subscribed: %s", address), http.StatusNotFound)
+		return nil
+	}
+
+	var lastSeq uint64
+	resume := false
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		seq, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID header", http.StatusBadRequest)
+			return nil
+		}
+		lastSeq, resume = seq, true
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming is not supported by the connection")
+	}
+
+	// subscribed before the replay so no event is lost in between
+	types := []events.Type{events.TxMatched, events.BlockProcessed}
+	client := s.subscribeStream("sse", types, addresses)
+	defer client.subscription.Close()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	if resume {
+		missed, complete := s.events.Since(lastSeq)
+		if !complete {
+			// the stored transactions are sent without an ID, so a client
+			// disconnected during them resumes from the same event
+			missed = s.storedEvents(addresses)
+		}
+		for _, event := range missed {
+			if !slices.Contains(types, event.Type) || !client.wants(event) {
+				continue
+			}
+			if err := writeStreamEvent(w, event); err != nil {
+				return nil
+			}
+			lastSeq = max(lastSeq, event.Seq)
+		}
+		flusher.Flush()
+	}
+
+	keepAlive := time.NewTicker(streamKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-client.subscription.Done():
+			return nil
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return nil
+			}
+		case event := <-client.subscription.Events():
+			// already sent by the replay
+			if event.Seq <= lastSeq {
+				continue
+			}
+			if err := writeStreamEvent(w, event); err != nil {
+				return nil
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+// storedEvents returns the stored transactions of the addresses in the order
+// of the chain.
+func (s *HttpServer) storedEvents(addresses []storage.Address) []events.Event {
+	seen := make(map[string]bool)
+	var stored []events.Event
+	for _, address := range addresses {
+		for _, tx := range s.parser.GetTransactions(address) {
+			// a transaction between two of the addresses is stored for both
+			key := fmt.Sprintf("%s:%s", tx.BlockHash, tx.Hash)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			stored = append(stored, events.Event{Type: events.TxMatched, BlockNum: tx.BlockNum, BlockHash: tx.BlockHash, Transaction: tx, Addresses: addresses})
+		}
+	}
+	sort.SliceStable(stored, func(i, j int) bool {
+		if stored[i].BlockNum != stored[j].BlockNum {
+			return stored[i].BlockNum < stored[j].BlockNum
+		}
+		return stored[i].Transaction.TxIndex < stored[j].Transaction.TxIndex
+	})
+	return stored
+}
+
+// writeStreamEvent writes the event with its sequence number as ID, events
+// that were not published on the bus have none.
+func writeStreamEvent(w http.ResponseWriter, event events.Event) error {
+	name, payload := streamEventTransaction, interface{}(event.Transaction)
+	if event.Type == events.BlockProcessed {
+		name, payload = streamEventBlock, BlockEvent{Number: event.BlockNum, Hash: event.BlockHash}
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %v", err)
+	}
+	if event.Seq > 0 {
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.Seq); err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
+
+// unsubscribedAddress returns the first of the addresses that is not
+// subscribed, only the transactions of subscribed addresses are stored.
+func (s *HttpServer) unsubscribedAddress(addresses []storage.Address) (storage.Address, bool) {
+	subscribed := make(map[storage.Address]bool)
+	for _, subscription := range s.parser.GetSubscriptions() {
+		subscribed[subscription.Address] = true
+	}
+	for _, address := range addresses {
+		if !subscribed[address] {
+			return address, true
+		}
+	}
+	return "", false
+}
+
+// addressesParam reads one or more addresses, given as repeated or comma
+// separated address parameters.
+func addressesParam(w http.ResponseWriter, r *http.Request) ([]storage.Address, bool) {
+	var addresses []storage.Address
+	for _, param := range r.URL.Query()["address"] {
+		for _, address := range strings.Split(param, ",") {
+			if address == "" {
+				continue
+			}
+			if !isValidEthAddress(address) {
+				http.Error(w, "Invalid Ethereum address", http.StatusBadRequest)
+				return nil, false
+			}
+			addresses = append(addresses, storage.NormalizeAddress(address))
+		}
+	}
+	if len(addresses) == 0 {
+		http.Error(w, "Missing address parameter", http.StatusBadRequest)
+		return nil, false
+	}
+	return addresses, true
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/oanatmaria/ethblkcn-observer/events"
+	"github.com/oanatmaria/ethblkcn-observer/parser"
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+const (
+	streamAddress1 = storage.Address("0x00000000000000000000000000000000000000aa")
+	streamAddress2 = storage.Address("0x00000000000000000000000000000000000000bb")
+	otherAddress   = storage.Address("0x00000000000000000000000000000000000000cc")
+)
+
+type sentEvent struct {
+	id   string
+	name string
+	data string
+}
+
+// readStreamEvent reads the next event of the stream, skipping comments.
+func readStreamEvent(t *testing.T, reader *bufio.Reader) sentEvent {
+	t.Helper()
+	var event sentEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("Failed to read event: %v", err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "" && event.name != "":
+			return event
+		case strings.HasPrefix(line, "id: "):
+			event.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			event.name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			event.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+// openStream connects to the stream of the server and returns a reader of its events.
+func openStream(t *testing.T, srv *HttpServer, query, lastEventID string) *bufio.Reader {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(srv.wrapHandler(srv.handleStream)))
+	t.Cleanup(ts.Close)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, "GET", ts.URL+"/stream?"+query, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to open stream: %v", err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got status %d and %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	return bufio.NewReader(resp.Body)
+}
+
+// subscribedParser is a parser with streamAddress1 and streamAddress2 subscribed.
+func subscribedParser(ctrl *gomock.Controller) *parser.MockParser {
+	mockParser := parser.NewMockParser(ctrl)
+	mockParser.EXPECT().GetSubscriptions().Return([]storage.Subscription{{Address: streamAddress1}, {Address: streamAddress2}}).AnyTimes()
+	return mockParser
+}
+
+func TestHandleStream_InvalidParams(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := subscribedParser(ctrl)
+	srv := NewHttpServer(":8080", mockParser, WithEventBus(events.NewBus()))
+
+	tests := []struct {
+		name           string
+		query          string
+		lastEventID    string
+		expectedStatus int
+	}{
+		{"MissingAddress", "", "", http.StatusBadRequest},
+		{"InvalidAddress", "address=" + streamAddress1.String() + ",invalid", "", http.StatusBadRequest},
+		{"UnsubscribedAddress", "address=" + streamAddress1.String() + "," + otherAddress.String(), "", http.StatusNotFound},
+		{"InvalidLastEventID", "address=" + streamAddress1.String(), "10:x", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/stream?"+tt.query, nil)
+			if tt.lastEventID != "" {
+				req.Header.Set("Last-Event-ID", tt.lastEventID)
+			}
+			w := httptest.NewRecorder()
+			if err := srv.(*HttpServer).handleStream(w, req); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if resp := w.Result(); resp.StatusCode != tt.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tt.expectedStatus, resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestHandleStream_PushesEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	bus := events.NewBus()
+	srv := NewHttpServer(":8080", subscribedParser(ctrl), WithEventBus(bus))
+	stream := openStream(t, srv.(*HttpServer), "address="+streamAddress1.String()+"&address="+streamAddress2.String(), "")
+
+	for _, match := range []storage.TransactionMatch{
+		{Transaction: storage.Transaction{Hash: "0x1", BlockNum: 10, TxIndex: 0, From: streamAddress1, To: otherAddress}, Addresses: []storage.Address{streamAddress1}},
+		{Transaction: storage.Transaction{Hash: "0x2", BlockNum: 10, TxIndex: 1, From: otherAddress, To: otherAddress}, Addresses: []storage.Address{otherAddress}},
+		{Transaction: storage.Transaction{Hash: "0x3", BlockNum: 10, TxIndex: 2, From: otherAddress, To: streamAddress2}, Addresses: []storage.Address{streamAddress2}},
+	} {
+		bus.Publish(events.Event{Type: events.TxMatched, BlockNum: match.Transaction.BlockNum, Transaction: match.Transaction, Addresses: match.Addresses})
+	}
+	// cursor updates are only sent over WebSocket
+	bus.Publish(events.Event{Type: events.CursorAdvanced, BlockNum: 10})
+	bus.Publish(events.Event{Type: events.BlockProcessed, BlockNum: 10, BlockHash: "0xb10"})
+
+	expected := []struct{ name, hash string }{
+		{streamEventTransaction, "0x1"},
+		{streamEventTransaction, "0x3"},
+		{streamEventBlock, "0xb10"},
+	}
+	var lastSeq uint64
+	for _, want := range expected {
+		event := readStreamEvent(t, stream)
+		if event.name != want.name || !strings.Contains(event.data, want.hash) {
+			t.Errorf("Expected %s event of %s, got %+v", want.name, want.hash, event)
+		}
+		// the ID is the sequence number of the event on the bus
+		if seq, err := strconv.ParseUint(event.id, 10, 64); err != nil || seq <= lastSeq {
+			t.Errorf("Expected an ID above %d, got %q", lastSeq, event.id)
+		} else {
+			lastSeq = seq
+		}
+	}
+}
+
+func TestHandleStream_ResumesFromLastEventID(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	bus := events.NewBus()
+	published := bus.Subscribe("published", events.WithBufferSize(16))
+	srv := NewHttpServer(":8080", subscribedParser(ctrl), WithEventBus(bus))
+
+	watched := []storage.Address{streamAddress1}
+	bus.Publish(events.Event{Type: events.BlockProcessed, BlockNum: 11, BlockHash: "0xb11"})
+	// a retried block and a block replacing an orphaned one come after the
+	// client's last event although their numbers are lower
+	bus.Publish(events.Event{Type: events.TxMatched, BlockNum: 10, Transaction: storage.Transaction{Hash: "0x1", BlockNum: 10, From: streamAddress1}, Addresses: watched})
+	bus.Publish(events.Event{Type: events.BlockProcessed, BlockNum: 10, BlockHash: "0xb10"})
+	bus.Publish(events.Event{Type: events.BlockProcessed, BlockNum: 11, BlockHash: "0xc11"})
+	lastEventID := strconv.FormatUint(received(published)[0].Seq, 10)
+
+	stream := openStream(t, srv.(*HttpServer), "address="+streamAddress1.String(), lastEventID)
+	bus.Publish(events.Event{Type: events.BlockProcessed, BlockNum: 12, BlockHash: "0xb12"})
+
+	for _, hash := range []string{"0x1", "0xb10", "0xc11", "0xb12"} {
+		if event := readStreamEvent(t, stream); !strings.Contains(event.data, hash) || event.id == "" {
+			t.Errorf("Expected the event of %s with an ID, got %+v", hash, event)
+		}
+	}
+}
+
+func TestHandleStream_ResumesFromStoredTransactions(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	shared := storage.Transaction{Hash: "0x3", BlockHash: "0xb11", BlockNum: 11, TxIndex: 0, From: streamAddress1, To: streamAddress2}
+	mockParser := subscribedParser(ctrl)
+	mockParser.EXPECT().GetTransactions(streamAddress1).Return([]storage.Transaction{
+		{Hash: "0x1", BlockHash: "0xb10", BlockNum: 10, TxIndex: 1, From: streamAddress1},
+		shared,
+	})
+	mockParser.EXPECT().GetTransactions(streamAddress2).Return([]storage.Transaction{
+		{Hash: "0x2", BlockHash: "0xb10", BlockNum: 10, TxIndex: 4, To: streamAddress2},
+		shared,
+	})
+
+	bus := events.NewBus()
+	srv := NewHttpServer(":8080", mockParser, WithEventBus(bus))
+	// an event of a previous run is no longer kept by the bus
+	stream := openStream(t, srv.(*HttpServer), "address="+streamAddress1.String()+","+streamAddress2.String(), "1")
+	bus.Publish(events.Event{Type: events.BlockProcessed, BlockNum: 12, BlockHash: "0xb12"})
+
+	expected := []struct{ hash string }{{"0x1"}, {"0x2"}, {"0x3"}}
+	for _, want := range expected {
+		// sent without an ID, the client resumes from the same event
+		if event := readStreamEvent(t, stream); !strings.Contains(event.data, want.hash) || event.id != "" {
+			t.Errorf("Expected the stored transaction %s without an ID, got %+v", want.hash, event)
+		}
+	}
+	if event := readStreamEvent(t, stream); !strings.Contains(event.data, "0xb12") || event.id == "" {
+		t.Errorf("Expected the new block with an ID, got %+v", event)
+	}
+}
+
+// received drains the events buffered for the subscription.
+func received(s *events.Subscription) []events.Event {
+	var buffered []events.Event
+	for {
+		select {
+		case event := <-s.Events():
+			buffered = append(buffered, event)
+		default:
+			return buffered
+		}
+	}
+}
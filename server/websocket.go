@@ -0,0 +1,184 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/oanatmaria/ethblkcn-observer/events"
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+const (
+	// deadline of a single write, a client not reading for this long is dropped
+	wsWriteWait = 10 * time.Second
+	// a client not answering pings for this long is dropped
+	wsPongWait   = time.Minute
+	wsPingPeriod = wsPongWait * 9 / 10
+	// largest message accepted from a client
+	wsMaxMessageSize = 64 << 10
+
+	wsActionSubscribe   = "subscribe"
+	wsActionUnsubscribe = "unsubscribe"
+
+	wsMessageSubscribed   = "subscribed"
+	wsMessageUnsubscribed = "unsubscribed"
+	wsMessageError        = "error"
+)
+
+var upgrader = websocket.Upgrader{}
+
+// wsRequest is a message sent by a WebSocket client to change the addresses
+// it gets the transactions of.
+type wsRequest struct {
+	Action    string
+	Addresses []string
+}
+
+// wsMessage is a message sent to a WebSocket client, Type is one of the
+// wsMessage* constants or one of the streamEvent* constants.
+type wsMessage struct {
+	Type        string
+	Addresses   []storage.Address    `json:",omitempty"`
+	Transaction *storage.Transaction `json:",omitempty"`
+	Cursor      int                  `json:",omitempty"`
+	Reorg       *ReorgEvent          `json:",omitempty"`
+	Error       string               `json:",omitempty"`
+}
+
+// handleWebSocket lets a client watch subscribed addresses over a single
+// connection, adding and removing them as it goes. It gets the transactions
+// of the addresses it watches, every move of the cursor and the reorgs.
+func (s *HttpServer) handleWebSocket(w http.ResponseWriter, r *http.Request) error {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already answered the request
+		log.Printf("Error upgrading connection: %v", err)
+		return nil
+	}
+	defer conn.Close()
+
+	client := s.subscribeStream("websocket", []events.Type{events.TxMatched, events.CursorAdvanced, events.Reorg}, nil)
+	defer client.subscription.Close()
+
+	replies := make(chan wsMessage)
+	readerDone := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(readerDone)
+		s.readWebSocket(conn, client, replies, writerDone)
+	}()
+
+	s.writeWebSocket(r.Context(), conn, client, replies, readerDone)
+	close(writerDone)
+	// unblocks the pending read
+	conn.Close()
+	<-readerDone
+	return nil
+}
+
+// readWebSocket handles the requests of the client until the connection is
+// closed, the replies are sent by the writer.
+func (s *HttpServer) readWebSocket(conn *websocket.Conn, client *streamClient, replies chan<- wsMessage, writerDone <-chan struct{}) {
+	conn.SetReadLimit(wsMaxMessageSize)
+	_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		reply := s.handleWebSocketRequest(client, data)
+		select {
+		case replies <- reply:
+		case <-writerDone:
+			return
+		}
+	}
+}
+
+func (s *HttpServer) handleWebSocketRequest(client *streamClient, data []byte) wsMessage {
+	var request wsRequest
+	if err := json.Unmarshal(data, &request); err != nil {
+		return wsMessage{Type: wsMessageError, Error: "Invalid message"}
+	}
+
+	addresses := make([]storage.Address, 0, len(request.Addresses))
+	for _, param := range request.Addresses {
+		address, err := storage.ParseAddress(param)
+		if err != nil {
+			return wsMessage{Type: wsMessageError, Error: fmt.Sprintf("Invalid Ethereum address: %s", param)}
+		}
+		addresses = append(addresses, address)
+	}
+
+	switch request.Action {
+	case wsActionSubscribe:
+		if address, found := s.unsubscribedAddress(addresses); found {
+			return wsMessage{Type: wsMessageError, Error: fmt.Sprintf("Address not subscribed: %s", address)}
+		}
+		return wsMessage{Type: wsMessageSubscribed, Addresses: client.watch(addresses, true)}
+	case wsActionUnsubscribe:
+		return wsMessage{Type: wsMessageUnsubscribed, Addresses: client.watch(addresses, false)}
+	default:
+		return wsMessage{Type: wsMessageError, Error: fmt.Sprintf("Unknown action: %s", request.Action)}
+	}
+}
+
+// writeWebSocket is the only writer of the connection. It sends the replies
+// and the events of the client until the client or the server goes away, or
+// the client falls too far behind.
+func (s *HttpServer) writeWebSocket(ctx context.Context, conn *websocket.Conn, client *streamClient, replies <-chan wsMessage, readerDone <-chan struct{}) {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+
+	for {
+		var message wsMessage
+		select {
+		case <-ctx.Done():
+			closeWebSocket(conn, websocket.CloseGoingAway, "server shutting down")
+			return
+		case <-readerDone:
+			return
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				return
+			}
+			continue
+		case message = <-replies:
+		case <-client.subscription.Done():
+			closeWebSocket(conn, websocket.CloseTryAgainLater, "client too slow")
+			return
+		case event := <-client.subscription.Events():
+			message = wsEventMessage(event)
+		}
+
+		_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		if err := conn.WriteJSON(message); err != nil {
+			return
+		}
+	}
+}
+
+func wsEventMessage(event events.Event) wsMessage {
+	switch event.Type {
+	case events.Reorg:
+		return wsMessage{Type: streamEventReorg, Reorg: &ReorgEvent{FromBlock: event.BlockNum, ToBlock: event.ToBlock}}
+	case events.CursorAdvanced:
+		return wsMessage{Type: streamEventCursor, Cursor: event.BlockNum}
+	default:
+		return wsMessage{Type: streamEventTransaction, Transaction: &event.Transaction}
+	}
+}
+
+func closeWebSocket(conn *websocket.Conn, code int, reason string) {
+	_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+}
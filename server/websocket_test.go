@@ -0,0 +1,154 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/websocket"
+	"github.com/oanatmaria/ethblkcn-observer/events"
+	"github.com/oanatmaria/ethblkcn-observer/parser"
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+// openWebSocket connects to the WebSocket endpoint of the server.
+func openWebSocket(t *testing.T, srv *HttpServer) *websocket.Conn {
+	t.Helper()
+	ts := httptest.NewServer(http.HandlerFunc(srv.wrapHandler(srv.handleWebSocket)))
+	t.Cleanup(ts.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// request sends a request and returns the reply of the server.
+func request(t *testing.T, conn *websocket.Conn, request interface{}) wsMessage {
+	t.Helper()
+	if err := conn.WriteJSON(request); err != nil {
+		t.Fatalf("Failed to send request: %v", err)
+	}
+	return readMessage(t, conn)
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) wsMessage {
+	t.Helper()
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message wsMessage
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	return message
+}
+
+func TestHandleWebSocket_PushesEvents(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	mockParser.EXPECT().GetSubscriptions().Return([]storage.Subscription{{Address: streamAddress1}}).AnyTimes()
+	bus := events.NewBus()
+	srv := NewHttpServer(":8080", mockParser, WithEventBus(bus))
+	conn := openWebSocket(t, srv.(*HttpServer))
+
+	reply := request(t, conn, wsRequest{Action: wsActionSubscribe, Addresses: []string{streamAddress1.String()}})
+	if reply.Type != wsMessageSubscribed || !reflect.DeepEqual(reply.Addresses, []storage.Address{streamAddress1}) {
+		t.Fatalf("Expected the address to be watched, got %+v", reply)
+	}
+
+	matched := storage.Transaction{Hash: "0x1", BlockNum: 10, From: streamAddress1}
+	bus.Publish(events.Event{Type: events.TxMatched, BlockNum: 10, Transaction: matched, Addresses: []storage.Address{streamAddress1}})
+	bus.Publish(events.Event{Type: events.TxMatched, BlockNum: 10, Transaction: storage.Transaction{Hash: "0x2", BlockNum: 10, From: otherAddress}, Addresses: []storage.Address{otherAddress}})
+	// processed blocks are only sent over SSE
+	bus.Publish(events.Event{Type: events.BlockProcessed, BlockNum: 10, BlockHash: "0xb10"})
+	bus.Publish(events.Event{Type: events.Reorg, BlockNum: 9, ToBlock: 10})
+	bus.Publish(events.Event{Type: events.CursorAdvanced, BlockNum: 10})
+
+	if message := readMessage(t, conn); message.Type != streamEventTransaction || message.Transaction == nil || message.Transaction.Hash != matched.Hash {
+		t.Errorf("Expected the matched transaction, got %+v", message)
+	}
+	if message := readMessage(t, conn); message.Type != streamEventReorg || !reflect.DeepEqual(message.Reorg, &ReorgEvent{FromBlock: 9, ToBlock: 10}) {
+		t.Errorf("Expected a reorg notice, got %+v", message)
+	}
+	if message := readMessage(t, conn); message.Type != streamEventCursor || message.Cursor != 10 {
+		t.Errorf("Expected a cursor update, got %+v", message)
+	}
+
+	reply = request(t, conn, wsRequest{Action: wsActionUnsubscribe, Addresses: []string{streamAddress1.String()}})
+	if reply.Type != wsMessageUnsubscribed || len(reply.Addresses) != 0 {
+		t.Fatalf("Expected no address to be watched, got %+v", reply)
+	}
+	bus.Publish(events.Event{Type: events.TxMatched, BlockNum: 11, Transaction: storage.Transaction{Hash: "0x3", BlockNum: 11, To: streamAddress1}, Addresses: []storage.Address{streamAddress1}})
+	bus.Publish(events.Event{Type: events.CursorAdvanced, BlockNum: 11})
+	if message := readMessage(t, conn); message.Type != streamEventCursor || message.Cursor != 11 {
+		t.Errorf("Expected the transaction of the unwatched address to be skipped, got %+v", message)
+	}
+}
+
+func TestHandleWebSocket_InvalidRequests(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	mockParser := parser.NewMockParser(ctrl)
+	mockParser.EXPECT().GetSubscriptions().Return([]storage.Subscription{{Address: streamAddress1}}).AnyTimes()
+	srv := NewHttpServer(":8080", mockParser, WithEventBus(events.NewBus()))
+	conn := openWebSocket(t, srv.(*HttpServer))
+
+	tests := []struct {
+		name    string
+		request interface{}
+		err     string
+	}{
+		{"NotSubscribed", wsRequest{Action: wsActionSubscribe, Addresses: []string{streamAddress2.String()}}, "Address not subscribed: " + streamAddress2.String()},
+		{"InvalidAddress", wsRequest{Action: wsActionSubscribe, Addresses: []string{"invalid"}}, "Invalid Ethereum address: invalid"},
+		{"UnknownAction", wsRequest{Action: "watch"}, "Unknown action: watch"},
+		{"InvalidMessage", "subscribe", "Invalid message"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if reply := request(t, conn, tt.request); reply.Type != wsMessageError || reply.Error != tt.err {
+				t.Errorf("Expected error %q, got %+v", tt.err, reply)
+			}
+		})
+	}
+}
+
+func TestHandleWebSocket_DisconnectsSlowClient(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	srv := NewHttpServer(":8080", parser.NewMockParser(ctrl), WithEventBus(events.NewBus())).(*HttpServer)
+	// the writer of a client whose subscription was closed by the bus, as it
+	// is once its buffer is full
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		client := srv.subscribeStream("websocket", []events.Type{events.CursorAdvanced}, nil)
+		client.subscription.Close()
+		srv.writeWebSocket(r.Context(), conn, client, nil, nil)
+	}))
+	defer ts.Close()
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseTryAgainLater) {
+		t.Errorf("Expected the connection to be closed with %d, got %v", websocket.CloseTryAgainLater, err)
+	}
+}
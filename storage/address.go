@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/sha3"
+)
+
+// Address is an Ethereum address in its canonical lowercase form. Nodes and
+// users spell the same address in different cases, everything stored for an
+// address is keyed by its Address so they all match.
+type Address string
+
+// NormalizeAddress returns the canonical form of the address, it does not
+// validate it.
+func NormalizeAddress(address string) Address {
+	return Address(strings.ToLower(address))
+}
+
+// ParseAddress validates a 0x prefixed address of 20 bytes. An address in a
+// single case is taken as is, a mixed-case address must carry a valid EIP-55
+// checksum since it is most likely mistyped otherwise.
+func ParseAddress(address string) (Address, error) {
+	digits, found := strings.CutPrefix(address, "0x")
+	if !found || len(digits) != 40 {
+		return "", fmt.Errorf("invalid address %q", address)
+	}
+	if _, err := hex.DecodeString(digits); err != nil {
+		return "", fmt.Errorf("invalid address %q", address)
+	}
+
+	normalized := NormalizeAddress(address)
+	if digits != strings.ToLower(digits) && digits != strings.ToUpper(digits) && address != normalized.Checksum() {
+		return "", fmt.Errorf("invalid checksum of address %q", address)
+	}
+	return normalized, nil
+}
+
+// Checksum returns the EIP-55 mixed-case encoding of the address, a hex digit
+// is uppercased when the matching nibble of the Keccak-256 hash of the
+// lowercase address is 8 or more.
+func (a Address) Checksum() string {
+	digits := strings.TrimPrefix(string(a), "0x")
+	hash := sha3.NewLegacyKeccak256()
+	hash.Write([]byte(digits))
+	sum := hash.Sum(nil)
+
+	checksummed := []byte(digits)
+	for i, c := range checksummed {
+		nibble := sum[i/2] >> 4
+		if i%2 == 1 {
+			nibble = sum[i/2] & 0x0f
+		}
+		if c >= 'a' && c <= 'f' && nibble >= 8 {
+			checksummed[i] = c - 'a' + 'A'
+		}
+	}
+	return "0x" + string(checksummed)
+}
+
+func (a Address) String() string {
+	return string(a)
+}
+
+// UnmarshalJSON normalizes the address, the file storage logs could hold
+// addresses in any case before they were normalized.
+func (a *Address) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*a = NormalizeAddress(s)
+	return nil
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Address
+		wantErr  bool
+	}{
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", false},
+		{"0x5AAEB6053F3E94C9B9A09F33669435E7EF1BEAED", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", false},
+		// EIP-55 test vectors
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed", "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed", false},
+		{"0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359", "0xfb6916095ca1df60bb79ce92ce3ea74c37c5d359", false},
+		{"0xdbF03B407c01E7cD3CBea99509d93f8DDDC8C6FB", "0xdbf03b407c01e7cd3cbea99509d93f8dddc8c6fb", false},
+		{"0xD1220A0cf47c7B9Be7A2E6BA89F429762e7b9aDb", "0xd1220a0cf47c7b9be7a2e6ba89f429762e7b9adb", false},
+		// a single letter in the wrong case
+		{"0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAeD", "", true},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1bea", "", true},
+		{"5aaeb6053f3e94c9b9a09f33669435e7ef1beaed00", "", true},
+		{"0x5aaeb6053f3e94c9b9a09f33669435e7ef1beazz", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			address, err := ParseAddress(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if address != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, address)
+			}
+		})
+	}
+}
+
+func TestAddress_Checksum(t *testing.T) {
+	address := NormalizeAddress("0xFB6916095CA1DF60BB79CE92CE3EA74C37C5D359")
+	if checksum := address.Checksum(); checksum != "0xfB6916095ca1df60bB79Ce92cE3Ea74c37c5d359" {
+		t.Errorf("Expected the EIP-55 checksum, got %q", checksum)
+	}
+}
+
+func TestAddress_UnmarshalJSON(t *testing.T) {
+	var subscription Subscription
+	if err := json.Unmarshal([]byte(`{"Address": "0x5aAeb6053F3E94C9b9A09f33669435E7Ef1BeAed"}`), &subscription); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if subscription.Address != "0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed" {
+		t.Errorf("Expected the address to be normalized, got %q", subscription.Address)
+	}
+}
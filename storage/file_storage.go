@@ -0,0 +1,438 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+const (
+	opSubscribe                   = "subscribe"
+	opUnsubscribe                 = "unsubscribe"
+	opAddTransactions             = "add_transactions"
+	opAddAddressTransactions      = "add_address_transactions"
+	opSetTransactions             = "set_transactions"
+	opAddTokenTransfers           = "add_token_transfers"
+	opAddAddressTokenTransfers    = "add_address_token_transfers"
+	opSetTokenTransfers           = "set_token_transfers"
+	opAddNftTransfers             = "add_nft_transfers"
+	opAddAddressNftTransfers      = "add_address_nft_transfers"
+	opSetNftTransfers             = "set_nft_transfers"
+	opAddInternalTransfers        = "add_internal_transfers"
+	opAddAddressInternalTransfers = "add_address_internal_transfers"
+	opSetInternalTransfers        = "set_internal_transfers"
+	opRollbackBlock               = "rollback_block"
+	opUpdateCurrentBlock          = "update_current_block"
+	opSaveBackfillJob             = "save_backfill_job"
+	opSaveDelivery                = "save_delivery"
+)
+
+// logEntry is a single mutation in the append-only log. Only the fields
+// needed by its operation are set.
+type logEntry struct {
+	Op                string             `json:"op"`
+	Address           Address            `json:"address,omitempty"`
+	Subscription      *Subscription      `json:"subscription,omitempty"`
+	Purge             bool               `json:"purge,omitempty"`
+	Transactions      []Transaction      `json:"transactions,omitempty"`
+	TokenTransfers    []TokenTransfer    `json:"tokenTransfers,omitempty"`
+	NftTransfers      []NftTransfer      `json:"nftTransfers,omitempty"`
+	InternalTransfers []InternalTransfer `json:"internalTransfers,omitempty"`
+	Block             int                `json:"block,omitempty"`
+	BackfillJob       *BackfillJob       `json:"backfillJob,omitempty"`
+	Delivery          *WebhookDelivery   `json:"delivery,omitempty"`
+}
+
+// FileStorage keeps its data in memory, which acts as the index, and records
+// every mutation in an append-only log file. The log is replayed when the
+// storage is opened and then compacted into a snapshot of the current state.
+// Of the records added, only the ones that were stored are logged, since most
+// records of a block touch no observed address.
+type FileStorage struct {
+	memory *MemoryStorage
+	path   string
+	file   *os.File
+	writer *bufio.Writer
+	mu     sync.Mutex
+}
+
+func NewFileStorage(path string) (*FileStorage, error) {
+	s := &FileStorage{
+		memory: NewMemoryStorage().(*MemoryStorage),
+		path:   path,
+	}
+
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *FileStorage) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush storage log: %v", err)
+	}
+	return s.file.Close()
+}
+
+func (s *FileStorage) AddSubscription(subscription Subscription) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.memory.AddSubscription(subscription) {
+		return false
+	}
+	s.append(logEntry{Op: opSubscribe, Address: subscription.Address, Subscription: &subscription})
+	return true
+}
+
+func (s *FileStorage) RemoveSubscription(address Address, purge bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.memory.RemoveSubscription(address, purge) {
+		return false
+	}
+	s.append(logEntry{Op: opUnsubscribe, Address: address, Purge: purge})
+	return true
+}
+
+func (s *FileStorage) GetSubscription(address Address) (Subscription, bool) {
+	return s.memory.GetSubscription(address)
+}
+
+func (s *FileStorage) GetSubscriptions() []Subscription {
+	return s.memory.GetSubscriptions()
+}
+
+func (s *FileStorage) GetTransactions(address Address) []Transaction {
+	return s.memory.GetTransactions(address)
+}
+
+// QueryTransactions is answered from the ordered in-memory index, rebuilt from
+// the log on startup.
+func (s *FileStorage) QueryTransactions(address Address, query TransactionQuery) TransactionPage {
+	return s.memory.QueryTransactions(address, query)
+}
+
+func (s *FileStorage) AddTransactions(txs ...Transaction) []TransactionMatch {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored := addRecords(s.memory, s.memory.transactions, txs)
+	if len(stored) > 0 {
+		s.append(logEntry{Op: opAddTransactions, Transactions: recordsOf(stored)})
+	}
+	return transactionMatches(stored)
+}
+
+func (s *FileStorage) AddAddressTransactions(address Address, txs ...Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := addAddressRecords(s.memory, s.memory.transactions, address, txs); len(stored) > 0 {
+		s.append(logEntry{Op: opAddAddressTransactions, Address: address, Transactions: stored})
+	}
+}
+
+func (s *FileStorage) GetTokenTransfers(address Address) []TokenTransfer {
+	return s.memory.GetTokenTransfers(address)
+}
+
+func (s *FileStorage) AddTokenTransfers(transfers ...TokenTransfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := addRecords(s.memory, s.memory.tokenTransfers, transfers); len(stored) > 0 {
+		s.append(logEntry{Op: opAddTokenTransfers, TokenTransfers: recordsOf(stored)})
+	}
+}
+
+func (s *FileStorage) AddAddressTokenTransfers(address Address, transfers ...TokenTransfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := addAddressRecords(s.memory, s.memory.tokenTransfers, address, transfers); len(stored) > 0 {
+		s.append(logEntry{Op: opAddAddressTokenTransfers, Address: address, TokenTransfers: stored})
+	}
+}
+
+func (s *FileStorage) GetNftTransfers(address Address) []NftTransfer {
+	return s.memory.GetNftTransfers(address)
+}
+
+func (s *FileStorage) AddNftTransfers(transfers ...NftTransfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := addRecords(s.memory, s.memory.nftTransfers, transfers); len(stored) > 0 {
+		s.append(logEntry{Op: opAddNftTransfers, NftTransfers: recordsOf(stored)})
+	}
+}
+
+func (s *FileStorage) AddAddressNftTransfers(address Address, transfers ...NftTransfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := addAddressRecords(s.memory, s.memory.nftTransfers, address, transfers); len(stored) > 0 {
+		s.append(logEntry{Op: opAddAddressNftTransfers, Address: address, NftTransfers: stored})
+	}
+}
+
+func (s *FileStorage) GetInternalTransfers(address Address) []InternalTransfer {
+	return s.memory.GetInternalTransfers(address)
+}
+
+func (s *FileStorage) AddInternalTransfers(transfers ...InternalTransfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := addRecords(s.memory, s.memory.internalTransfers, transfers); len(stored) > 0 {
+		s.append(logEntry{Op: opAddInternalTransfers, InternalTransfers: recordsOf(stored)})
+	}
+}
+
+func (s *FileStorage) AddAddressInternalTransfers(address Address, transfers ...InternalTransfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored := addAddressRecords(s.memory, s.memory.internalTransfers, address, transfers); len(stored) > 0 {
+		s.append(logEntry{Op: opAddAddressInternalTransfers, Address: address, InternalTransfers: stored})
+	}
+}
+
+func (s *FileStorage) RollbackBlock(blockNum int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.memory.RollbackBlock(blockNum)
+	s.append(logEntry{Op: opRollbackBlock, Block: blockNum})
+}
+
+func (s *FileStorage) GetCurrentBlock() int {
+	return s.memory.GetCurrentBlock()
+}
+
+func (s *FileStorage) UpdateCurrentBlock(block int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.memory.UpdateCurrentBlock(block)
+	s.append(logEntry{Op: opUpdateCurrentBlock, Block: block})
+}
+
+func (s *FileStorage) SaveBackfillJob(job BackfillJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.memory.SaveBackfillJob(job)
+	s.append(logEntry{Op: opSaveBackfillJob, BackfillJob: &job})
+}
+
+func (s *FileStorage) GetBackfillJobs() []BackfillJob {
+	return s.memory.GetBackfillJobs()
+}
+
+func (s *FileStorage) SaveDelivery(delivery WebhookDelivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.memory.SaveDelivery(delivery)
+	s.append(logEntry{Op: opSaveDelivery, Delivery: &delivery})
+}
+
+func (s *FileStorage) GetDelivery(id string) (WebhookDelivery, bool) {
+	return s.memory.GetDelivery(id)
+}
+
+func (s *FileStorage) GetDeliveries(address Address) []WebhookDelivery {
+	return s.memory.GetDeliveries(address)
+}
+
+func (s *FileStorage) GetPendingDeliveries() []WebhookDelivery {
+	return s.memory.GetPendingDeliveries()
+}
+
+// append writes an entry to the log and syncs it to disk. The in-memory state
+// stays authoritative for the running process, so failures are only logged.
+func (s *FileStorage) append(entry logEntry) {
+	if err := writeEntry(s.writer, entry); err != nil {
+		log.Printf("Error writing to storage log %s: %v", s.path, err)
+		return
+	}
+	if err := s.writer.Flush(); err != nil {
+		log.Printf("Error flushing storage log %s: %v", s.path, err)
+		return
+	}
+	if err := s.file.Sync(); err != nil {
+		log.Printf("Error syncing storage log %s: %v", s.path, err)
+	}
+}
+
+func (s *FileStorage) replay() error {
+	file, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open storage log: %v", err)
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(file))
+	for {
+		var entry logEntry
+		err := decoder.Decode(&entry)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			// a crash can leave a partially written entry at the end of the
+			// log, everything before it is still valid
+			log.Printf("Ignoring unreadable tail of storage log %s: %v", s.path, err)
+			return nil
+		}
+		if err := s.apply(entry); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *FileStorage) apply(entry logEntry) error {
+	switch entry.Op {
+	case opSubscribe:
+		// logs written before subscriptions had metadata only hold the address
+		subscription := Subscription{Address: entry.Address}
+		if entry.Subscription != nil {
+			subscription = *entry.Subscription
+		}
+		s.memory.AddSubscription(subscription)
+	case opUnsubscribe:
+		s.memory.RemoveSubscription(entry.Address, entry.Purge)
+	case opAddTransactions:
+		s.memory.AddTransactions(entry.Transactions...)
+	case opAddAddressTransactions:
+		s.memory.AddAddressTransactions(entry.Address, entry.Transactions...)
+	case opSetTransactions:
+		s.memory.setTransactions(entry.Address, entry.Transactions)
+	case opAddTokenTransfers:
+		s.memory.AddTokenTransfers(entry.TokenTransfers...)
+	case opAddAddressTokenTransfers:
+		s.memory.AddAddressTokenTransfers(entry.Address, entry.TokenTransfers...)
+	case opSetTokenTransfers:
+		s.memory.setTokenTransfers(entry.Address, entry.TokenTransfers)
+	case opAddNftTransfers:
+		s.memory.AddNftTransfers(entry.NftTransfers...)
+	case opAddAddressNftTransfers:
+		s.memory.AddAddressNftTransfers(entry.Address, entry.NftTransfers...)
+	case opSetNftTransfers:
+		s.memory.setNftTransfers(entry.Address, entry.NftTransfers)
+	case opAddInternalTransfers:
+		s.memory.AddInternalTransfers(entry.InternalTransfers...)
+	case opAddAddressInternalTransfers:
+		s.memory.AddAddressInternalTransfers(entry.Address, entry.InternalTransfers...)
+	case opSetInternalTransfers:
+		s.memory.setInternalTransfers(entry.Address, entry.InternalTransfers)
+	case opRollbackBlock:
+		s.memory.RollbackBlock(entry.Block)
+	case opUpdateCurrentBlock:
+		s.memory.UpdateCurrentBlock(entry.Block)
+	case opSaveBackfillJob:
+		if entry.BackfillJob != nil {
+			s.memory.SaveBackfillJob(*entry.BackfillJob)
+		}
+	case opSaveDelivery:
+		if entry.Delivery != nil {
+			s.memory.SaveDelivery(*entry.Delivery)
+		}
+	default:
+		return fmt.Errorf("unknown operation %q in storage log", entry.Op)
+	}
+	return nil
+}
+
+// compact replaces the log with the entries needed to rebuild the current
+// state and opens it for appending.
+func (s *FileStorage) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create storage snapshot: %v", err)
+	}
+
+	writer := bufio.NewWriter(tmp)
+	for _, entry := range s.snapshot() {
+		if err := writeEntry(writer, entry); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to write storage snapshot: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write storage snapshot: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync storage snapshot: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close storage snapshot: %v", err)
+	}
+
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("failed to replace storage log: %v", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open storage log: %v", err)
+	}
+	s.file = file
+	s.writer = bufio.NewWriter(file)
+	return nil
+}
+
+func (s *FileStorage) snapshot() []logEntry {
+	s.memory.mu.RLock()
+	defer s.memory.mu.RUnlock()
+
+	entries := []logEntry{}
+	for address, subscription := range s.memory.observedAddresses {
+		entries = append(entries, logEntry{Op: opSubscribe, Address: address, Subscription: &subscription})
+	}
+	for address, txs := range s.memory.transactions.byAddress {
+		if len(txs) > 0 {
+			entries = append(entries, logEntry{Op: opSetTransactions, Address: address, Transactions: txs})
+		}
+	}
+	for address, transfers := range s.memory.tokenTransfers.byAddress {
+		if len(transfers) > 0 {
+			entries = append(entries, logEntry{Op: opSetTokenTransfers, Address: address, TokenTransfers: transfers})
+		}
+	}
+	for address, transfers := range s.memory.nftTransfers.byAddress {
+		if len(transfers) > 0 {
+			entries = append(entries, logEntry{Op: opSetNftTransfers, Address: address, NftTransfers: transfers})
+		}
+	}
+	for address, transfers := range s.memory.internalTransfers.byAddress {
+		if len(transfers) > 0 {
+			entries = append(entries, logEntry{Op: opSetInternalTransfers, Address: address, InternalTransfers: transfers})
+		}
+	}
+	for _, job := range s.memory.backfillJobs {
+		entries = append(entries, logEntry{Op: opSaveBackfillJob, BackfillJob: &job})
+	}
+	for _, delivery := range s.memory.deliveries {
+		entries = append(entries, logEntry{Op: opSaveDelivery, Delivery: &delivery})
+	}
+	entries = append(entries, logEntry{Op: opUpdateCurrentBlock, Block: s.memory.currentBlock})
+	return entries
+}
+
+func writeEntry(w io.Writer, entry logEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
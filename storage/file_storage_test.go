@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func openFileStorage(t *testing.T, path string) *FileStorage {
+	t.Helper()
+	storage, err := NewFileStorage(path)
+	if err != nil {
+		t.Fatalf("Failed to open file storage: %v", err)
+	}
+	return storage
+}
+
+func TestFileStorage_SurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.log")
+
+	storage := openFileStorage(t, path)
+	subscription := Subscription{Address: "address1", Label: "treasury", CreatedAt: time.Date(2024, 11, 14, 10, 0, 0, 0, time.UTC), StartBlock: 1}
+	storage.AddSubscription(subscription)
+	storage.AddSubscription(Subscription{Address: "address2"})
+	storage.AddTransactions(Transaction{Hash: "tx0", From: "address2", To: "address3", BlockNum: 1})
+	storage.RemoveSubscription("address2", true)
+	tx1 := Transaction{Hash: "tx1", From: "address1", To: "address2", Value: NewQuantityFromUint64(1), BlockNum: 1}
+	tx2 := Transaction{Hash: "tx2", From: "address2", To: "address1", Value: NewQuantityFromUint64(2), BlockNum: 2}
+	storage.AddTransactions(tx1, tx2)
+	transfer := TokenTransfer{TxHash: "tx3", Token: "token1", From: "address2", To: "address1", Value: NewQuantityFromUint64(3), BlockNum: 1}
+	storage.AddTokenTransfers(transfer)
+	nftTransfer := NftTransfer{TxHash: "tx4", Contract: "nft1", Standard: StandardErc721, From: "address1", To: "address2", TokenID: NewQuantityFromUint64(1), Amount: NewQuantityFromUint64(1), BlockNum: 1}
+	storage.AddNftTransfers(nftTransfer)
+	internalTransfer := InternalTransfer{TxHash: "tx5", TraceAddress: []int{0, 1}, CallType: CallTypeCall, From: "contract1", To: "address1", Value: NewQuantityFromUint64(5), BlockNum: 1}
+	storage.AddInternalTransfers(internalTransfer)
+	storage.RollbackBlock(2)
+	storage.UpdateCurrentBlock(2)
+	job := BackfillJob{Address: "address1", FromBlock: 0, ToBlock: 2, NextBlock: 1}
+	storage.SaveBackfillJob(job)
+	delivery := WebhookDelivery{ID: "d1", Address: "address1", URL: "http://hooks", Transaction: tx1, Status: DeliveryStatusPending, NextAttempt: time.Date(2024, 11, 14, 10, 1, 0, 0, time.UTC)}
+	storage.SaveDelivery(delivery)
+	delivery.Attempts, delivery.LastStatusCode = 1, 500
+	storage.SaveDelivery(delivery)
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Failed to close file storage: %v", err)
+	}
+
+	// opened twice to cover both replaying the raw log and the compacted snapshot
+	for i := 0; i < 2; i++ {
+		storage = openFileStorage(t, path)
+
+		if subscriptions := storage.GetSubscriptions(); !reflect.DeepEqual(subscriptions, []Subscription{subscription}) {
+			t.Errorf("Expected only the subscription of address1 to be restored, got %+v", subscriptions)
+		}
+		if txs := storage.GetTransactions("address2"); len(txs) != 0 {
+			t.Errorf("Expected the transactions of address2 to stay purged, got %+v", txs)
+		}
+		if txs := storage.GetTransactions("address1"); !reflect.DeepEqual(txs, []Transaction{tx1}) {
+			t.Errorf("Expected only tx1 to be restored, got %+v", txs)
+		}
+		if transfers := storage.GetTokenTransfers("address1"); !reflect.DeepEqual(transfers, []TokenTransfer{transfer}) {
+			t.Errorf("Expected the token transfer to be restored, got %+v", transfers)
+		}
+		if transfers := storage.GetNftTransfers("address1"); !reflect.DeepEqual(transfers, []NftTransfer{nftTransfer}) {
+			t.Errorf("Expected the NFT transfer to be restored, got %+v", transfers)
+		}
+		if transfers := storage.GetInternalTransfers("address1"); !reflect.DeepEqual(transfers, []InternalTransfer{internalTransfer}) {
+			t.Errorf("Expected the internal transfer to be restored, got %+v", transfers)
+		}
+		if storage.GetCurrentBlock() != 2 {
+			t.Errorf("Expected current block 2, got %d", storage.GetCurrentBlock())
+		}
+		if jobs := storage.GetBackfillJobs(); !reflect.DeepEqual(jobs, []BackfillJob{job}) {
+			t.Errorf("Expected backfill job to be restored, got %+v", jobs)
+		}
+		if deliveries := storage.GetPendingDeliveries(); !reflect.DeepEqual(deliveries, []WebhookDelivery{delivery}) {
+			t.Errorf("Expected the pending delivery to be restored, got %+v", deliveries)
+		}
+
+		if err := storage.Close(); err != nil {
+			t.Fatalf("Failed to close file storage: %v", err)
+		}
+	}
+}
+
+func TestFileStorage_LogsOnlyStoredRecords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.log")
+	storage := openFileStorage(t, path)
+	defer storage.Close()
+	storage.AddSubscription(Subscription{Address: "address1"})
+
+	logSize := func() int64 {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatalf("Failed to stat storage log: %v", err)
+		}
+		return info.Size()
+	}
+	size := logSize()
+
+	tx := Transaction{Hash: "tx1", From: "address1", To: "address2", BlockNum: 1}
+	unrelated := Transaction{Hash: "tx2", From: "address2", To: "address3", Input: "0x" + strings.Repeat("ab", 1024), BlockNum: 1}
+	storage.AddTransactions(unrelated)
+	storage.AddTokenTransfers(TokenTransfer{TxHash: "tx2", From: "address2", To: "address3", BlockNum: 1})
+	storage.AddNftTransfers(NftTransfer{TxHash: "tx2", From: "address2", To: "address3", BlockNum: 1})
+	storage.AddInternalTransfers(InternalTransfer{TxHash: "tx2", From: "address2", To: "address3", BlockNum: 1})
+	storage.AddAddressTransactions("address1", unrelated)
+	if logSize() != size {
+		t.Fatalf("Expected records touching no observed address not to be logged")
+	}
+
+	storage.AddTransactions(tx, unrelated)
+	storage.AddTransactions(tx)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read storage log: %v", err)
+	}
+	if strings.Count(string(data), `"Hash":"tx1"`) != 1 || strings.Contains(string(data), `"Hash":"tx2"`) {
+		t.Errorf("Expected only tx1 to be logged, once, got %s", data)
+	}
+}
+
+func TestFileStorage_IgnoresTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.log")
+
+	storage := openFileStorage(t, path)
+	storage.UpdateCurrentBlock(10)
+	if err := storage.Close(); err != nil {
+		t.Fatalf("Failed to close file storage: %v", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatalf("Failed to open storage log: %v", err)
+	}
+	if _, err := file.WriteString(`{"op":"update_current_block","blo`); err != nil {
+		t.Fatalf("Failed to write storage log: %v", err)
+	}
+	file.Close()
+
+	storage = openFileStorage(t, path)
+	defer storage.Close()
+
+	if storage.GetCurrentBlock() != 10 {
+		t.Errorf("Expected current block 10, got %d", storage.GetCurrentBlock())
+	}
+}
+
+func TestFileStorage_UnknownOperation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "storage.log")
+	if err := os.WriteFile(path, []byte(`{"op":"unknown"}`+"\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write storage log: %v", err)
+	}
+
+	if _, err := NewFileStorage(path); err == nil {
+		t.Errorf("Expected an error for an unknown operation")
+	}
+}
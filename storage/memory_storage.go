@@ -1,54 +1,229 @@
 package storage
 
 import (
+	"sort"
 	"sync"
 )
 
 type MemoryStorage struct {
-	observedAddresses map[string]struct{}
-	transactions      map[string][]Transaction
+	observedAddresses map[Address]Subscription
+	transactions      *records[Transaction]
+	tokenTransfers    *records[TokenTransfer]
+	nftTransfers      *records[NftTransfer]
+	internalTransfers *records[InternalTransfer]
 	currentBlock      int
+	backfillJobs      map[Address]BackfillJob
+	deliveries        map[string]WebhookDelivery
 	mu                sync.RWMutex
 }
 
 func NewMemoryStorage() Storage {
 	return &MemoryStorage{
-		observedAddresses: make(map[string]struct{}),
-		transactions:      make(map[string][]Transaction),
+		observedAddresses: make(map[Address]Subscription),
+		// kept ordered by position so queries can search the block range
+		transactions: newRecords(func(a, b Transaction) int {
+			return cursorOf(a).compare(cursorOf(b))
+		}),
+		tokenTransfers:    newRecords[TokenTransfer](nil),
+		nftTransfers:      newRecords[NftTransfer](nil),
+		internalTransfers: newRecords[InternalTransfer](nil),
 		currentBlock:      0,
+		backfillJobs:      make(map[Address]BackfillJob),
+		deliveries:        make(map[string]WebhookDelivery),
 	}
 }
 
-func (s *MemoryStorage) AddObservedAddress(address string) bool {
+func (s *MemoryStorage) AddSubscription(subscription Subscription) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if _, exists := s.observedAddresses[address]; exists {
+	if _, exists := s.observedAddresses[subscription.Address]; exists {
 		return false
 	}
-	s.observedAddresses[address] = struct{}{}
+	s.observedAddresses[subscription.Address] = subscription
 	return true
 }
 
-func (s *MemoryStorage) GetTransactions(address string) []Transaction {
+func (s *MemoryStorage) RemoveSubscription(address Address, purge bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.observedAddresses[address]; !exists {
+		return false
+	}
+	delete(s.observedAddresses, address)
+	delete(s.backfillJobs, address)
+	for id, delivery := range s.deliveries {
+		if delivery.Address == address && (purge || delivery.Status == DeliveryStatusPending) {
+			delete(s.deliveries, id)
+		}
+	}
+	if purge {
+		s.transactions.drop(address)
+		s.tokenTransfers.drop(address)
+		s.nftTransfers.drop(address)
+		s.internalTransfers.drop(address)
+	}
+	return true
+}
+
+func (s *MemoryStorage) GetSubscription(address Address) (Subscription, bool) {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return s.transactions[address]
+	subscription, exists := s.observedAddresses[address]
+	return subscription, exists
 }
 
-func (s *MemoryStorage) AddTransactions(txs ...Transaction) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-	for _, tx := range txs {
-		if _, exists := s.observedAddresses[tx.From]; exists {
-			s.transactions[tx.From] = append(s.transactions[tx.From], tx)
+func (s *MemoryStorage) GetSubscriptions() []Subscription {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	subscriptions := make([]Subscription, 0, len(s.observedAddresses))
+	for _, subscription := range s.observedAddresses {
+		subscriptions = append(subscriptions, subscription)
+	}
+	sort.Slice(subscriptions, func(i, j int) bool {
+		if !subscriptions[i].CreatedAt.Equal(subscriptions[j].CreatedAt) {
+			return subscriptions[i].CreatedAt.Before(subscriptions[j].CreatedAt)
 		}
+		return subscriptions[i].Address < subscriptions[j].Address
+	})
+	return subscriptions
+}
+
+func (s *MemoryStorage) GetTransactions(address Address) []Transaction {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.transactions.get(address)
+}
+
+func (s *MemoryStorage) AddTransactions(txs ...Transaction) []TransactionMatch {
+	return transactionMatches(addRecords(s, s.transactions, txs))
+}
+
+func (s *MemoryStorage) AddAddressTransactions(address Address, txs ...Transaction) {
+	addAddressRecords(s, s.transactions, address, txs)
+}
 
-		if tx.To != "" {
-			if _, exists := s.observedAddresses[tx.To]; exists {
-				s.transactions[tx.To] = append(s.transactions[tx.To], tx)
+// QueryTransactions walks the ordered transactions of the address from the
+// edge of the block range the query starts at.
+func (s *MemoryStorage) QueryTransactions(address Address, query TransactionQuery) TransactionPage {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	txs := s.transactions.get(address)
+
+	from := sort.Search(len(txs), func(i int) bool { return txs[i].BlockNum >= query.FromBlock })
+	to := len(txs)
+	if query.ToBlock > 0 {
+		to = sort.Search(len(txs), func(i int) bool { return txs[i].BlockNum > query.ToBlock })
+	}
+
+	var page TransactionPage
+	for n := 0; n < to-from; n++ {
+		tx := txs[from+n]
+		if query.Descending {
+			tx = txs[to-1-n]
+		}
+		if !query.matches(address, tx) {
+			continue
+		}
+		page.Total++
+
+		if query.After != nil {
+			order := cursorOf(tx).compare(*query.After)
+			if query.Descending {
+				order = -order
+			}
+			if order <= 0 {
+				continue
+			}
+		}
+		if query.Limit > 0 && len(page.Transactions) == query.Limit {
+			if page.Next == nil {
+				next := cursorOf(page.Transactions[len(page.Transactions)-1])
+				page.Next = &next
 			}
+			continue
 		}
+		page.Transactions = append(page.Transactions, tx)
 	}
+	return page
+}
+
+// setTransactions replaces everything stored for an address, used to restore snapshots
+func (s *MemoryStorage) setTransactions(address Address, txs []Transaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions.set(address, txs)
+}
+
+func (s *MemoryStorage) GetTokenTransfers(address Address) []TokenTransfer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.tokenTransfers.get(address)
+}
+
+func (s *MemoryStorage) AddTokenTransfers(transfers ...TokenTransfer) {
+	addRecords(s, s.tokenTransfers, transfers)
+}
+
+func (s *MemoryStorage) AddAddressTokenTransfers(address Address, transfers ...TokenTransfer) {
+	addAddressRecords(s, s.tokenTransfers, address, transfers)
+}
+
+// setTokenTransfers replaces every token transfer stored for an address, used to restore snapshots
+func (s *MemoryStorage) setTokenTransfers(address Address, transfers []TokenTransfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenTransfers.set(address, transfers)
+}
+
+func (s *MemoryStorage) GetNftTransfers(address Address) []NftTransfer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nftTransfers.get(address)
+}
+
+func (s *MemoryStorage) AddNftTransfers(transfers ...NftTransfer) {
+	addRecords(s, s.nftTransfers, transfers)
+}
+
+func (s *MemoryStorage) AddAddressNftTransfers(address Address, transfers ...NftTransfer) {
+	addAddressRecords(s, s.nftTransfers, address, transfers)
+}
+
+// setNftTransfers replaces every NFT transfer stored for an address, used to restore snapshots
+func (s *MemoryStorage) setNftTransfers(address Address, transfers []NftTransfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nftTransfers.set(address, transfers)
+}
+
+func (s *MemoryStorage) GetInternalTransfers(address Address) []InternalTransfer {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.internalTransfers.get(address)
+}
+
+func (s *MemoryStorage) AddInternalTransfers(transfers ...InternalTransfer) {
+	addRecords(s, s.internalTransfers, transfers)
+}
+
+func (s *MemoryStorage) AddAddressInternalTransfers(address Address, transfers ...InternalTransfer) {
+	addAddressRecords(s, s.internalTransfers, address, transfers)
+}
+
+// setInternalTransfers replaces every internal transfer stored for an address, used to restore snapshots
+func (s *MemoryStorage) setInternalTransfers(address Address, transfers []InternalTransfer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.internalTransfers.set(address, transfers)
+}
+
+func (s *MemoryStorage) RollbackBlock(blockNum int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transactions.rollback(blockNum)
+	s.tokenTransfers.rollback(blockNum)
+	s.nftTransfers.rollback(blockNum)
+	s.internalTransfers.rollback(blockNum)
 }
 
 func (s *MemoryStorage) GetCurrentBlock() int {
@@ -62,3 +237,69 @@ func (s *MemoryStorage) UpdateCurrentBlock(block int) {
 	defer s.mu.Unlock()
 	s.currentBlock = block
 }
+
+func (s *MemoryStorage) SaveBackfillJob(job BackfillJob) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.backfillJobs[job.Address] = job
+}
+
+func (s *MemoryStorage) GetBackfillJobs() []BackfillJob {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	jobs := make([]BackfillJob, 0, len(s.backfillJobs))
+	for _, job := range s.backfillJobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Address < jobs[j].Address })
+	return jobs
+}
+
+func (s *MemoryStorage) SaveDelivery(delivery WebhookDelivery) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries[delivery.ID] = delivery
+}
+
+func (s *MemoryStorage) GetDelivery(id string) (WebhookDelivery, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	delivery, exists := s.deliveries[id]
+	return delivery, exists
+}
+
+func (s *MemoryStorage) GetDeliveries(address Address) []WebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	deliveries := []WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.Address == address {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].CreatedAt.Equal(deliveries[j].CreatedAt) {
+			return deliveries[i].CreatedAt.Before(deliveries[j].CreatedAt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries
+}
+
+func (s *MemoryStorage) GetPendingDeliveries() []WebhookDelivery {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	deliveries := []WebhookDelivery{}
+	for _, delivery := range s.deliveries {
+		if delivery.Status == DeliveryStatusPending {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool {
+		if !deliveries[i].NextAttempt.Equal(deliveries[j].NextAttempt) {
+			return deliveries[i].NextAttempt.Before(deliveries[j].NextAttempt)
+		}
+		return deliveries[i].ID < deliveries[j].ID
+	})
+	return deliveries
+}
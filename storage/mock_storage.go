@@ -33,28 +33,146 @@ func (m *MockStorage) EXPECT() *MockStorageMockRecorder {
 	return m.recorder
 }
 
-// AddObservedAddress mocks base method.
-func (m *MockStorage) AddObservedAddress(arg0 string) bool {
+// AddAddressInternalTransfers mocks base method.
+func (m *MockStorage) AddAddressInternalTransfers(arg0 Address, arg1 ...InternalTransfer) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddObservedAddress", arg0)
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "AddAddressInternalTransfers", varargs...)
+}
+
+// AddAddressInternalTransfers indicates an expected call of AddAddressInternalTransfers.
+func (mr *MockStorageMockRecorder) AddAddressInternalTransfers(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAddressInternalTransfers", reflect.TypeOf((*MockStorage)(nil).AddAddressInternalTransfers), varargs...)
+}
+
+// AddAddressNftTransfers mocks base method.
+func (m *MockStorage) AddAddressNftTransfers(arg0 Address, arg1 ...NftTransfer) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "AddAddressNftTransfers", varargs...)
+}
+
+// AddAddressNftTransfers indicates an expected call of AddAddressNftTransfers.
+func (mr *MockStorageMockRecorder) AddAddressNftTransfers(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAddressNftTransfers", reflect.TypeOf((*MockStorage)(nil).AddAddressNftTransfers), varargs...)
+}
+
+// AddAddressTokenTransfers mocks base method.
+func (m *MockStorage) AddAddressTokenTransfers(arg0 Address, arg1 ...TokenTransfer) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "AddAddressTokenTransfers", varargs...)
+}
+
+// AddAddressTokenTransfers indicates an expected call of AddAddressTokenTransfers.
+func (mr *MockStorageMockRecorder) AddAddressTokenTransfers(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAddressTokenTransfers", reflect.TypeOf((*MockStorage)(nil).AddAddressTokenTransfers), varargs...)
+}
+
+// AddAddressTransactions mocks base method.
+func (m *MockStorage) AddAddressTransactions(arg0 Address, arg1 ...Transaction) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "AddAddressTransactions", varargs...)
+}
+
+// AddAddressTransactions indicates an expected call of AddAddressTransactions.
+func (mr *MockStorageMockRecorder) AddAddressTransactions(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddAddressTransactions", reflect.TypeOf((*MockStorage)(nil).AddAddressTransactions), varargs...)
+}
+
+// AddInternalTransfers mocks base method.
+func (m *MockStorage) AddInternalTransfers(arg0 ...InternalTransfer) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "AddInternalTransfers", varargs...)
+}
+
+// AddInternalTransfers indicates an expected call of AddInternalTransfers.
+func (mr *MockStorageMockRecorder) AddInternalTransfers(arg0 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddInternalTransfers", reflect.TypeOf((*MockStorage)(nil).AddInternalTransfers), arg0...)
+}
+
+// AddNftTransfers mocks base method.
+func (m *MockStorage) AddNftTransfers(arg0 ...NftTransfer) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "AddNftTransfers", varargs...)
+}
+
+// AddNftTransfers indicates an expected call of AddNftTransfers.
+func (mr *MockStorageMockRecorder) AddNftTransfers(arg0 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddNftTransfers", reflect.TypeOf((*MockStorage)(nil).AddNftTransfers), arg0...)
+}
+
+// AddSubscription mocks base method.
+func (m *MockStorage) AddSubscription(arg0 Subscription) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AddSubscription", arg0)
 	ret0, _ := ret[0].(bool)
 	return ret0
 }
 
-// AddObservedAddress indicates an expected call of AddObservedAddress.
-func (mr *MockStorageMockRecorder) AddObservedAddress(arg0 interface{}) *gomock.Call {
+// AddSubscription indicates an expected call of AddSubscription.
+func (mr *MockStorageMockRecorder) AddSubscription(arg0 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddObservedAddress", reflect.TypeOf((*MockStorage)(nil).AddObservedAddress), arg0)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddSubscription", reflect.TypeOf((*MockStorage)(nil).AddSubscription), arg0)
+}
+
+// AddTokenTransfers mocks base method.
+func (m *MockStorage) AddTokenTransfers(arg0 ...TokenTransfer) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{}
+	for _, a := range arg0 {
+		varargs = append(varargs, a)
+	}
+	m.ctrl.Call(m, "AddTokenTransfers", varargs...)
+}
+
+// AddTokenTransfers indicates an expected call of AddTokenTransfers.
+func (mr *MockStorageMockRecorder) AddTokenTransfers(arg0 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTokenTransfers", reflect.TypeOf((*MockStorage)(nil).AddTokenTransfers), arg0...)
 }
 
 // AddTransactions mocks base method.
-func (m *MockStorage) AddTransactions(arg0 ...Transaction) {
+func (m *MockStorage) AddTransactions(arg0 ...Transaction) []TransactionMatch {
 	m.ctrl.T.Helper()
 	varargs := []interface{}{}
 	for _, a := range arg0 {
 		varargs = append(varargs, a)
 	}
-	m.ctrl.Call(m, "AddTransactions", varargs...)
+	ret := m.ctrl.Call(m, "AddTransactions", varargs...)
+	ret0, _ := ret[0].([]TransactionMatch)
+	return ret0
 }
 
 // AddTransactions indicates an expected call of AddTransactions.
@@ -63,6 +181,20 @@ func (mr *MockStorageMockRecorder) AddTransactions(arg0 ...interface{}) *gomock.
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddTransactions", reflect.TypeOf((*MockStorage)(nil).AddTransactions), arg0...)
 }
 
+// GetBackfillJobs mocks base method.
+func (m *MockStorage) GetBackfillJobs() []BackfillJob {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBackfillJobs")
+	ret0, _ := ret[0].([]BackfillJob)
+	return ret0
+}
+
+// GetBackfillJobs indicates an expected call of GetBackfillJobs.
+func (mr *MockStorageMockRecorder) GetBackfillJobs() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBackfillJobs", reflect.TypeOf((*MockStorage)(nil).GetBackfillJobs))
+}
+
 // GetCurrentBlock mocks base method.
 func (m *MockStorage) GetCurrentBlock() int {
 	m.ctrl.T.Helper()
@@ -77,8 +209,122 @@ func (mr *MockStorageMockRecorder) GetCurrentBlock() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCurrentBlock", reflect.TypeOf((*MockStorage)(nil).GetCurrentBlock))
 }
 
+// GetDeliveries mocks base method.
+func (m *MockStorage) GetDeliveries(arg0 Address) []WebhookDelivery {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeliveries", arg0)
+	ret0, _ := ret[0].([]WebhookDelivery)
+	return ret0
+}
+
+// GetDeliveries indicates an expected call of GetDeliveries.
+func (mr *MockStorageMockRecorder) GetDeliveries(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeliveries", reflect.TypeOf((*MockStorage)(nil).GetDeliveries), arg0)
+}
+
+// GetDelivery mocks base method.
+func (m *MockStorage) GetDelivery(arg0 string) (WebhookDelivery, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDelivery", arg0)
+	ret0, _ := ret[0].(WebhookDelivery)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetDelivery indicates an expected call of GetDelivery.
+func (mr *MockStorageMockRecorder) GetDelivery(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDelivery", reflect.TypeOf((*MockStorage)(nil).GetDelivery), arg0)
+}
+
+// GetInternalTransfers mocks base method.
+func (m *MockStorage) GetInternalTransfers(arg0 Address) []InternalTransfer {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetInternalTransfers", arg0)
+	ret0, _ := ret[0].([]InternalTransfer)
+	return ret0
+}
+
+// GetInternalTransfers indicates an expected call of GetInternalTransfers.
+func (mr *MockStorageMockRecorder) GetInternalTransfers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetInternalTransfers", reflect.TypeOf((*MockStorage)(nil).GetInternalTransfers), arg0)
+}
+
+// GetNftTransfers mocks base method.
+func (m *MockStorage) GetNftTransfers(arg0 Address) []NftTransfer {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetNftTransfers", arg0)
+	ret0, _ := ret[0].([]NftTransfer)
+	return ret0
+}
+
+// GetNftTransfers indicates an expected call of GetNftTransfers.
+func (mr *MockStorageMockRecorder) GetNftTransfers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetNftTransfers", reflect.TypeOf((*MockStorage)(nil).GetNftTransfers), arg0)
+}
+
+// GetPendingDeliveries mocks base method.
+func (m *MockStorage) GetPendingDeliveries() []WebhookDelivery {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPendingDeliveries")
+	ret0, _ := ret[0].([]WebhookDelivery)
+	return ret0
+}
+
+// GetPendingDeliveries indicates an expected call of GetPendingDeliveries.
+func (mr *MockStorageMockRecorder) GetPendingDeliveries() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPendingDeliveries", reflect.TypeOf((*MockStorage)(nil).GetPendingDeliveries))
+}
+
+// GetSubscription mocks base method.
+func (m *MockStorage) GetSubscription(arg0 Address) (Subscription, bool) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSubscription", arg0)
+	ret0, _ := ret[0].(Subscription)
+	ret1, _ := ret[1].(bool)
+	return ret0, ret1
+}
+
+// GetSubscription indicates an expected call of GetSubscription.
+func (mr *MockStorageMockRecorder) GetSubscription(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscription", reflect.TypeOf((*MockStorage)(nil).GetSubscription), arg0)
+}
+
+// GetSubscriptions mocks base method.
+func (m *MockStorage) GetSubscriptions() []Subscription {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetSubscriptions")
+	ret0, _ := ret[0].([]Subscription)
+	return ret0
+}
+
+// GetSubscriptions indicates an expected call of GetSubscriptions.
+func (mr *MockStorageMockRecorder) GetSubscriptions() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSubscriptions", reflect.TypeOf((*MockStorage)(nil).GetSubscriptions))
+}
+
+// GetTokenTransfers mocks base method.
+func (m *MockStorage) GetTokenTransfers(arg0 Address) []TokenTransfer {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetTokenTransfers", arg0)
+	ret0, _ := ret[0].([]TokenTransfer)
+	return ret0
+}
+
+// GetTokenTransfers indicates an expected call of GetTokenTransfers.
+func (mr *MockStorageMockRecorder) GetTokenTransfers(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTokenTransfers", reflect.TypeOf((*MockStorage)(nil).GetTokenTransfers), arg0)
+}
+
 // GetTransactions mocks base method.
-func (m *MockStorage) GetTransactions(arg0 string) []Transaction {
+func (m *MockStorage) GetTransactions(arg0 Address) []Transaction {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetTransactions", arg0)
 	ret0, _ := ret[0].([]Transaction)
@@ -91,6 +337,70 @@ func (mr *MockStorageMockRecorder) GetTransactions(arg0 interface{}) *gomock.Cal
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetTransactions", reflect.TypeOf((*MockStorage)(nil).GetTransactions), arg0)
 }
 
+// QueryTransactions mocks base method.
+func (m *MockStorage) QueryTransactions(arg0 Address, arg1 TransactionQuery) TransactionPage {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "QueryTransactions", arg0, arg1)
+	ret0, _ := ret[0].(TransactionPage)
+	return ret0
+}
+
+// QueryTransactions indicates an expected call of QueryTransactions.
+func (mr *MockStorageMockRecorder) QueryTransactions(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryTransactions", reflect.TypeOf((*MockStorage)(nil).QueryTransactions), arg0, arg1)
+}
+
+// RemoveSubscription mocks base method.
+func (m *MockStorage) RemoveSubscription(arg0 Address, arg1 bool) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveSubscription", arg0, arg1)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// RemoveSubscription indicates an expected call of RemoveSubscription.
+func (mr *MockStorageMockRecorder) RemoveSubscription(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveSubscription", reflect.TypeOf((*MockStorage)(nil).RemoveSubscription), arg0, arg1)
+}
+
+// RollbackBlock mocks base method.
+func (m *MockStorage) RollbackBlock(arg0 int) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "RollbackBlock", arg0)
+}
+
+// RollbackBlock indicates an expected call of RollbackBlock.
+func (mr *MockStorageMockRecorder) RollbackBlock(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RollbackBlock", reflect.TypeOf((*MockStorage)(nil).RollbackBlock), arg0)
+}
+
+// SaveBackfillJob mocks base method.
+func (m *MockStorage) SaveBackfillJob(arg0 BackfillJob) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SaveBackfillJob", arg0)
+}
+
+// SaveBackfillJob indicates an expected call of SaveBackfillJob.
+func (mr *MockStorageMockRecorder) SaveBackfillJob(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveBackfillJob", reflect.TypeOf((*MockStorage)(nil).SaveBackfillJob), arg0)
+}
+
+// SaveDelivery mocks base method.
+func (m *MockStorage) SaveDelivery(arg0 WebhookDelivery) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "SaveDelivery", arg0)
+}
+
+// SaveDelivery indicates an expected call of SaveDelivery.
+func (mr *MockStorageMockRecorder) SaveDelivery(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveDelivery", reflect.TypeOf((*MockStorage)(nil).SaveDelivery), arg0)
+}
+
 // UpdateCurrentBlock mocks base method.
 func (m *MockStorage) UpdateCurrentBlock(arg0 int) {
 	m.ctrl.T.Helper()
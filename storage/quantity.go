@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// units amounts of wei can be given and formatted in
+const (
+	UnitWei   = "wei"
+	UnitGwei  = "gwei"
+	UnitEther = "eth"
+
+	gweiDecimals  = 9
+	etherDecimals = 18
+)
+
+// UnitDecimals returns the number of decimals of an amount of wei in the
+// given unit.
+func UnitDecimals(unit string) (int, bool) {
+	switch unit {
+	case UnitWei:
+		return 0, true
+	case UnitGwei:
+		return gweiDecimals, true
+	case UnitEther:
+		return etherDecimals, true
+	}
+	return 0, false
+}
+
+// Quantity is an unsigned integer of arbitrary precision, such as an amount of
+// wei, a token amount or a token ID. It is serialized as a decimal string
+// since JSON numbers lose precision past 2^53. The zero Quantity is a missing
+// value and is serialized as null.
+type Quantity struct {
+	value *big.Int
+}
+
+// NewQuantity copies value, a nil value gives a missing Quantity.
+func NewQuantity(value *big.Int) Quantity {
+	if value == nil {
+		return Quantity{}
+	}
+	// copied into a fresh big.Int so equal quantities have the same representation
+	return Quantity{value: new(big.Int).Set(value)}
+}
+
+// NewQuantityFromUint64 is a shorthand for small quantities.
+func NewQuantityFromUint64(value uint64) Quantity {
+	return Quantity{value: new(big.Int).SetUint64(value)}
+}
+
+// ParseQuantity parses a decimal string, or a 0x prefixed hex string as sent
+// by the node. An empty string gives a missing Quantity.
+func ParseQuantity(s string) (Quantity, error) {
+	if s == "" {
+		return Quantity{}, nil
+	}
+	digits, base := s, 10
+	if strings.HasPrefix(s, "0x") {
+		digits, base = s[2:], 16
+	}
+	value, ok := new(big.Int).SetString(digits, base)
+	if !ok || digits == "" || strings.HasPrefix(digits, "-") || strings.HasPrefix(digits, "+") {
+		return Quantity{}, fmt.Errorf("invalid quantity %q", s)
+	}
+	return NewQuantity(value), nil
+}
+
+// ParseAmount parses an amount given with up to decimals digits after the
+// decimal point, such as "1.5" ETH, into the smallest unit.
+func ParseAmount(s string, decimals int) (Quantity, error) {
+	whole, fraction, _ := strings.Cut(s, ".")
+	if len(fraction) > decimals || strings.Trim(whole+fraction, "0123456789") != "" || whole+fraction == "" {
+		return Quantity{}, fmt.Errorf("invalid amount %q", s)
+	}
+	return ParseQuantity(whole + fraction + strings.Repeat("0", decimals-len(fraction)))
+}
+
+func (q Quantity) IsSet() bool {
+	return q.value != nil
+}
+
+// Int returns a copy of the value, nil when it is missing.
+func (q Quantity) Int() *big.Int {
+	if q.value == nil {
+		return nil
+	}
+	return new(big.Int).Set(q.value)
+}
+
+// Cmp compares the quantities like big.Int.Cmp, a missing value counts as zero.
+func (q Quantity) Cmp(other Quantity) int {
+	return q.orZero().Cmp(other.orZero())
+}
+
+func (q Quantity) orZero() *big.Int {
+	if q.value == nil {
+		return new(big.Int)
+	}
+	return q.value
+}
+
+// String returns the value in decimal, an empty string when it is missing.
+func (q Quantity) String() string {
+	if q.value == nil {
+		return ""
+	}
+	return q.value.String()
+}
+
+// Format returns the value divided by 10^decimals, without trailing zeros
+// and without losing precision, e.g. 1500000000000000000 with 18 decimals
+// is "1.5".
+func (q Quantity) Format(decimals int) string {
+	if q.value == nil {
+		return ""
+	}
+	digits := q.value.String()
+	if decimals == 0 {
+		return digits
+	}
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals-len(digits)+1) + digits
+	}
+	whole, fraction := digits[:len(digits)-decimals], strings.TrimRight(digits[len(digits)-decimals:], "0")
+	if fraction == "" {
+		return whole
+	}
+	return whole + "." + fraction
+}
+
+func (q Quantity) MarshalJSON() ([]byte, error) {
+	if q.value == nil {
+		return []byte("null"), nil
+	}
+	return json.Marshal(q.value.String())
+}
+
+// UnmarshalJSON also accepts hex strings, which the file storage logs held
+// before quantities were stored in decimal.
+func (q *Quantity) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*q = Quantity{}
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := ParseQuantity(s)
+	if err != nil {
+		return err
+	}
+	*q = parsed
+	return nil
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		wantErr  bool
+	}{
+		{"0x0", "0", false},
+		{"0xde0b6b3a7640000", "1000000000000000000", false},
+		{"1000000000000000000", "1000000000000000000", false},
+		// larger than 64 bits
+		{"0x10000000000000000", "18446744073709551616", false},
+		{"", "", false},
+		{"0x", "", true},
+		{"-1", "", true},
+		{"1.5", "", true},
+		{"0xzz", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			quantity, err := ParseQuantity(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if quantity.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, quantity.String())
+			}
+		})
+	}
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		input    string
+		decimals int
+		expected string
+		wantErr  bool
+	}{
+		{"1.5", etherDecimals, "1500000000000000000", false},
+		{"0.000000000000000001", etherDecimals, "1", false},
+		{"30", gweiDecimals, "30000000000", false},
+		{".5", gweiDecimals, "500000000", false},
+		{"42", 0, "42", false},
+		{"1.5", 0, "", true},
+		{"0.0000000000000000001", etherDecimals, "", true},
+		{"1e18", etherDecimals, "", true},
+		{"", etherDecimals, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			quantity, err := ParseAmount(tt.input, tt.decimals)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error %v, got %v", tt.wantErr, err)
+			}
+			if quantity.String() != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, quantity.String())
+			}
+		})
+	}
+}
+
+func TestQuantity_Format(t *testing.T) {
+	tests := []struct {
+		input    string
+		decimals int
+		expected string
+	}{
+		{"1500000000000000000", etherDecimals, "1.5"},
+		{"1", etherDecimals, "0.000000000000000001"},
+		{"2000000000000000000", etherDecimals, "2"},
+		{"0", etherDecimals, "0"},
+		{"30000000000", gweiDecimals, "30"},
+		{"123", 0, "123"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			quantity, _ := ParseQuantity(tt.input)
+			if formatted := quantity.Format(tt.decimals); formatted != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, formatted)
+			}
+		})
+	}
+}
+
+func TestQuantity_JSON(t *testing.T) {
+	tx := Transaction{Value: NewQuantityFromUint64(1000), Fee: Quantity{}}
+	data, err := json.Marshal(tx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if decoded["Value"] != "1000" || decoded["Fee"] != nil {
+		t.Errorf("Expected a decimal Value and a null Fee, got %v and %v", decoded["Value"], decoded["Fee"])
+	}
+
+	// logs written before quantities were stored in decimal hold hex strings
+	var restored Transaction
+	if err := json.Unmarshal([]byte(`{"Value": "0x3e8", "Fee": null}`), &restored); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if restored.Value.Cmp(tx.Value) != 0 || restored.Fee.IsSet() {
+		t.Errorf("Expected %+v, got %+v", tx, restored)
+	}
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// transactions sent to the address
+	DirectionIn = "in"
+	// transactions sent from the address
+	DirectionOut = "out"
+)
+
+// TransactionQuery selects a page of the transactions of an address. The zero
+// value selects every transaction, in ascending order.
+type TransactionQuery struct {
+	FromBlock int
+	// 0 for no upper bound
+	ToBlock int
+	// one of the Direction* constants, empty for both
+	Direction string
+	// one of the TxType* constants, empty for every type
+	TxType   string
+	MinValue Quantity
+	// newest transactions first
+	Descending bool
+	// the page starts after the transaction the cursor points to, nil for the first page
+	After *TransactionCursor
+	// most transactions returned, 0 for no limit
+	Limit int
+}
+
+// TransactionPage is a page of the transactions matching a query.
+type TransactionPage struct {
+	Transactions []Transaction
+	// transactions matching the query across all pages
+	Total int
+	// cursor of the next page, nil on the last page
+	Next *TransactionCursor
+}
+
+// TransactionCursor is the position of a transaction in the transactions of
+// an address, ordered by block, index in the block and hash.
+type TransactionCursor struct {
+	BlockNum int
+	TxIndex  int
+	Hash     string
+}
+
+func cursorOf(tx Transaction) TransactionCursor {
+	return TransactionCursor{BlockNum: tx.BlockNum, TxIndex: tx.TxIndex, Hash: tx.Hash}
+}
+
+// compare returns -1, 0 or 1 as the cursor is before, at or after other.
+func (c TransactionCursor) compare(other TransactionCursor) int {
+	switch {
+	case c.BlockNum != other.BlockNum:
+		return compareInts(c.BlockNum, other.BlockNum)
+	case c.TxIndex != other.TxIndex:
+		return compareInts(c.TxIndex, other.TxIndex)
+	default:
+		return strings.Compare(c.Hash, other.Hash)
+	}
+}
+
+func compareInts(a, b int) int {
+	if a < b {
+		return -1
+	}
+	if a > b {
+		return 1
+	}
+	return 0
+}
+
+// String encodes the cursor as an opaque token for clients.
+func (c TransactionCursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d:%s", c.BlockNum, c.TxIndex, c.Hash)))
+}
+
+// ParseTransactionCursor decodes a cursor returned by String.
+func ParseTransactionCursor(token string) (TransactionCursor, error) {
+	decoded, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return TransactionCursor{}, fmt.Errorf("invalid cursor: %v", err)
+	}
+	parts := strings.SplitN(string(decoded), ":", 3)
+	if len(parts) != 3 {
+		return TransactionCursor{}, fmt.Errorf("invalid cursor %q", token)
+	}
+	blockNum, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return TransactionCursor{}, fmt.Errorf("invalid cursor block: %v", err)
+	}
+	txIndex, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return TransactionCursor{}, fmt.Errorf("invalid cursor index: %v", err)
+	}
+	return TransactionCursor{BlockNum: blockNum, TxIndex: txIndex, Hash: parts[2]}, nil
+}
+
+// matches tells whether a transaction of the address passes the filters of
+// the query, the block range and the cursor are left to the caller.
+func (q TransactionQuery) matches(address Address, tx Transaction) bool {
+	switch {
+	case q.Direction == DirectionIn && tx.To != address:
+		return false
+	case q.Direction == DirectionOut && tx.From != address:
+		return false
+	case q.TxType != "" && tx.TxType != q.TxType:
+		return false
+	case q.MinValue.IsSet() && tx.Value.Cmp(q.MinValue) < 0:
+		return false
+	}
+	return true
+}
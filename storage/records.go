@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+)
+
+// record is a transaction or a transfer stored for the addresses it touches.
+type record interface {
+	// tells the record apart from the other records of the same address
+	key() string
+	blockNumber() int
+	parties() (from, to Address)
+}
+
+func (tx Transaction) key() string                 { return tx.Hash }
+func (tx Transaction) blockNumber() int            { return tx.BlockNum }
+func (tx Transaction) parties() (Address, Address) { return tx.From, tx.To }
+
+// a transaction can emit several transfers, which are told apart by their log index
+func (t TokenTransfer) key() string {
+	return fmt.Sprintf("%s:%d", t.TxHash, t.LogIndex)
+}
+func (t TokenTransfer) blockNumber() int            { return t.BlockNum }
+func (t TokenTransfer) parties() (Address, Address) { return t.From, t.To }
+
+func (t NftTransfer) key() string {
+	return fmt.Sprintf("%s:%d:%d", t.TxHash, t.LogIndex, t.BatchIndex)
+}
+func (t NftTransfer) blockNumber() int            { return t.BlockNum }
+func (t NftTransfer) parties() (Address, Address) { return t.From, t.To }
+
+func (t InternalTransfer) key() string {
+	return fmt.Sprintf("%s:%v", t.TxHash, t.TraceAddress)
+}
+func (t InternalTransfer) blockNumber() int            { return t.BlockNum }
+func (t InternalTransfer) parties() (Address, Address) { return t.From, t.To }
+
+// records holds the records of a single type per address. Its methods must be
+// called with the lock of the storage held.
+type records[T record] struct {
+	byAddress map[Address][]T
+	keys      map[Address]map[string]struct{} // per address, so a block can be ingested twice
+	// keeps the records of an address ordered when set, otherwise they are in the order they were stored
+	compare func(a, b T) int
+}
+
+func newRecords[T record](compare func(a, b T) int) *records[T] {
+	return &records[T]{
+		byAddress: make(map[Address][]T),
+		keys:      make(map[Address]map[string]struct{}),
+		compare:   compare,
+	}
+}
+
+// storedRecord is a record stored by add, with the addresses it was stored for.
+type storedRecord[T record] struct {
+	record    T
+	addresses []Address
+}
+
+// recordsOf returns the records stored by add.
+func recordsOf[T record](stored []storedRecord[T]) []T {
+	items := make([]T, len(stored))
+	for i, match := range stored {
+		items[i] = match.record
+	}
+	return items
+}
+
+func transactionMatches(stored []storedRecord[Transaction]) []TransactionMatch {
+	matches := make([]TransactionMatch, len(stored))
+	for i, match := range stored {
+		matches[i] = TransactionMatch{Transaction: match.record, Addresses: match.addresses}
+	}
+	return matches
+}
+
+// addRecords stores the records touching an observed address with the lock
+// of the storage held, and returns the ones that were not stored yet.
+func addRecords[T record](s *MemoryStorage, r *records[T], items []T) []storedRecord[T] {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return r.add(s.observedAddresses, items)
+}
+
+// addAddressRecords is addRecords for the records of a single address.
+func addAddressRecords[T record](s *MemoryStorage, r *records[T], address Address, items []T) []T {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return r.addAddress(address, items)
+}
+
+func (r *records[T]) get(address Address) []T {
+	return r.byAddress[address]
+}
+
+// add stores the records touching an observed address and returns the ones
+// that were not stored yet.
+func (r *records[T]) add(observed map[Address]Subscription, items []T) []storedRecord[T] {
+	var stored []storedRecord[T]
+	for _, item := range items {
+		var addresses []Address
+		from, to := item.parties()
+		for _, address := range []Address{from, to} {
+			if _, exists := observed[address]; !exists || address == "" {
+				continue
+			}
+			// a self transfer is stored once
+			if len(addresses) > 0 && addresses[0] == address {
+				continue
+			}
+			if r.store(address, item) {
+				addresses = append(addresses, address)
+			}
+		}
+		if len(addresses) > 0 {
+			stored = append(stored, storedRecord[T]{record: item, addresses: addresses})
+		}
+	}
+	return stored
+}
+
+// addAddress stores the records touching the address and returns the ones
+// that were not stored yet.
+func (r *records[T]) addAddress(address Address, items []T) []T {
+	var stored []T
+	for _, item := range items {
+		if from, to := item.parties(); from != address && to != address {
+			continue
+		}
+		if r.store(address, item) {
+			stored = append(stored, item)
+		}
+	}
+	return stored
+}
+
+// store adds the record to the ones of the address, it returns false when it
+// was already stored.
+func (r *records[T]) store(address Address, item T) bool {
+	keys, exists := r.keys[address]
+	if !exists {
+		keys = make(map[string]struct{})
+		r.keys[address] = keys
+	}
+	if _, stored := keys[item.key()]; stored {
+		return false
+	}
+	keys[item.key()] = struct{}{}
+
+	items := r.byAddress[address]
+	i := len(items)
+	if r.compare != nil {
+		i = sort.Search(len(items), func(i int) bool { return r.compare(items[i], item) > 0 })
+	}
+	if i == len(items) {
+		r.byAddress[address] = append(items, item)
+		return true
+	}
+	// a new array, the returned slices are read without the lock
+	inserted := make([]T, 0, len(items)+1)
+	inserted = append(inserted, items[:i]...)
+	inserted = append(inserted, item)
+	r.byAddress[address] = append(inserted, items[i:]...)
+	return true
+}
+
+// set replaces every record of the address, used to restore snapshots.
+func (r *records[T]) set(address Address, items []T) {
+	r.drop(address)
+	for _, item := range items {
+		r.store(address, item)
+	}
+}
+
+func (r *records[T]) drop(address Address) {
+	delete(r.byAddress, address)
+	delete(r.keys, address)
+}
+
+// rollback drops the records of a block orphaned by a reorg.
+func (r *records[T]) rollback(blockNum int) {
+	for address, items := range r.byAddress {
+		var kept []T
+		for _, item := range items {
+			if item.blockNumber() != blockNum {
+				kept = append(kept, item)
+			} else {
+				delete(r.keys[address], item.key())
+			}
+		}
+		r.byAddress[address] = kept
+	}
+}
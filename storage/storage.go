@@ -1,20 +1,237 @@
 package storage
 
+import "time"
+
+const (
+	StatusPendingConfirmation = "pending-confirmation"
+	StatusConfirmed           = "confirmed"
+	StatusFinalized           = "finalized"
+
+	TxStatusSuccess  = "success"
+	TxStatusReverted = "reverted"
+
+	// envelope types of a transaction, named after the EIP introducing them
+	TxTypeLegacy     = "legacy"
+	TxTypeAccessList = "eip-2930"
+	TxTypeDynamicFee = "eip-1559"
+	TxTypeBlob       = "eip-4844"
+	TxTypeSetCode    = "eip-7702"
+
+	StandardErc721  = "ERC-721"
+	StandardErc1155 = "ERC-1155"
+
+	// calls moving ETH between addresses in a trace
+	CallTypeCall         = "call"
+	CallTypeCreate       = "create"
+	CallTypeSelfdestruct = "selfdestruct"
+
+	DeliveryStatusPending   = "pending"
+	DeliveryStatusDelivered = "delivered"
+	// the delivery ran out of attempts, it is only retried when redelivered
+	DeliveryStatusFailed = "failed"
+)
+
+// Subscription is an address observed by the parser.
+type Subscription struct {
+	Address Address
+	// free text given by the subscriber, empty when none
+	Label     string
+	CreatedAt time.Time
+	// first block scanned for the address, the first block of its backfill when one was requested
+	StartBlock int
+	// the matched transactions are posted to it, empty when none
+	WebhookURL string
+}
+
 type Transaction struct {
 	Hash      string
-	From      string
-	To        string
-	Value     string
+	From      Address
+	To        Address
+	Value     Quantity
 	BlockHash string
 	BlockNum  int
-	Type      string
+	// position of the transaction in its block
+	TxIndex int
+	Type    string
+	// one of the TxType* constants, or the raw type for types it does not know
+	TxType  string
+	ChainID Quantity
+	Nonce   Quantity
+	Input   string
+	// gas limit of the transaction
+	Gas      Quantity
+	GasPrice Quantity
+	// only set from EIP-1559 on
+	MaxFeePerGas         Quantity
+	MaxPriorityFeePerGas Quantity
+	AccessList           []AccessTuple
+	// only set for blob transactions
+	MaxFeePerBlobGas    Quantity
+	BlobVersionedHashes []string
+	// only set for set code transactions
+	AuthorizationList []Authorization
+	// one of the TxStatus* constants, empty for receipts from before Byzantium
+	Status string
+	// taken from the receipt, Fee is GasUsed times EffectiveGasPrice plus the blob fee
+	GasUsed           Quantity
+	EffectiveGasPrice Quantity
+	Fee               Quantity
+	// address of the created contract, only set for contract deployments
+	ContractAddress Address
+	// one of the Status* constants, derived from the chain head when the transaction is read
+	ConfirmationStatus string
+}
+
+// TransactionMatch is a transaction stored for the subscribed addresses it
+// touches, one or both of its From and To.
+type TransactionMatch struct {
+	Transaction Transaction
+	Addresses   []Address
+}
+
+// AccessTuple is an entry of the access list of a transaction, the storage
+// keys of an address the transaction declares to access.
+type AccessTuple struct {
+	Address     Address
+	StorageKeys []string
+}
+
+// Authorization lets the authority signing it delegate its code to Address,
+// the signature is left out.
+type Authorization struct {
+	ChainID Quantity
+	Address Address
+	Nonce   Quantity
+}
+
+// TokenTransfer is an ERC-20 Transfer event. Value is the raw amount in the
+// smallest unit of the token.
+type TokenTransfer struct {
+	TxHash    string
+	LogIndex  int
+	Token     Address
+	From      Address
+	To        Address
+	Value     Quantity
+	BlockHash string
+	BlockNum  int
+	// one of the Status* constants, derived from the chain head when the transfer is read
+	ConfirmationStatus string
+}
+
+// NftTransfer is the move of a single ERC-721 or ERC-1155 token. A
+// TransferBatch event moves several tokens and is stored as one NftTransfer
+// per token, told apart by their BatchIndex. The amount of an ERC-721 token
+// is always 1.
+type NftTransfer struct {
+	TxHash     string
+	LogIndex   int
+	BatchIndex int
+	Contract   Address
+	// one of the Standard* constants
+	Standard  string
+	From      Address
+	To        Address
+	TokenID   Quantity
+	Amount    Quantity
+	BlockHash string
+	BlockNum  int
+	// one of the Status* constants, derived from the chain head when the transfer is read
+	ConfirmationStatus string
+}
+
+// InternalTransfer is ETH moved by a call made by a contract during a
+// transaction, found by tracing it. TraceAddress is the position of the call
+// in the call tree of TxHash, the indexes of the calls leading to it from the
+// top-level call, and Value is in wei.
+type InternalTransfer struct {
+	TxHash       string
+	TraceAddress []int
+	// one of the CallType* constants
+	CallType  string
+	From      Address
+	To        Address
+	Value     Quantity
+	BlockHash string
+	BlockNum  int
+	// one of the Status* constants, derived from the chain head when the transfer is read
+	ConfirmationStatus string
+}
+
+// BackfillJob tracks the scan of historical blocks for a single address.
+// Blocks from FromBlock up to ToBlock are scanned and NextBlock is the first
+// block that still has to be processed, which allows resuming the job.
+type BackfillJob struct {
+	Address   Address
+	FromBlock int
+	ToBlock   int
+	NextBlock int
+	Done      bool
+}
+
+// WebhookDelivery is the post of a transaction matched by a subscription to
+// its webhook. Deliveries are kept in an outbox while pending and then as the
+// delivery history of the address.
+type WebhookDelivery struct {
+	ID          string
+	Address     Address
+	URL         string
+	Transaction Transaction
+	// one of the DeliveryStatus* constants
+	Status   string
+	Attempts int
+	// when the next attempt is due, only meaningful while pending
+	NextAttempt time.Time
+	// outcome of the last attempt, the status code is 0 when no response was received
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    time.Time
 }
 
 //go:generate mockgen -destination=mock_storage.go -package=storage github.com/oanatmaria/ethblkcn-observer/storage Storage
 type Storage interface {
-	AddObservedAddress(address string) bool
-	GetTransactions(address string) []Transaction
-	AddTransactions(txs ...Transaction)
+	// returns false when the address is already subscribed
+	AddSubscription(subscription Subscription) bool
+	// stops observing the address and drops its backfill job and pending
+	// deliveries, the records and delivery history stored for it are dropped
+	// as well when purge is set, otherwise they can still be read. Returns false when the address is not subscribed.
+	RemoveSubscription(address Address, purge bool) bool
+	// subscriptions in the order they were created
+	GetSubscriptions() []Subscription
+	GetSubscription(address Address) (Subscription, bool)
+	// ordered by block, index in the block and hash
+	GetTransactions(address Address) []Transaction
+	// the page of the transactions of the address matching the query
+	QueryTransactions(address Address, query TransactionQuery) TransactionPage
+	// stores the transactions touching a subscribed address and returns the
+	// ones that were not stored yet, with the addresses they were stored for
+	AddTransactions(txs ...Transaction) []TransactionMatch
+	// stores the transactions touching the given address, skipping the ones already stored
+	AddAddressTransactions(address Address, txs ...Transaction)
+	GetTokenTransfers(address Address) []TokenTransfer
+	AddTokenTransfers(transfers ...TokenTransfer)
+	// stores the token transfers touching the given address, skipping the ones already stored
+	AddAddressTokenTransfers(address Address, transfers ...TokenTransfer)
+	GetNftTransfers(address Address) []NftTransfer
+	AddNftTransfers(transfers ...NftTransfer)
+	// stores the NFT transfers touching the given address, skipping the ones already stored
+	AddAddressNftTransfers(address Address, transfers ...NftTransfer)
+	GetInternalTransfers(address Address) []InternalTransfer
+	AddInternalTransfers(transfers ...InternalTransfer)
+	// stores the internal transfers touching the given address, skipping the ones already stored
+	AddAddressInternalTransfers(address Address, transfers ...InternalTransfer)
+	// drops every record stored for a block orphaned by a reorg
+	RollbackBlock(blockNum int)
 	GetCurrentBlock() int
 	UpdateCurrentBlock(block int)
+	SaveBackfillJob(job BackfillJob)
+	GetBackfillJobs() []BackfillJob
+	// inserts the delivery or replaces the one with the same ID
+	SaveDelivery(delivery WebhookDelivery)
+	GetDelivery(id string) (WebhookDelivery, bool)
+	// deliveries of the transactions of an address, in the order they were created
+	GetDeliveries(address Address) []WebhookDelivery
+	// deliveries still to be attempted, the ones due first
+	GetPendingDeliveries() []WebhookDelivery
 }
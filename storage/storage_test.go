@@ -0,0 +1,499 @@
+package storage
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// forEachStorage runs the same test against every Storage implementation.
+func forEachStorage(t *testing.T, test func(t *testing.T, storage Storage)) {
+	t.Run("MemoryStorage", func(t *testing.T) {
+		test(t, NewMemoryStorage())
+	})
+
+	t.Run("FileStorage", func(t *testing.T) {
+		storage, err := NewFileStorage(filepath.Join(t.TempDir(), "storage.log"))
+		if err != nil {
+			t.Fatalf("Failed to open file storage: %v", err)
+		}
+		t.Cleanup(func() {
+			if err := storage.Close(); err != nil {
+				t.Errorf("Failed to close file storage: %v", err)
+			}
+		})
+		test(t, storage)
+	})
+}
+
+func TestNewMemoryStorage(t *testing.T) {
+	storage := NewMemoryStorage()
+
+	if storage == nil {
+		t.Errorf("Expected MemoryStorage instance to not be nil")
+	}
+
+	if storage.GetCurrentBlock() != 0 {
+		t.Errorf("Expected initial block to be 0, got %d", storage.GetCurrentBlock())
+	}
+}
+
+func TestAddSubscription(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		if !storage.AddSubscription(Subscription{Address: "address1"}) {
+			t.Errorf("Expected adding new address to return true")
+		}
+
+		if storage.AddSubscription(Subscription{Address: "address1"}) {
+			t.Errorf("Expected adding duplicate address to return false")
+		}
+
+		if subscription, exists := storage.GetSubscription("address1"); !exists || subscription.Address != "address1" {
+			t.Errorf("Expected the subscription of address1, got %+v", subscription)
+		}
+		if _, exists := storage.GetSubscription("address2"); exists {
+			t.Errorf("Expected no subscription for address2")
+		}
+	})
+}
+
+func TestRemoveSubscription(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		created := time.Date(2024, 11, 14, 10, 0, 0, 0, time.UTC)
+		subscription1 := Subscription{Address: "address1", Label: "treasury", CreatedAt: created, StartBlock: 5}
+		subscription2 := Subscription{Address: "address2", CreatedAt: created.Add(time.Minute), StartBlock: 7}
+		storage.AddSubscription(subscription2)
+		storage.AddSubscription(subscription1)
+		if subscriptions := storage.GetSubscriptions(); !reflect.DeepEqual(subscriptions, []Subscription{subscription1, subscription2}) {
+			t.Errorf("Expected the subscriptions in creation order, got %+v", subscriptions)
+		}
+
+		tx := Transaction{Hash: "tx1", From: "address1", To: "address2", BlockNum: 5}
+		storage.AddTransactions(tx)
+		storage.SaveBackfillJob(BackfillJob{Address: "address1", FromBlock: 0, ToBlock: 5})
+
+		if !storage.RemoveSubscription("address1", false) {
+			t.Errorf("Expected removing a subscribed address to return true")
+		}
+		if storage.RemoveSubscription("address1", false) {
+			t.Errorf("Expected removing an address that is not subscribed to return false")
+		}
+		if txs := storage.GetTransactions("address1"); len(txs) != 1 {
+			t.Errorf("Expected the transactions of address1 to be retained, got %+v", txs)
+		}
+		if jobs := storage.GetBackfillJobs(); len(jobs) != 0 {
+			t.Errorf("Expected the backfill of address1 to be dropped, got %+v", jobs)
+		}
+
+		storage.AddTransactions(Transaction{Hash: "tx2", From: "address1", To: "address3", BlockNum: 6})
+		if txs := storage.GetTransactions("address1"); len(txs) != 1 {
+			t.Errorf("Expected no new transactions for address1, got %+v", txs)
+		}
+
+		storage.RemoveSubscription("address2", true)
+		if txs := storage.GetTransactions("address2"); len(txs) != 0 {
+			t.Errorf("Expected the transactions of address2 to be purged, got %+v", txs)
+		}
+		if subscriptions := storage.GetSubscriptions(); len(subscriptions) != 0 {
+			t.Errorf("Expected no subscriptions left, got %+v", subscriptions)
+		}
+	})
+}
+
+func TestGetTransactions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		txs := storage.GetTransactions("address1")
+		if len(txs) != 0 {
+			t.Errorf("Expected no transactions for unobserved address, got %d", len(txs))
+		}
+
+		storage.AddSubscription(Subscription{Address: "address1"})
+		tx1 := Transaction{
+			Hash:      "tx1",
+			From:      "address1",
+			To:        "address2",
+			Value:     NewQuantityFromUint64(100),
+			BlockHash: "blockhash1",
+			BlockNum:  1,
+			Type:      "transfer",
+		}
+		tx2 := Transaction{
+			Hash:      "tx2",
+			From:      "address1",
+			To:        "address3",
+			Value:     NewQuantityFromUint64(200),
+			BlockHash: "blockhash2",
+			BlockNum:  2,
+			Type:      "transfer",
+		}
+		storage.AddTransactions(tx1, tx2)
+
+		txs = storage.GetTransactions("address1")
+		if len(txs) != 2 {
+			t.Errorf("Expected 2 transactions for address1, got %d", len(txs))
+		}
+		if !reflect.DeepEqual(txs[0], tx1) || !reflect.DeepEqual(txs[1], tx2) {
+			t.Errorf("Expected transactions to match tx1 and tx2, got %+v", txs)
+		}
+	})
+}
+
+func TestAddTransactions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		storage.AddSubscription(Subscription{Address: "address1"})
+		storage.AddSubscription(Subscription{Address: "address2"})
+
+		tx1 := Transaction{
+			Hash:      "tx1",
+			From:      "address1",
+			To:        "address2",
+			Value:     NewQuantityFromUint64(100),
+			BlockHash: "blockhash1",
+			BlockNum:  1,
+			Type:      "transfer",
+		}
+		tx2 := Transaction{
+			Hash:      "tx2",
+			From:      "address3",
+			To:        "address2",
+			Value:     NewQuantityFromUint64(150),
+			BlockHash: "blockhash2",
+			BlockNum:  2,
+			Type:      "transfer",
+		}
+		tx3 := Transaction{
+			Hash:      "tx3",
+			From:      "address1",
+			To:        "address4",
+			Value:     NewQuantityFromUint64(200),
+			BlockHash: "blockhash3",
+			BlockNum:  3,
+			Type:      "transfer",
+		}
+
+		matches := storage.AddTransactions(tx1, tx2, tx3)
+		expected := []TransactionMatch{
+			{Transaction: tx1, Addresses: []Address{"address1", "address2"}},
+			{Transaction: tx2, Addresses: []Address{"address2"}},
+			{Transaction: tx3, Addresses: []Address{"address1"}},
+		}
+		if !reflect.DeepEqual(matches, expected) {
+			t.Errorf("Expected the stored transactions with their addresses, got %+v", matches)
+		}
+		if matches := storage.AddTransactions(tx1); len(matches) != 0 {
+			t.Errorf("Expected no match for a transaction already stored, got %+v", matches)
+		}
+
+		txsFromAddress1 := storage.GetTransactions("address1")
+		if len(txsFromAddress1) != 2 || txsFromAddress1[0].From != "address1" {
+			t.Errorf("Expected transaction.From to be address1, got %s", txsFromAddress1[0].From)
+		}
+
+		txsFromAddress2 := storage.GetTransactions("address2")
+		if len(txsFromAddress2) != 2 || txsFromAddress2[0].To != "address2" {
+			t.Errorf("Expected transaction.From to be address2, got %s", txsFromAddress2[0].To)
+		}
+
+		txsFromAddress3 := storage.GetTransactions("address3")
+		if len(txsFromAddress3) != 0 {
+			t.Errorf("Expected no transactions for unobserved address, got %d", len(txsFromAddress3))
+		}
+	})
+}
+
+func TestAddTransactions_SkipsDuplicates(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		storage.AddSubscription(Subscription{Address: "address1"})
+
+		tx1 := Transaction{Hash: "tx1", From: "address1", To: "address1", BlockNum: 1}
+		storage.AddTransactions(tx1)
+		storage.AddTransactions(tx1)
+
+		if txs := storage.GetTransactions("address1"); len(txs) != 1 {
+			t.Errorf("Expected tx1 to be stored once, got %+v", txs)
+		}
+
+		storage.RollbackBlock(1)
+		storage.AddTransactions(tx1)
+		if txs := storage.GetTransactions("address1"); len(txs) != 1 {
+			t.Errorf("Expected tx1 to be stored again after rollback, got %+v", txs)
+		}
+	})
+}
+
+func TestAddAddressTransactions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		tx1 := Transaction{Hash: "tx1", From: "address1", To: "address2", BlockNum: 1}
+		tx2 := Transaction{Hash: "tx2", From: "address3", To: "address4", BlockNum: 1}
+
+		storage.AddAddressTransactions("address1", tx1, tx2)
+		storage.AddAddressTransactions("address1", tx1)
+
+		txs := storage.GetTransactions("address1")
+		if len(txs) != 1 || txs[0].Hash != "tx1" {
+			t.Errorf("Expected only tx1 to be stored once for address1, got %+v", txs)
+		}
+
+		if txs := storage.GetTransactions("address2"); len(txs) != 0 {
+			t.Errorf("Expected no transactions for address2, got %d", len(txs))
+		}
+	})
+}
+
+func TestQueryTransactions(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		storage.AddSubscription(Subscription{Address: "address1"})
+		// stored out of order, as a backfill does
+		storage.AddTransactions(
+			Transaction{Hash: "tx4", From: "address2", To: "address1", Value: NewQuantityFromUint64(50), BlockNum: 3, TxIndex: 0, TxType: TxTypeLegacy},
+			Transaction{Hash: "tx2", From: "address1", To: "address2", Value: NewQuantityFromUint64(200), BlockNum: 1, TxIndex: 1, TxType: TxTypeDynamicFee},
+			Transaction{Hash: "tx1", From: "address2", To: "address1", Value: NewQuantityFromUint64(100), BlockNum: 1, TxIndex: 0, TxType: TxTypeDynamicFee},
+			Transaction{Hash: "tx3", From: "address1", To: "address3", Value: NewQuantityFromUint64(300), BlockNum: 2, TxIndex: 4, TxType: TxTypeDynamicFee},
+		)
+
+		hashes := func(page TransactionPage) []string {
+			var hashes []string
+			for _, tx := range page.Transactions {
+				hashes = append(hashes, tx.Hash)
+			}
+			return hashes
+		}
+
+		tests := []struct {
+			name     string
+			query    TransactionQuery
+			expected []string
+			total    int
+		}{
+			{"everything", TransactionQuery{}, []string{"tx1", "tx2", "tx3", "tx4"}, 4},
+			{"descending", TransactionQuery{Descending: true}, []string{"tx4", "tx3", "tx2", "tx1"}, 4},
+			{"block range", TransactionQuery{FromBlock: 2, ToBlock: 2}, []string{"tx3"}, 1},
+			{"incoming", TransactionQuery{Direction: DirectionIn}, []string{"tx1", "tx4"}, 2},
+			{"outgoing", TransactionQuery{Direction: DirectionOut}, []string{"tx2", "tx3"}, 2},
+			{"type", TransactionQuery{TxType: TxTypeLegacy}, []string{"tx4"}, 1},
+			{"min value", TransactionQuery{MinValue: NewQuantityFromUint64(200)}, []string{"tx2", "tx3"}, 2},
+			{"limit", TransactionQuery{Limit: 3}, []string{"tx1", "tx2", "tx3"}, 4},
+		}
+		for _, tt := range tests {
+			page := storage.QueryTransactions("address1", tt.query)
+			if !reflect.DeepEqual(hashes(page), tt.expected) || page.Total != tt.total {
+				t.Errorf("%s: expected %v of %d, got %v of %d", tt.name, tt.expected, tt.total, hashes(page), page.Total)
+			}
+		}
+
+		// walking the pages in both orders
+		for _, descending := range []bool{false, true} {
+			query := TransactionQuery{Descending: descending, Limit: 3}
+			var walked []string
+			for pages := 0; pages < 3; pages++ {
+				page := storage.QueryTransactions("address1", query)
+				walked = append(walked, hashes(page)...)
+				if page.Next == nil {
+					break
+				}
+				query.After = page.Next
+			}
+			expected := []string{"tx1", "tx2", "tx3", "tx4"}
+			if descending {
+				expected = []string{"tx4", "tx3", "tx2", "tx1"}
+			}
+			if !reflect.DeepEqual(walked, expected) {
+				t.Errorf("Expected the pages to hold %v, got %v", expected, walked)
+			}
+		}
+	})
+}
+
+func TestTransactionCursor(t *testing.T) {
+	cursor := TransactionCursor{BlockNum: 12, TxIndex: 3, Hash: "0xabc"}
+	parsed, err := ParseTransactionCursor(cursor.String())
+	if err != nil || parsed != cursor {
+		t.Errorf("Expected %+v, got %+v and error %v", cursor, parsed, err)
+	}
+
+	for _, token := range []string{"", "not base64!", "MTI6Mw"} {
+		if _, err := ParseTransactionCursor(token); err == nil {
+			t.Errorf("Expected an error for cursor %q", token)
+		}
+	}
+}
+
+// transferKind is a kind of transfer checked by testTransfers. The first two
+// transfers share a transaction of block 1 and touch address1, the third is
+// of block 2 and touches address3 only.
+type transferKind[T any] struct {
+	transfers  [3]T
+	add        func(s Storage, transfers ...T)
+	addAddress func(s Storage, address Address, transfers ...T)
+	get        func(s Storage, address Address) []T
+}
+
+func testTransfers[T any](t *testing.T, kind transferKind[T]) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		storage.AddSubscription(Subscription{Address: "address1"})
+
+		transfer1, transfer2, transfer3 := kind.transfers[0], kind.transfers[1], kind.transfers[2]
+		kind.add(storage, transfer1, transfer2, transfer3)
+		kind.add(storage, transfer1)
+
+		if transfers := kind.get(storage, "address1"); !reflect.DeepEqual(transfers, []T{transfer1, transfer2}) {
+			t.Errorf("Expected both transfers of tx1 to be stored once, got %+v", transfers)
+		}
+		if transfers := kind.get(storage, "address2"); len(transfers) != 0 {
+			t.Errorf("Expected no transfers for unobserved address, got %d", len(transfers))
+		}
+
+		kind.addAddress(storage, "address3", transfer1, transfer3)
+		if transfers := kind.get(storage, "address3"); !reflect.DeepEqual(transfers, []T{transfer3}) {
+			t.Errorf("Expected only transfer3 for address3, got %+v", transfers)
+		}
+
+		storage.RollbackBlock(1)
+		if transfers := kind.get(storage, "address1"); len(transfers) != 0 {
+			t.Errorf("Expected the transfers of block 1 to be rolled back, got %+v", transfers)
+		}
+	})
+}
+
+func TestAddTransfers(t *testing.T) {
+	tests := []struct {
+		name string
+		test func(t *testing.T)
+	}{
+		{"TokenTransfers", func(t *testing.T) {
+			testTransfers(t, transferKind[TokenTransfer]{
+				// told apart by their log index
+				transfers: [3]TokenTransfer{
+					{TxHash: "tx1", LogIndex: 0, Token: "token1", From: "address1", To: "address2", Value: NewQuantityFromUint64(100), BlockNum: 1},
+					{TxHash: "tx1", LogIndex: 1, Token: "token2", From: "address2", To: "address1", Value: NewQuantityFromUint64(200), BlockNum: 1},
+					{TxHash: "tx2", LogIndex: 0, Token: "token1", From: "address2", To: "address3", Value: NewQuantityFromUint64(1), BlockNum: 2},
+				},
+				add:        Storage.AddTokenTransfers,
+				addAddress: Storage.AddAddressTokenTransfers,
+				get:        Storage.GetTokenTransfers,
+			})
+		}},
+		{"NftTransfers", func(t *testing.T) {
+			testTransfers(t, transferKind[NftTransfer]{
+				// two tokens moved by the same TransferBatch event
+				transfers: [3]NftTransfer{
+					{TxHash: "tx1", LogIndex: 0, BatchIndex: 0, Contract: "nft1", Standard: StandardErc1155, From: "address2", To: "address1", TokenID: NewQuantityFromUint64(1), Amount: NewQuantityFromUint64(5), BlockNum: 1},
+					{TxHash: "tx1", LogIndex: 0, BatchIndex: 1, Contract: "nft1", Standard: StandardErc1155, From: "address2", To: "address1", TokenID: NewQuantityFromUint64(2), Amount: NewQuantityFromUint64(1), BlockNum: 1},
+					{TxHash: "tx2", LogIndex: 0, Contract: "nft2", Standard: StandardErc721, From: "address2", To: "address3", TokenID: NewQuantityFromUint64(7), Amount: NewQuantityFromUint64(1), BlockNum: 2},
+				},
+				add:        Storage.AddNftTransfers,
+				addAddress: Storage.AddAddressNftTransfers,
+				get:        Storage.GetNftTransfers,
+			})
+		}},
+		{"InternalTransfers", func(t *testing.T) {
+			testTransfers(t, transferKind[InternalTransfer]{
+				// two calls of the same transaction, told apart by their position in the call tree
+				transfers: [3]InternalTransfer{
+					{TxHash: "tx1", TraceAddress: []int{0}, CallType: CallTypeCall, From: "contract1", To: "address1", Value: NewQuantityFromUint64(1), BlockNum: 1},
+					{TxHash: "tx1", TraceAddress: []int{0, 0}, CallType: CallTypeCall, From: "address2", To: "address1", Value: NewQuantityFromUint64(2), BlockNum: 1},
+					{TxHash: "tx2", TraceAddress: []int{1}, CallType: CallTypeSelfdestruct, From: "contract1", To: "address3", Value: NewQuantityFromUint64(3), BlockNum: 2},
+				},
+				add:        Storage.AddInternalTransfers,
+				addAddress: Storage.AddAddressInternalTransfers,
+				get:        Storage.GetInternalTransfers,
+			})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, tt.test)
+	}
+}
+
+func TestSaveAndGetBackfillJobs(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		if jobs := storage.GetBackfillJobs(); len(jobs) != 0 {
+			t.Errorf("Expected no backfill jobs, got %d", len(jobs))
+		}
+
+		job := BackfillJob{Address: "address1", FromBlock: 1, ToBlock: 10, NextBlock: 1}
+		storage.SaveBackfillJob(job)
+		job.NextBlock = 5
+		storage.SaveBackfillJob(job)
+
+		jobs := storage.GetBackfillJobs()
+		if len(jobs) != 1 || !reflect.DeepEqual(jobs[0], job) {
+			t.Errorf("Expected the updated job to be stored, got %+v", jobs)
+		}
+	})
+}
+
+func TestDeliveries(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		created := time.Date(2024, 11, 14, 10, 0, 0, 0, time.UTC)
+		storage.AddSubscription(Subscription{Address: "address1", WebhookURL: "http://hooks"})
+		delivered := WebhookDelivery{ID: "d1", Address: "address1", Status: DeliveryStatusDelivered, CreatedAt: created}
+		later := WebhookDelivery{ID: "d2", Address: "address1", Status: DeliveryStatusPending, CreatedAt: created.Add(time.Minute), NextAttempt: created.Add(2 * time.Minute)}
+		sooner := WebhookDelivery{ID: "d3", Address: "address1", Status: DeliveryStatusPending, CreatedAt: created.Add(2 * time.Minute), NextAttempt: created.Add(time.Minute)}
+		other := WebhookDelivery{ID: "d4", Address: "address2", Status: DeliveryStatusFailed, CreatedAt: created}
+		for _, delivery := range []WebhookDelivery{sooner, later, delivered, other} {
+			storage.SaveDelivery(delivery)
+		}
+
+		if deliveries := storage.GetDeliveries("address1"); !reflect.DeepEqual(deliveries, []WebhookDelivery{delivered, later, sooner}) {
+			t.Errorf("Expected the deliveries of address1 in creation order, got %+v", deliveries)
+		}
+		if deliveries := storage.GetPendingDeliveries(); !reflect.DeepEqual(deliveries, []WebhookDelivery{sooner, later}) {
+			t.Errorf("Expected the pending deliveries in the order they are due, got %+v", deliveries)
+		}
+
+		later.Status, later.Attempts = DeliveryStatusDelivered, 1
+		storage.SaveDelivery(later)
+		if delivery, exists := storage.GetDelivery("d2"); !exists || !reflect.DeepEqual(delivery, later) {
+			t.Errorf("Expected the updated delivery, got %+v", delivery)
+		}
+		if _, exists := storage.GetDelivery("unknown"); exists {
+			t.Errorf("Expected no delivery for an unknown ID")
+		}
+
+		// unsubscribing drops the pending deliveries but keeps the history
+		storage.RemoveSubscription("address1", false)
+		if deliveries := storage.GetDeliveries("address1"); !reflect.DeepEqual(deliveries, []WebhookDelivery{delivered, later}) {
+			t.Errorf("Expected only the pending delivery to be dropped, got %+v", deliveries)
+		}
+	})
+}
+
+func TestRollbackBlock(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		storage.AddSubscription(Subscription{Address: "address1"})
+		storage.AddSubscription(Subscription{Address: "address2"})
+
+		tx1 := Transaction{Hash: "tx1", From: "address1", To: "address2", BlockNum: 1}
+		tx2 := Transaction{Hash: "tx2", From: "address1", To: "address3", BlockNum: 2}
+		tx3 := Transaction{Hash: "tx3", From: "address3", To: "address2", BlockNum: 2}
+		storage.AddTransactions(tx1, tx2, tx3)
+
+		storage.RollbackBlock(2)
+
+		txs := storage.GetTransactions("address1")
+		if len(txs) != 1 || txs[0].Hash != "tx1" {
+			t.Errorf("Expected only tx1 to remain for address1, got %+v", txs)
+		}
+
+		txs = storage.GetTransactions("address2")
+		if len(txs) != 1 || txs[0].Hash != "tx1" {
+			t.Errorf("Expected only tx1 to remain for address2, got %+v", txs)
+		}
+	})
+}
+
+func TestGetAndUpdateCurrentBlock(t *testing.T) {
+	forEachStorage(t, func(t *testing.T, storage Storage) {
+		if storage.GetCurrentBlock() != 0 {
+			t.Errorf("Expected initial block to be 0, got %d", storage.GetCurrentBlock())
+		}
+
+		storage.UpdateCurrentBlock(10)
+		if storage.GetCurrentBlock() != 10 {
+			t.Errorf("Expected current block to be updated to 10, got %d", storage.GetCurrentBlock())
+		}
+	})
+}
@@ -0,0 +1,278 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+const (
+	// DefaultMaxAttempts is the number of attempts before a delivery is
+	// given up and marked as failed.
+	DefaultMaxAttempts = 8
+	// DefaultBaseBackoff is the delay before the second attempt, doubled on
+	// every following one up to DefaultMaxBackoff.
+	DefaultBaseBackoff = 5 * time.Second
+	DefaultMaxBackoff  = time.Hour
+	defaultTimeout     = 10 * time.Second
+	// how often the outbox is checked for deliveries due for a retry
+	pollInterval = time.Second
+	// most of a response body read before the connection is reused
+	maxResponseBody = 64 << 10
+
+	// SignatureHeader holds "sha256=" followed by the hex encoded HMAC-SHA256
+	// of the body, keyed with the shared secret.
+	SignatureHeader = "X-Observer-Signature"
+	// DeliveryHeader holds the ID of the delivery, which stays the same
+	// across retries so receivers can drop duplicates.
+	DeliveryHeader = "X-Observer-Delivery"
+)
+
+// Payload is the JSON body posted to a webhook.
+type Payload struct {
+	DeliveryID  string
+	Address     storage.Address
+	Transaction storage.Transaction
+}
+
+// Dispatcher posts the transactions matched by subscriptions to their
+// webhook. Deliveries go through an outbox kept in the storage, so the ones
+// still pending are resumed after a restart.
+type Dispatcher struct {
+	storage     storage.Storage
+	secret      []byte
+	httpClient  *http.Client
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+	// wakes the delivery loop up when a delivery is queued
+	wake chan struct{}
+}
+
+type Option func(*Dispatcher)
+
+// WithSecret sets the secret the payloads are signed with.
+func WithSecret(secret string) Option {
+	return func(d *Dispatcher) {
+		d.secret = []byte(secret)
+	}
+}
+
+// WithHTTPClient replaces the client the payloads are posted with.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(d *Dispatcher) {
+		d.httpClient = httpClient
+	}
+}
+
+// WithRetry sets how many times a delivery is attempted and the delay
+// between attempts, which doubles after every failure up to maxBackoff.
+func WithRetry(maxAttempts int, baseBackoff, maxBackoff time.Duration) Option {
+	return func(d *Dispatcher) {
+		d.maxAttempts = maxAttempts
+		d.baseBackoff = baseBackoff
+		d.maxBackoff = maxBackoff
+	}
+}
+
+func NewDispatcher(storage storage.Storage, opts ...Option) *Dispatcher {
+	d := &Dispatcher{
+		storage:     storage,
+		httpClient:  &http.Client{Timeout: defaultTimeout},
+		maxAttempts: DefaultMaxAttempts,
+		baseBackoff: DefaultBaseBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+		wake:        make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// QueueMatches queues a delivery of every matched transaction to the
+// addresses it was stored for whose subscription has a webhook. It is called
+// by the parser while the block is ingested, so the deliveries are in the
+// outbox before the block counts as processed. A transaction already queued
+// for the same block, such as one of a block ingested twice, is skipped.
+func (d *Dispatcher) QueueMatches(matches ...storage.TransactionMatch) {
+	queued := false
+	now := time.Now().UTC()
+	for _, match := range matches {
+		for _, address := range match.Addresses {
+			subscription, exists := d.storage.GetSubscription(address)
+			if !exists || subscription.WebhookURL == "" {
+				continue
+			}
+			id := deliveryID(address, match.Transaction)
+			if _, exists := d.storage.GetDelivery(id); exists {
+				continue
+			}
+			d.storage.SaveDelivery(storage.WebhookDelivery{
+				ID:          id,
+				Address:     address,
+				URL:         subscription.WebhookURL,
+				Transaction: match.Transaction,
+				Status:      storage.DeliveryStatusPending,
+				NextAttempt: now,
+				CreatedAt:   now,
+			})
+			queued = true
+		}
+	}
+	if queued {
+		d.notify()
+	}
+}
+
+// GetDeliveries returns the delivery history of an address.
+func (d *Dispatcher) GetDeliveries(address storage.Address) []storage.WebhookDelivery {
+	return d.storage.GetDeliveries(address)
+}
+
+// Redeliver queues a delivery again with a fresh set of attempts, whether it
+// succeeded, failed or is still pending. Returns false when there is no
+// delivery with the given ID.
+func (d *Dispatcher) Redeliver(id string) (storage.WebhookDelivery, bool) {
+	delivery, exists := d.storage.GetDelivery(id)
+	if !exists {
+		return storage.WebhookDelivery{}, false
+	}
+
+	delivery.Status = storage.DeliveryStatusPending
+	delivery.Attempts = 0
+	delivery.NextAttempt = time.Now().UTC()
+	delivery.DeliveredAt = time.Time{}
+	d.storage.SaveDelivery(delivery)
+	d.notify()
+	return delivery, true
+}
+
+// Run attempts the deliveries as they become due until the context is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+func (d *Dispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliverDue attempts the pending deliveries whose next attempt is due, one
+// at a time so a slow webhook does not open many connections.
+func (d *Dispatcher) deliverDue(ctx context.Context) {
+	now := time.Now()
+	for _, delivery := range d.storage.GetPendingDeliveries() {
+		if ctx.Err() != nil || delivery.NextAttempt.After(now) {
+			return
+		}
+		d.attempt(ctx, delivery)
+	}
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery storage.WebhookDelivery) {
+	statusCode, err := d.post(ctx, delivery)
+	// an attempt cut short by a shutdown is made again after the restart
+	if ctx.Err() != nil {
+		return
+	}
+
+	delivery.Attempts++
+	delivery.LastStatusCode = statusCode
+	delivery.LastError = ""
+	switch {
+	case err == nil:
+		delivery.Status = storage.DeliveryStatusDelivered
+		delivery.DeliveredAt = time.Now().UTC()
+	case delivery.Attempts >= d.maxAttempts:
+		delivery.Status = storage.DeliveryStatusFailed
+		delivery.LastError = err.Error()
+		log.Printf("Giving up webhook delivery %s to %s after %d attempts: %v", delivery.ID, delivery.URL, delivery.Attempts, err)
+	default:
+		delivery.NextAttempt = time.Now().UTC().Add(d.backoff(delivery.Attempts - 1))
+		delivery.LastError = err.Error()
+		log.Printf("Webhook delivery %s to %s failed, retrying at %s: %v", delivery.ID, delivery.URL, delivery.NextAttempt.Format(time.RFC3339), err)
+	}
+	d.storage.SaveDelivery(delivery)
+}
+
+// post sends the payload of the delivery, a response outside of 2xx is an
+// error. It returns the status code of the response, 0 when there is none.
+func (d *Dispatcher) post(ctx context.Context, delivery storage.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(Payload{
+		DeliveryID:  delivery.ID,
+		Address:     delivery.Address,
+		Transaction: delivery.Transaction,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode payload: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(DeliveryHeader, delivery.ID)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(d.secret, body))
+
+	resp, err := d.httpClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// drained so the connection can be reused
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	delay := d.baseBackoff << attempt
+	if delay <= 0 || delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the body, receivers compute it
+// with the shared secret to check a payload comes from the observer.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// deliveryID identifies the delivery of a transaction to an address. The
+// block hash is part of it since a transaction moved to another block by a
+// reorg is delivered again.
+func deliveryID(address storage.Address, tx storage.Transaction) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s:%s:%s", address, tx.BlockHash, tx.Hash)))
+	return hex.EncodeToString(sum[:16])
+}
@@ -0,0 +1,147 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/oanatmaria/ethblkcn-observer/storage"
+)
+
+const hookedAddress = storage.Address("0x00000000000000000000000000000000000000aa")
+
+// newHookedStorage returns a storage with a subscription posting to url.
+func newHookedStorage(url string) storage.Storage {
+	store := storage.NewMemoryStorage()
+	store.AddSubscription(storage.Subscription{Address: hookedAddress, WebhookURL: url})
+	store.AddSubscription(storage.Subscription{Address: "0x00000000000000000000000000000000000000bb"})
+	return store
+}
+
+// matched returns the match of a transaction stored for the hooked address.
+func matched(tx storage.Transaction) storage.TransactionMatch {
+	return storage.TransactionMatch{Transaction: tx, Addresses: []storage.Address{hookedAddress}}
+}
+
+func TestDispatcher_QueueMatches(t *testing.T) {
+	store := newHookedStorage("http://hooks")
+	dispatcher := NewDispatcher(store)
+
+	hooked := storage.Transaction{Hash: "0x1", BlockHash: "0xb1", From: "0x00000000000000000000000000000000000000bb", To: hookedAddress}
+	unhooked := storage.Transaction{Hash: "0x2", BlockHash: "0xb1", From: "0x00000000000000000000000000000000000000bb"}
+	// only the addresses the transactions were stored for are delivered to
+	dispatcher.QueueMatches(
+		storage.TransactionMatch{Transaction: hooked, Addresses: []storage.Address{"0x00000000000000000000000000000000000000bb", hookedAddress}},
+		storage.TransactionMatch{Transaction: unhooked, Addresses: []storage.Address{"0x00000000000000000000000000000000000000bb"}},
+	)
+	// a block ingested twice
+	dispatcher.QueueMatches(matched(hooked))
+
+	deliveries := store.GetDeliveries(hookedAddress)
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected a single delivery, got %+v", deliveries)
+	}
+	if delivery := deliveries[0]; delivery.URL != "http://hooks" || delivery.Status != storage.DeliveryStatusPending || !reflect.DeepEqual(delivery.Transaction, hooked) {
+		t.Errorf("Expected a pending delivery of the transaction, got %+v", delivery)
+	}
+
+	// the same transaction moved to another block by a reorg is delivered again
+	reorged := hooked
+	reorged.BlockHash = "0xb2"
+	dispatcher.QueueMatches(matched(reorged))
+	if deliveries := store.GetDeliveries(hookedAddress); len(deliveries) != 2 {
+		t.Errorf("Expected the reorged transaction to be delivered again, got %+v", deliveries)
+	}
+}
+
+func TestDispatcher_DeliversSignedPayload(t *testing.T) {
+	var received *http.Request
+	var body []byte
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer hook.Close()
+
+	store := newHookedStorage(hook.URL)
+	dispatcher := NewDispatcher(store, WithSecret("secret"))
+	tx := storage.Transaction{Hash: "0x1", BlockHash: "0xb1", From: hookedAddress, Value: storage.NewQuantityFromUint64(1)}
+	dispatcher.QueueMatches(matched(tx))
+	dispatcher.deliverDue(context.Background())
+
+	if received == nil {
+		t.Fatalf("Expected the payload to be posted")
+	}
+	if signature := received.Header.Get(SignatureHeader); signature != "sha256="+Sign([]byte("secret"), body) {
+		t.Errorf("Expected the body to be signed with the secret, got %q", signature)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("Failed to decode payload: %v", err)
+	}
+	if payload.DeliveryID != received.Header.Get(DeliveryHeader) || payload.Address != hookedAddress || payload.Transaction.Hash != tx.Hash {
+		t.Errorf("Unexpected payload %+v", payload)
+	}
+
+	delivery, _ := store.GetDelivery(payload.DeliveryID)
+	if delivery.Status != storage.DeliveryStatusDelivered || delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusOK || delivery.DeliveredAt.IsZero() {
+		t.Errorf("Expected the delivery to be delivered, got %+v", delivery)
+	}
+}
+
+func TestDispatcher_RetriesWithBackoff(t *testing.T) {
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer hook.Close()
+
+	store := newHookedStorage(hook.URL)
+	dispatcher := NewDispatcher(store, WithRetry(2, time.Minute, time.Hour))
+	dispatcher.QueueMatches(matched(storage.Transaction{Hash: "0x1", From: hookedAddress}))
+
+	before := time.Now()
+	dispatcher.deliverDue(context.Background())
+	delivery := store.GetDeliveries(hookedAddress)[0]
+	if delivery.Status != storage.DeliveryStatusPending || delivery.Attempts != 1 || delivery.LastStatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("Expected the delivery to stay pending after a failure, got %+v", delivery)
+	}
+	if delivery.NextAttempt.Before(before.Add(time.Minute)) {
+		t.Errorf("Expected the next attempt to be delayed by the backoff, got %v", delivery.NextAttempt)
+	}
+
+	// not due yet
+	dispatcher.deliverDue(context.Background())
+	if delivery, _ := store.GetDelivery(delivery.ID); delivery.Attempts != 1 {
+		t.Errorf("Expected no attempt before the backoff elapsed, got %+v", delivery)
+	}
+
+	delivery.NextAttempt = time.Now()
+	store.SaveDelivery(delivery)
+	dispatcher.deliverDue(context.Background())
+	if delivery, _ := store.GetDelivery(delivery.ID); delivery.Status != storage.DeliveryStatusFailed || delivery.Attempts != 2 {
+		t.Errorf("Expected the delivery to fail once out of attempts, got %+v", delivery)
+	}
+}
+
+func TestDispatcher_Redeliver(t *testing.T) {
+	store := newHookedStorage("http://hooks")
+	dispatcher := NewDispatcher(store)
+	store.SaveDelivery(storage.WebhookDelivery{ID: "d1", Address: hookedAddress, Status: storage.DeliveryStatusFailed, Attempts: 8})
+
+	delivery, exists := dispatcher.Redeliver("d1")
+	if !exists || delivery.Status != storage.DeliveryStatusPending || delivery.Attempts != 0 {
+		t.Errorf("Expected the delivery to be pending with fresh attempts, got %+v", delivery)
+	}
+	if pending := store.GetPendingDeliveries(); len(pending) != 1 {
+		t.Errorf("Expected the delivery to be back in the outbox, got %+v", pending)
+	}
+	if _, exists := dispatcher.Redeliver("unknown"); exists {
+		t.Errorf("Expected an unknown delivery not to be found")
+	}
+}